@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"httpchat/internal/config"
+	"httpchat/internal/dlq"
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// dlqReplayGroupID is the consumer group that tracks which dead-lettered events were replayed
+const dlqReplayGroupID = "message-dlq-replayer"
+
+// newDLQReplayer creates a replayer that moves events from the dead-letter topic to the main topic
+func newDLQReplayer(cfg *config.Config, deps dependencies, appLogger *logger.Logger) *dlq.Replayer {
+	newConsumer := func() interfaces.KafkaConsumer {
+		return deps.newConsumer(cfg.KafkaDLQTopic, dlqReplayGroupID)
+	}
+	return dlq.NewReplayer(newConsumer, deps.producer, deps.repo, cfg.KafkaDLQTopic, cfg.KafkaTopic, appLogger)
+}
+
+// runDLQReplay implements the dlq-replay command, which replays dead-lettered events once and exits
+func runDLQReplay(args []string, cfg *config.Config, appLogger *logger.Logger) error {
+	flags := flag.NewFlagSet("dlq-replay", flag.ContinueOnError)
+	limit := flags.Int("limit", 100, "maximum number of dead-lettered events to replay")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// The dead-letter topic of the memory broker lives in the server process
+	if cfg.Broker == brokerMemory {
+		return errors.New("dlq-replay needs a shared broker, use POST /admin/dlq/replay with BROKER=memory")
+	}
+
+	// A one-off command is not scraped, so its metrics are discarded
+	deps := newDependencies(cfg, appLogger)
+	defer func() {
+		if err := deps.producer.Close(); err != nil {
+			appLogger.Error("Error closing Kafka producer", zap.Error(err))
+		}
+	}()
+	defer func() {
+		if closer, ok := deps.repo.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				appLogger.Error("Error closing database", zap.Error(err))
+			}
+		}
+	}()
+
+	// Stop between events on Ctrl+C instead of leaving one half-replayed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	replayed, err := newDLQReplayer(cfg, deps, appLogger).Replay(ctx, *limit)
+	appLogger.Info("Dead-letter replay finished", zap.Int("replayed", replayed))
+	return err
+}
@@ -3,24 +3,37 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"httpchat/internal/config"
+	"httpchat/internal/dlq"
 	"httpchat/internal/handler"
+	"httpchat/internal/health"
 	"httpchat/internal/interfaces"
 	"httpchat/internal/kafka"
+	"httpchat/internal/lifecycle"
 	"httpchat/internal/logger"
-	"httpchat/internal/model"
+	"httpchat/internal/memorybroker"
+	"httpchat/internal/metrics"
+	"httpchat/internal/natsbroker"
+	"httpchat/internal/outbox"
+	"httpchat/internal/processor"
+	"httpchat/internal/redisbroker"
 	"httpchat/internal/repository"
 	"httpchat/internal/repositoryerr"
+	"httpchat/internal/retention"
+	"httpchat/internal/retry"
 	"httpchat/internal/service"
+	"httpchat/internal/tracing"
 
 	_ "httpchat/docs/swagger"
 
@@ -69,74 +82,110 @@ func main() {
 		appLogger.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
-	// Parse Kafka brokers from configuration (comma-separated list)
-	kafkaBrokers := strings.Split(cfg.KafkaBrokers, ",")
-
-	// Initialize dependencies for our application
+	// The first argument selects the run mode or a one-off command
+	command := modeAll
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
 
-	// Initialize PostgreSQL repository for storing messages
-	var repo interfaces.MessageRepository
-	repo, err = repository.NewPostgreSQLMessageRepository(cfg.DatabaseURL)
-	if err != nil {
-		// Check for specific repository errors to provide better error messages
-		var repoErr *repositoryerr.RepositoryError
-		if errors.As(err, &repoErr) {
-			switch repoErr.ErrorCode() {
-			case repositoryerr.ErrorCodeDatabaseConnection:
-				appLogger.Fatal("Failed to connect to PostgreSQL database", zap.Error(err))
-			default:
-				appLogger.Fatal("Failed to initialize PostgreSQL repository", zap.Error(err))
-			}
+	switch command {
+	case modeAll, modeAPI, modeWorker:
+		runServer(command, cfg, appLogger)
+	case "dlq-replay":
+		if err := runDLQReplay(os.Args[2:], cfg, appLogger); err != nil {
+			appLogger.Fatal("Dead-letter replay failed", zap.Error(err))
 		}
-		appLogger.Fatal("Failed to initialize PostgreSQL repository", zap.Error(err))
+	case "migrate":
+		if err := runMigrate(os.Args[2:], cfg, appLogger); err != nil {
+			appLogger.Fatal("Migration failed", zap.Error(err))
+		}
+	default:
+		appLogger.Fatal("Unknown command", zap.String("command", command))
 	}
+}
 
-	// Initialize Kafka producer for sending messages
-	producer := kafka.NewProducer(kafkaBrokers)
+// Run modes of the server binary
+const (
+	// modeAll serves the API and processes Kafka events in one process
+	modeAll = "all"
+	// modeAPI serves the HTTP API and relays outbox events to Kafka
+	modeAPI = "serve-api"
+	// modeWorker processes Kafka events and only serves health and admin endpoints over HTTP
+	modeWorker = "run-worker"
+)
 
-	// Initialize Kafka consumer for reading messages
-	consumer := kafka.NewConsumer(kafkaBrokers, cfg.KafkaTopic, "message-processor-group")
+// store is the storage every run mode is wired against
+type store interface {
+	interfaces.MessageRepository
+	interfaces.OutboxRepository
+	interfaces.IdempotencyKeyRepository
+}
 
-	// Create service that implements our business logic
-	messageService := service.NewMessageService(repo, producer, consumer, cfg.KafkaTopic, appLogger)
+// dependencies are the connections to external services that the run modes share
+type dependencies struct {
+	repo     store
+	producer interfaces.KafkaProducer
+	// newConsumer opens a Kafka reader for a topic and consumer group
+	newConsumer func(topic, groupID string) interfaces.KafkaConsumer
+	// checkBroker reports whether the broker is reachable, when the broker can tell
+	checkBroker health.Check
+}
 
-	// Create handlers that connect HTTP requests to our service
-	messageHandler := handler.NewMessageHandler(messageService, appLogger)
+// app is what a run mode wires together; components the mode does not run are nil
+type app struct {
+	router    *gin.Engine
+	addr      string
+	relay     *outbox.Relay
+	sweeper   *retention.Sweeper
+	processor *processor.Processor
+	consumer  interfaces.KafkaConsumer
+	readiness *health.Checker
+
+	// background tracks the relay, sweeper and processor loops until stopBackground ends them
+	background     sync.WaitGroup
+	stopBackground context.CancelFunc
+}
 
-	// Setup HTTP routes using Gin framework
-	router := gin.Default()
-	router.POST("/messages", messageHandler.CreateMessageHandler)
-	router.GET("/statistics", messageHandler.GetStatisticsHandler)
-	router.PUT("/messages/:id/process", messageHandler.ProcessMessageHandler)
+// runServer wires the dependencies needed by the run mode and blocks until a shutdown signal
+func runServer(mode string, cfg *config.Config, appLogger *logger.Logger) {
+	appLogger.Info("Starting in run mode", zap.String("mode", mode))
 
-	// Swagger endpoint for API documentation
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Spans are exported when a tracing exporter is configured and dropped otherwise
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		appLogger.Fatal("Failed to set up tracing", zap.Error(err))
+	}
+
+	// Metrics are collected from every component and served on /metrics
+	appMetrics := metrics.New()
+
+	// Initialize dependencies for our application
+	deps := newDependencies(cfg, appLogger)
+
+	a := newApp(mode, cfg, deps, appMetrics, appLogger)
+
+	// The relay, sweeper and processor run until the shutdown stops them
+	a.startBackground(cfg, appLogger)
 
 	// Create HTTP server with security timeouts
 	server := &http.Server{
-		Addr:              ":" + cfg.ServerPort,
-		Handler:           router,
+		Addr:              a.addr,
+		Handler:           a.router,
 		ReadHeaderTimeout: 5 * time.Second, // Prevent Slowloris attacks
 	}
 
 	// Start HTTP server in a separate goroutine so we can handle shutdown signals
 	go func() {
-		appLogger.Info("Server starting", zap.String("port", cfg.ServerPort))
+		appLogger.Info("Server starting", zap.String("addr", a.addr))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			appLogger.Fatal("Server failed to start", zap.Error(err))
 		}
 	}()
 
-	// Create a context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Start background message processing from Kafka in a separate goroutine
-	go func() {
-		appLogger.Info("Starting Kafka message processor")
-		processKafkaMessages(ctx, messageService, consumer, cfg.KafkaTopic, cfg.KafkaMaxRetries, time.Duration(cfg.KafkaRetryDelayMs)*time.Millisecond, appLogger)
-	}()
-
 	// Wait for shutdown signal (Ctrl+C or SIGTERM)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -144,112 +193,443 @@ func main() {
 
 	appLogger.Info("Shutting down server...")
 
-	// Close connections to external services
-	if err := consumer.Close(); err != nil {
-		appLogger.Error("Error closing Kafka consumer", zap.Error(err))
-	}
+	// Fail readiness first and give the load balancer time to notice before requests are refused
+	a.readiness.SetShuttingDown()
+	time.Sleep(time.Duration(cfg.ShutdownReadinessDelayMs) * time.Millisecond)
 
-	if err := producer.Close(); err != nil {
-		appLogger.Error("Error closing Kafka producer", zap.Error(err))
+	// Stop the components in order, each phase within its own timeout
+	if err := lifecycle.Shutdown(a.shutdownPhases(cfg, server, deps, shutdownTracing), appLogger); err != nil {
+		appLogger.Fatal("Server did not shut down cleanly", zap.Error(err))
 	}
 
-	// Shutdown HTTP server with timeout to allow ongoing requests to complete
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	appLogger.Info("Server exited")
+}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		appLogger.Fatal("Server forced to shutdown", zap.Error(err))
+// startBackground starts the relay, sweeper and processor loops of the run mode
+func (a *app) startBackground(cfg *config.Config, appLogger *logger.Logger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopBackground = cancel
+
+	if a.relay != nil {
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			appLogger.Info("Starting outbox relay")
+			a.relay.Run(ctx)
+		}()
+	}
+	if a.sweeper != nil {
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			appLogger.Info("Starting idempotency key sweeper")
+			a.sweeper.Run(ctx)
+		}()
 	}
+	if a.processor != nil {
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			appLogger.Info("Starting Kafka message processor", zap.Int("workers", cfg.KafkaWorkers))
+			a.processor.Run(ctx)
+		}()
+	}
+}
 
-	appLogger.Info("Server exited")
+// shutdownPhases returns the ordered steps that stop a started app. HTTP traffic stops
+// first while the handlers can still reach the storage; then the background loops, so
+// that the processor commits what it finished while the producer is still open for the
+// relay and the dead-letter topic; and last the connections they all share.
+func (a *app) shutdownPhases(cfg *config.Config, server *http.Server, deps dependencies, flushTraces func(context.Context) error) []lifecycle.Phase {
+	return []lifecycle.Phase{
+		{
+			// Shutdown closes the listeners first and then waits for the in-flight handlers
+			Name:    "http",
+			Timeout: time.Duration(cfg.ShutdownHTTPTimeoutMs) * time.Millisecond,
+			Stop: func(ctx context.Context) error {
+				if err := server.Shutdown(ctx); err != nil {
+					// Cut the requests that did not finish in time
+					_ = server.Close()
+					return err
+				}
+				return nil
+			},
+		},
+		{
+			// The processor stops fetching and drains its workers, which commit what they finish
+			Name:    "background",
+			Timeout: time.Duration(cfg.ShutdownBackgroundTimeoutMs) * time.Millisecond,
+			Stop: func(ctx context.Context) error {
+				a.stopBackground()
+				stopped := make(chan struct{})
+				go func() {
+					a.background.Wait()
+					close(stopped)
+				}()
+				select {
+				case <-stopped:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+
+				if a.consumer != nil {
+					if err := a.consumer.Close(); err != nil {
+						return fmt.Errorf("failed to close Kafka consumer: %w", err)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			// Closing the producer flushes the events it still buffers
+			Name:    "connections",
+			Timeout: time.Duration(cfg.ShutdownCloseTimeoutMs) * time.Millisecond,
+			Stop: func(ctx context.Context) error {
+				var errs []error
+				if err := deps.producer.Close(); err != nil {
+					errs = append(errs, fmt.Errorf("failed to close Kafka producer: %w", err))
+				}
+				if closer, ok := deps.repo.(io.Closer); ok {
+					if err := closer.Close(); err != nil {
+						errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+					}
+				}
+				if err := flushTraces(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to flush traces: %w", err))
+				}
+				return errors.Join(errs...)
+			},
+		},
+	}
 }
 
-// processKafkaMessages processes messages from Kafka
-func processKafkaMessages(ctx context.Context, service interfaces.MessageService, consumer interfaces.KafkaConsumer, topic string, maxRetries int, retryDelay time.Duration, appLogger *logger.Logger) {
-	for {
-		select {
-		case <-ctx.Done():
-			// Context was cancelled, time to shut down
-			appLogger.Info("Kafka message processor shutting down")
-			return
-		default:
-			// Read message from Kafka
-			messageBytes, err := consumer.ReadMessage(ctx, topic)
+// Message brokers selected by BROKER
+const (
+	brokerKafka  = "kafka"
+	brokerMemory = "memory"
+	brokerNATS   = "nats"
+	brokerRedis  = "redis"
+)
+
+// newDependencies opens the storage and connects to the configured broker, or exits if either is unusable
+func newDependencies(cfg *config.Config, appLogger *logger.Logger) dependencies {
+	deps := dependencies{
+		// Initialize the repository for storing messages
+		repo: newRepository(cfg, appLogger),
+	}
+
+	switch cfg.Broker {
+	case brokerKafka:
+		// Parse Kafka brokers from configuration (comma-separated list)
+		kafkaBrokers := strings.Split(cfg.KafkaBrokers, ",")
+
+		security := newSecurityConfig(cfg, appLogger)
+
+		// Initialize Kafka producer for sending messages
+		producer, err := kafka.NewProducer(kafkaBrokers, newProducerConfig(cfg, appLogger), security)
+		if err != nil {
+			appLogger.Fatal("Invalid Kafka producer configuration", zap.Error(err))
+		}
+		deps.producer = producer
+		deps.newConsumer = func(topic, groupID string) interfaces.KafkaConsumer {
+			consumer, err := kafka.NewConsumer(kafkaBrokers, topic, groupID, security)
 			if err != nil {
-				// Check if context was cancelled
-				if ctx.Err() != nil {
-					appLogger.Info("Kafka message processor shutting down")
-					return
-				}
-				appLogger.Error("Error reading message from Kafka", zap.Error(err))
-				continue
+				appLogger.Fatal("Invalid Kafka consumer configuration", zap.Error(err))
 			}
-
-			// Decode message from JSON
-			var message model.Message
-			if err := json.Unmarshal(messageBytes, &message); err != nil {
-				appLogger.Error("Error unmarshaling message", zap.Error(err))
-				continue
+			return consumer
+		}
+		deps.checkBroker, err = kafka.BrokerCheck(kafkaBrokers, security)
+		if err != nil {
+			appLogger.Fatal("Invalid Kafka connection configuration", zap.Error(err))
+		}
+	case brokerMemory:
+		appLogger.Warn("Using in-memory broker, events are lost on restart")
+		broker := memorybroker.New(cfg.MemoryBrokerPartitions, cfg.MemoryBrokerBufferSize)
+		deps.producer = broker.NewProducer()
+		deps.newConsumer = func(topic, groupID string) interfaces.KafkaConsumer {
+			return broker.NewConsumer(topic, groupID)
+		}
+	case brokerNATS:
+		broker, err := natsbroker.Connect(cfg.NATSURL, time.Duration(cfg.NATSAckWaitMs)*time.Millisecond)
+		if err != nil {
+			appLogger.Fatal("Failed to connect to NATS", zap.Error(err))
+		}
+		deps.producer = broker.NewProducer()
+		deps.newConsumer = func(topic, groupID string) interfaces.KafkaConsumer {
+			return broker.NewConsumer(topic, groupID)
+		}
+	case brokerRedis:
+		// Pending entries are read again by the consumer of the same name after a restart
+		consumerName := cfg.RedisConsumerName
+		if consumerName == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				appLogger.Fatal("Failed to determine Redis consumer name, set REDIS_CONSUMER_NAME", zap.Error(err))
 			}
+			consumerName = hostname
+		}
+		broker, err := redisbroker.Connect(cfg.RedisURL, consumerName, time.Duration(cfg.RedisClaimIdleMs)*time.Millisecond)
+		if err != nil {
+			appLogger.Fatal("Failed to connect to Redis", zap.Error(err))
+		}
+		deps.producer = broker.NewProducer()
+		deps.newConsumer = func(topic, groupID string) interfaces.KafkaConsumer {
+			return broker.NewConsumer(topic, groupID)
+		}
+	default:
+		appLogger.Fatal("Unknown broker", zap.String("broker", cfg.Broker))
+	}
 
-			appLogger.Info("Processing Kafka message", zap.Int64("id", message.ID))
+	return deps
+}
 
-			// Process message with retry mechanism
-			shouldSkipMessage := false
-			var processErr error
-			for attempt := 0; attempt <= maxRetries; attempt++ {
-				processErr = service.ProcessMessage(ctx, message.ID)
-				if processErr == nil {
-					// Success - message processed
-					break
-				}
+// newProducerConfig builds the Kafka producer settings. The producer publishes the outbox
+// and the dead letter queue, which delete the row or commit the offset of an event once its
+// send returns, so it always waits for Kafka: async writes are only for fire-and-forget sends.
+func newProducerConfig(cfg *config.Config, appLogger *logger.Logger) kafka.ProducerConfig {
+	if cfg.KafkaProducerAsync {
+		appLogger.Warn("KAFKA_PRODUCER_ASYNC is ignored, the outbox relay and the dead letter queue need confirmed writes")
+	}
+	return kafka.ProducerConfig{
+		BatchSize:    cfg.KafkaProducerBatchSize,
+		BatchTimeout: time.Duration(cfg.KafkaProducerBatchTimeoutMs) * time.Millisecond,
+		RequiredAcks: cfg.KafkaProducerRequiredAcks,
+		Compression:  cfg.KafkaProducerCompression,
+		Balancer:     cfg.KafkaProducerBalancer,
+	}
+}
 
-				// Check if it's a specific error type that shouldn't be retried
-				var repoErr *repositoryerr.RepositoryError
-				if errors.As(processErr, &repoErr) {
-					switch repoErr.ErrorCode() {
-					case repositoryerr.ErrorCodeMessageNotFound:
-						// Don't retry if message not found
-						appLogger.Warn("Message not found for processing", zap.Int64("id", message.ID))
-						shouldSkipMessage = true
-						processErr = nil // Clear error to avoid logging failure
-					case repositoryerr.ErrorCodeInvalidInput:
-						// Don't retry if invalid input
-						appLogger.Warn("Invalid message ID format", zap.Int64("id", message.ID), zap.Error(processErr))
-						shouldSkipMessage = true
-						processErr = nil // Clear error to avoid logging failure
-					}
-				}
+// newSecurityConfig builds the TLS and SASL settings of the Kafka connections
+func newSecurityConfig(cfg *config.Config, appLogger *logger.Logger) kafka.SecurityConfig {
+	if cfg.KafkaTLSInsecureSkipVerify {
+		appLogger.Warn("Kafka broker certificates are not verified")
+	}
+	return kafka.SecurityConfig{
+		TLSEnabled:            cfg.KafkaTLSEnabled,
+		TLSCAFile:             cfg.KafkaTLSCAFile,
+		TLSCertFile:           cfg.KafkaTLSCertFile,
+		TLSKeyFile:            cfg.KafkaTLSKeyFile,
+		TLSServerName:         cfg.KafkaTLSServerName,
+		TLSInsecureSkipVerify: cfg.KafkaTLSInsecureSkipVerify,
+		SASLMechanism:         cfg.KafkaSASLMechanism,
+		SASLUsername:          cfg.KafkaSASLUsername,
+		SASLPassword:          cfg.KafkaSASLPassword,
+	}
+}
 
-				// If we should skip the message, break out of retry loop
-				if shouldSkipMessage {
-					break
-				}
+// newApp wires the components of a run mode without starting them.
+// The API modes serve the business and admin routes and run the outbox relay; the worker
+// modes process Kafka events and serve only health, readiness and metrics over HTTP.
+func newApp(mode string, cfg *config.Config, deps dependencies, appMetrics *metrics.Metrics, appLogger *logger.Logger) *app {
+	serveAPI := mode == modeAll || mode == modeAPI
+	runWorker := mode == modeAll || mode == modeWorker
+
+	// Readiness covers the storage and broker; the check of the storage is taken before
+	// instrumentation hides it
+	readiness := health.NewChecker(
+		time.Duration(cfg.ReadinessCheckTimeoutMs)*time.Millisecond,
+		time.Duration(cfg.ReadinessCacheTTLMs)*time.Millisecond,
+	)
+	if pinger, ok := deps.repo.(interface{ Ping(context.Context) error }); ok {
+		readiness.Register("database", pinger.Ping)
+	}
+	if deps.checkBroker != nil {
+		readiness.Register("broker", deps.checkBroker)
+	}
 
-				// Retry for other errors (including database connection errors)
-				if attempt < maxRetries {
-					appLogger.Warn("Error processing message, retrying",
-						zap.Int64("id", message.ID),
-						zap.Int("attempt", attempt+1),
-						zap.Error(processErr))
-					time.Sleep(retryDelay)
-				}
-			}
+	// Record every call to storage and the broker
+	deps = instrumentDependencies(deps, appMetrics)
 
-			// If we should skip the message, continue to the next message
-			if shouldSkipMessage {
-				appLogger.Info("Successfully processed Kafka message", zap.Int64("id", message.ID))
-				continue
-			}
+	// Idempotency keys can be reused for a new message once they expire
+	idempotencyKeyTTL := time.Duration(cfg.IdempotencyKeyTTLHours) * time.Hour
+
+	// Create service that implements our business logic
+	messageService := service.NewMessageService(deps.repo, idempotencyKeyTTL, appLogger)
+
+	// Setup HTTP routes using Gin framework
+	a := &app{router: gin.Default(), readiness: readiness}
+	a.router.Use(tracing.GinMiddleware(), handler.RequestIDMiddleware(), appMetrics.GinMiddleware())
+	registerHealthRoutes(a.router, handler.NewHealthHandler(readiness))
+
+	// Every run mode exports its metrics along with the message statistics
+	appMetrics.RegisterStatistics(
+		deps.repo.GetStatistics,
+		time.Duration(cfg.MetricsStatisticsTimeoutMs)*time.Millisecond,
+		time.Duration(cfg.MetricsStatisticsCacheTTLMs)*time.Millisecond,
+	)
+	registerMetricsRoutes(a.router, appMetrics)
+
+	if serveAPI {
+		// Create handlers that connect HTTP requests to our service
+		messageHandler := handler.NewMessageHandler(messageService, appLogger)
+		registerRoutes(a.router, messageHandler)
+
+		// Swagger endpoint for API documentation
+		a.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+		// Replaying the dead-letter topic opens a Kafka reader only for the duration of a replay
+		adminHandler := handler.NewAdminHandler(newDLQReplayer(cfg, deps, appLogger), appLogger)
+		registerAdminRoutes(a.router, adminHandler, cfg.AdminToken, appLogger)
+
+		// The outbox relay publishes stored events to Kafka
+		a.relay = outbox.NewRelay(
+			deps.repo,
+			deps.producer,
+			cfg.KafkaTopic,
+			cfg.OutboxBatchSize,
+			time.Duration(cfg.OutboxPollIntervalMs)*time.Millisecond,
+			retry.Policy{
+				InitialInterval: time.Duration(cfg.OutboxRetryDelayMs) * time.Millisecond,
+				MaxInterval:     time.Duration(cfg.OutboxRetryMaxDelayMs) * time.Millisecond,
+				Multiplier:      2,
+			},
+			appLogger,
+		)
+
+		// Delete idempotency keys once they have expired
+		a.sweeper = retention.NewSweeper(
+			deps.repo,
+			idempotencyKeyTTL,
+			time.Duration(cfg.IdempotencyCleanupIntervalMs)*time.Millisecond,
+			appLogger,
+		)
+	}
+
+	if runWorker {
+		// Initialize Kafka consumer for reading messages
+		a.consumer = deps.newConsumer(cfg.KafkaTopic, "message-processor-group")
+
+		// Events that cannot be processed are published to the dead-letter topic
+		deadLetters := dlq.NewPublisher(deps.producer, cfg.KafkaDLQTopic)
+
+		// The processor handles Kafka messages in the background
+		a.processor = processor.New(
+			messageService,
+			a.consumer,
+			deadLetters,
+			cfg.KafkaTopic,
+			cfg.KafkaWorkers,
+			retry.Policy{
+				InitialInterval: time.Duration(cfg.KafkaRetryDelayMs) * time.Millisecond,
+				MaxInterval:     time.Duration(cfg.KafkaRetryMaxDelayMs) * time.Millisecond,
+				Multiplier:      2,
+				MaxAttempts:     cfg.KafkaMaxRetries + 1,
+				MaxElapsedTime:  time.Duration(cfg.KafkaRetryMaxElapsedMs) * time.Millisecond,
+				Retryable:       retry.RepositoryRetryable,
+			},
+			time.Duration(cfg.KafkaDrainTimeoutMs)*time.Millisecond,
+			appMetrics,
+			appLogger,
+		)
+		readiness.Register("processor", a.processor.Check)
+	}
+
+	// A dedicated worker has no business routes and listens on its own port
+	a.addr = ":" + cfg.ServerPort
+	if mode == modeWorker {
+		a.addr = ":" + cfg.WorkerPort
+	}
+
+	return a
+}
+
+// instrumentDependencies wraps the storage and broker connections so that their use is recorded
+func instrumentDependencies(deps dependencies, appMetrics *metrics.Metrics) dependencies {
+	newConsumer := deps.newConsumer
+	deps.repo = appMetrics.InstrumentRepository(deps.repo)
+	deps.producer = appMetrics.InstrumentProducer(deps.producer)
+	deps.newConsumer = func(topic, groupID string) interfaces.KafkaConsumer {
+		return appMetrics.InstrumentConsumer(newConsumer(topic, groupID))
+	}
+	return deps
+}
+
+// registerRoutes registers the business API routes on the router
+func registerRoutes(router *gin.Engine, messageHandler *handler.MessageHandler) {
+	router.POST("/messages", messageHandler.CreateMessageHandler)
+	router.GET("/messages", messageHandler.ListMessagesHandler)
+	router.GET("/messages/:id", messageHandler.GetMessageHandler)
+	router.GET("/statistics", messageHandler.GetStatisticsHandler)
+	router.PUT("/messages/:id/process", messageHandler.ProcessMessageHandler)
+}
+
+// registerHealthRoutes registers the health check routes, which every run mode serves
+func registerHealthRoutes(router *gin.Engine, healthHandler *handler.HealthHandler) {
+	router.GET("/healthz", healthHandler.LivenessHandler)
+	router.GET("/readyz", healthHandler.ReadinessHandler)
+}
+
+// registerMetricsRoutes registers the Prometheus endpoint, which every run mode serves
+func registerMetricsRoutes(router *gin.Engine, appMetrics *metrics.Metrics) {
+	router.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+}
+
+// registerAdminRoutes registers the operational routes behind the admin token.
+// Without a token the admin API stays disabled.
+func registerAdminRoutes(router *gin.Engine, adminHandler *handler.AdminHandler, token string, appLogger *logger.Logger) {
+	if token == "" {
+		appLogger.Warn("ADMIN_TOKEN is not set, admin routes are disabled")
+		return
+	}
+	admin := router.Group("/admin", adminHandler.RequireAdminToken(token))
+	admin.POST("/dlq/replay", adminHandler.ReplayDeadLettersHandler)
+}
+
+// Storage backends selected by STORAGE_BACKEND
+const (
+	storagePostgres = "postgres"
+	storageMemory   = "memory"
+)
+
+// newRepository opens the configured storage backend or exits if it is unusable
+func newRepository(cfg *config.Config, appLogger *logger.Logger) store {
+	switch cfg.StorageBackend {
+	case storagePostgres:
+		// A sqlite:// database URL selects the embedded SQLite database instead
+		if repository.IsSQLiteURL(cfg.DatabaseURL) {
+			return newSQLiteRepository(cfg, appLogger)
+		}
+		return newPostgreSQLRepository(cfg, appLogger)
+	case storageMemory:
+		appLogger.Warn("Using in-memory storage, messages are lost on restart")
+		return repository.NewMemoryMessageRepository()
+	default:
+		appLogger.Fatal("Unknown storage backend", zap.String("backend", cfg.StorageBackend))
+		return nil
+	}
+}
 
-			if processErr != nil {
-				appLogger.Error("Failed to process message after retries",
-					zap.Int64("id", message.ID),
-					zap.Error(processErr))
-				continue
+// newPostgreSQLRepository opens the PostgreSQL repository or exits if the database is unusable
+func newPostgreSQLRepository(cfg *config.Config, appLogger *logger.Logger) *repository.PostgreSQLMessageRepository {
+	repo, err := repository.NewPostgreSQLMessageRepository(cfg.DatabaseURL, cfg.DatabaseAutoMigrate)
+	if err != nil {
+		// Check for specific repository errors to provide better error messages
+		var repoErr *repositoryerr.RepositoryError
+		if errors.As(err, &repoErr) {
+			switch repoErr.ErrorCode() {
+			case repositoryerr.ErrorCodeDatabaseConnection:
+				appLogger.Fatal("Failed to connect to PostgreSQL database", zap.Error(err))
+			case repositoryerr.ErrorCodeSchemaVersion:
+				appLogger.Fatal("Database schema does not match this release, run the migrate command", zap.Error(err))
+			default:
+				appLogger.Fatal("Failed to initialize PostgreSQL repository", zap.Error(err))
 			}
+		}
+		appLogger.Fatal("Failed to initialize PostgreSQL repository", zap.Error(err))
+	}
+	return repo
+}
 
-			appLogger.Info("Successfully processed Kafka message", zap.Int64("id", message.ID))
+// newSQLiteRepository opens the SQLite repository or exits if the database is unusable
+func newSQLiteRepository(cfg *config.Config, appLogger *logger.Logger) *repository.SQLiteMessageRepository {
+	repo, err := repository.NewSQLiteMessageRepository(cfg.DatabaseURL, cfg.DatabaseAutoMigrate)
+	if err != nil {
+		var repoErr *repositoryerr.RepositoryError
+		if errors.As(err, &repoErr) && repoErr.ErrorCode() == repositoryerr.ErrorCodeSchemaVersion {
+			appLogger.Fatal("SQLite schema does not match this release, enable DATABASE_AUTO_MIGRATE to create it", zap.Error(err))
 		}
+		appLogger.Fatal("Failed to initialize SQLite repository", zap.Error(err))
 	}
+	appLogger.Info("Using SQLite storage", zap.String("database_url", cfg.DatabaseURL))
+	return repo
 }
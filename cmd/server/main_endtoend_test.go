@@ -4,168 +4,48 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"httpchat/internal/config"
+	"httpchat/internal/dlq"
 	"httpchat/internal/handler"
 	"httpchat/internal/interfaces"
+	"httpchat/internal/kafka/kafkatest"
 	"httpchat/internal/logger"
+	"httpchat/internal/memorybroker"
+	"httpchat/internal/metrics"
 	"httpchat/internal/model"
-	"httpchat/internal/repositoryerr"
+	"httpchat/internal/outbox"
+	"httpchat/internal/processor"
+	"httpchat/internal/repository"
+	"httpchat/internal/requestid"
+	"httpchat/internal/retry"
 	"httpchat/internal/service"
+	"httpchat/internal/tracing/tracingtest"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
-// Mock implementations for end-to-end testing
-type mockMessageRepository struct {
-	messages map[int64]*model.Message
-	nextID   int64
-}
-
-func newMockMessageRepository() *mockMessageRepository {
-	return &mockMessageRepository{
-		messages: make(map[int64]*model.Message),
-		nextID:   1,
-	}
-}
-
-func (m *mockMessageRepository) CreateMessage(_ context.Context, content string) (*model.Message, error) {
-	id := m.nextID
-	m.nextID++
-	now := time.Now()
-	message := &model.Message{
-		ID:        id,
-		Content:   content,
-		Processed: false,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-	m.messages[id] = message
-	return message, nil
-}
-
-func (m *mockMessageRepository) GetMessageByID(_ context.Context, id int64) (*model.Message, error) {
-	message, exists := m.messages[id]
-	if !exists {
-		return nil, &repositoryerr.RepositoryError{
-			Op:  "GetMessageByID",
-			Err: repositoryerr.ErrMessageNotFound,
-		}
-	}
-	return message, nil
-}
-
-func (m *mockMessageRepository) UpdateMessageStatus(_ context.Context, id int64, processed bool) error {
-	message, exists := m.messages[id]
-	if !exists {
-		return &repositoryerr.RepositoryError{
-			Op:  "UpdateMessageStatus",
-			Err: repositoryerr.ErrMessageNotFound,
-		}
-	}
-	message.Processed = processed
-	message.UpdatedAt = time.Now()
-	return nil
-}
-
-func (m *mockMessageRepository) GetAllMessages(_ context.Context) ([]*model.Message, error) {
-	messages := make([]*model.Message, 0, len(m.messages))
-	for _, message := range m.messages {
-		messages = append(messages, message)
-	}
-	return messages, nil
-}
-
-func (m *mockMessageRepository) GetStatistics(_ context.Context) (*model.Statistics, error) {
-	total := int64(len(m.messages))
-	processed := int64(0)
-	unprocessed := int64(0)
-
-	for _, message := range m.messages {
-		if message.Processed {
-			processed++
-		} else {
-			unprocessed++
-		}
-	}
-
-	return &model.Statistics{
-		TotalMessages:       total,
-		ProcessedMessages:   processed,
-		UnprocessedMessages: unprocessed,
-	}, nil
-}
-
-	// Ensure mockMessageRepository implements interfaces.MessageRepository
-	var _ interfaces.MessageRepository = (*mockMessageRepository)(nil)
-
-type mockKafkaProducer struct {
-	messages [][]byte
-}
-
-func newMockKafkaProducer() *mockKafkaProducer {
-	return &mockKafkaProducer{
-		messages: make([][]byte, 0),
-	}
-}
-
-func (m *mockKafkaProducer) SendMessage(_ context.Context, _ string, message []byte) error {
-	m.messages = append(m.messages, message)
-	return nil
-}
-
-func (m *mockKafkaProducer) Close() error {
-	return nil
-}
-
-// Ensure mockKafkaProducer implements interfaces.KafkaProducer
-var _ interfaces.KafkaProducer = (*mockKafkaProducer)(nil)
-
-type mockKafkaConsumer struct {
-	messages [][]byte
-	index    int
-}
-
-func newMockKafkaConsumer(messages [][]byte) *mockKafkaConsumer {
-	return &mockKafkaConsumer{
-		messages: messages,
-		index:    0,
-	}
-}
-
-func (m *mockKafkaConsumer) ReadMessage(_ context.Context, _ string) ([]byte, error) {
-	if m.index >= len(m.messages) {
-		// Simulate no more messages
-		time.Sleep(100 * time.Millisecond)
-		return nil, context.DeadlineExceeded
-	}
-	message := m.messages[m.index]
-	m.index++
-	return message, nil
-}
-
-func (m *mockKafkaConsumer) Close() error {
-	return nil
-}
-
-// Ensure mockKafkaConsumer implements interfaces.KafkaConsumer
-var _ interfaces.KafkaConsumer = (*mockKafkaConsumer)(nil)
-
-func setupEndToEndTestRouter() (*gin.Engine, *mockMessageRepository, *mockKafkaProducer, *mockKafkaConsumer) {
+func setupEndToEndTestRouter() (*gin.Engine, *repository.MemoryMessageRepository, *kafkatest.Producer, *kafkatest.Consumer) {
 	// Create mock components
-	mockRepo := newMockMessageRepository()
-	mockProducer := newMockKafkaProducer()
-	mockConsumer := newMockKafkaConsumer(nil)
+	repo := repository.NewMemoryMessageRepository()
+	mockProducer := &kafkatest.Producer{}
+	mockConsumer := kafkatest.NewConsumer()
 
 	// Create logger for testing
 	testLogger, _ := logger.New()
 
 	// Create service
-	service := service.NewMessageService(mockRepo, mockProducer, mockConsumer, "test-topic", testLogger)
+	service := service.NewMessageService(repo, time.Hour, testLogger)
 
 	// Create handler
 	messageHandler := handler.NewMessageHandler(service, testLogger)
@@ -173,15 +53,13 @@ func setupEndToEndTestRouter() (*gin.Engine, *mockMessageRepository, *mockKafkaP
 	// Setup routes with Gin
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.POST("/messages", messageHandler.CreateMessageHandler)
-	router.GET("/statistics", messageHandler.GetStatisticsHandler)
-	router.PUT("/messages/:id/process", messageHandler.ProcessMessageHandler)
+	registerRoutes(router, messageHandler)
 
-	return router, mockRepo, mockProducer, mockConsumer
+	return router, repo, mockProducer, mockConsumer
 }
 
 func TestEndToEndAPIScenario(t *testing.T) {
-	router, mockRepo, mockProducer, _ := setupEndToEndTestRouter()
+	router, repo, mockProducer, _ := setupEndToEndTestRouter()
 
 	// Test creating a message
 	t.Run("CreateMessage", func(t *testing.T) {
@@ -200,13 +78,39 @@ func TestEndToEndAPIScenario(t *testing.T) {
 		assert.Equal(t, int64(1), response.ID)
 
 		// Verify message was created in repository
-		message, err := mockRepo.GetMessageByID(context.Background(), 1)
+		message, err := repo.GetMessageByID(context.Background(), 1)
 		assert.NoError(t, err)
 		assert.Equal(t, "Test message", message.Content)
-		assert.False(t, message.Processed)
+		assert.Equal(t, model.StatusPending, message.Status)
+
+		// Verify the message is only published by the outbox relay
+		assert.Empty(t, mockProducer.Sent())
+
+		testLogger, _ := logger.New()
+		relay := outbox.NewRelay(repo, mockProducer, "test-topic", 10, time.Second, retry.Policy{InitialInterval: time.Second}, testLogger)
+		published, err := relay.RelayPending(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, published)
 
 		// Verify message was sent to Kafka
-		assert.Equal(t, 1, len(mockProducer.messages))
+		assert.Len(t, mockProducer.Sent(), 1)
+	})
+
+	// Test listing messages
+	t.Run("ListMessages", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages?limit=10", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var response handler.ListMessagesResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Len(t, response.Messages, 1)
+		assert.Equal(t, "Test message", response.Messages[0].Content)
+		assert.Empty(t, response.NextCursor)
 	})
 
 	// Test getting statistics
@@ -223,7 +127,7 @@ func TestEndToEndAPIScenario(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), response.TotalMessages)
 		assert.Equal(t, int64(0), response.ProcessedMessages)
-		assert.Equal(t, int64(1), response.UnprocessedMessages)
+		assert.Equal(t, int64(1), response.PendingMessages)
 	})
 
 	// Test processing a message
@@ -236,9 +140,47 @@ func TestEndToEndAPIScenario(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rr.Code)
 
 		// Verify message was processed in repository
-		message, err := mockRepo.GetMessageByID(context.Background(), 1)
+		message, err := repo.GetMessageByID(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StatusProcessed, message.Status)
+		assert.Equal(t, 1, message.Attempts)
+
+		// Processing it again succeeds without another attempt
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		message, err = repo.GetMessageByID(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, message.Attempts)
+	})
+
+	// Test fetching the processed message
+	t.Run("GetProcessedMessage", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages/1", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("ETag"))
+
+		var response model.Message
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.True(t, message.Processed)
+		assert.Equal(t, model.StatusProcessed, response.Status)
+
+		// The deprecated processed flag is still sent
+		assert.Contains(t, rr.Body.String(), `"processed":true`)
+
+		// A repeated request with the same ETag is answered with 304
+		req, _ = http.NewRequest("GET", "/messages/1", nil)
+		req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotModified, rr.Code)
 	})
 
 	// Test getting updated statistics
@@ -255,17 +197,16 @@ func TestEndToEndAPIScenario(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), response.TotalMessages)
 		assert.Equal(t, int64(1), response.ProcessedMessages)
-		assert.Equal(t, int64(0), response.UnprocessedMessages)
+		assert.Equal(t, int64(0), response.PendingMessages)
 	})
 }
 
 func TestEndToEndKafkaProcessingScenario(t *testing.T) {
 	// Create mock components
-	mockRepo := newMockMessageRepository()
-	mockProducer := newMockKafkaProducer()
+	repo := repository.NewMemoryMessageRepository()
 
 	// Create a message in the repository first
-	createdMessage, err := mockRepo.CreateMessage(context.Background(), "Test message")
+	createdMessage, err := repo.CreateMessage(context.Background(), "Test message")
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), createdMessage.ID)
 
@@ -273,20 +214,20 @@ func TestEndToEndKafkaProcessingScenario(t *testing.T) {
 	message := &model.Message{
 		ID:        1,
 		Content:   "Test message",
-		Processed: false,
+		Status:    model.StatusPending,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 	messageBytes, _ := json.Marshal(message)
 
 	// Create mock consumer with the message
-	mockConsumer := newMockKafkaConsumer([][]byte{messageBytes})
+	mockConsumer := kafkatest.NewConsumer(kafkatest.Messages("test-topic", messageBytes)...)
 
 	// Create logger for testing
 	testLogger, _ := logger.New()
 
 	// Create service (using the same repository)
-	service := service.NewMessageService(mockRepo, mockProducer, mockConsumer, "test-topic", testLogger)
+	service := service.NewMessageService(repo, time.Hour, testLogger)
 
 	// Create handler
 	messageHandler := handler.NewMessageHandler(service, testLogger)
@@ -294,9 +235,7 @@ func TestEndToEndKafkaProcessingScenario(t *testing.T) {
 	// Setup routes with Gin
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.POST("/messages", messageHandler.CreateMessageHandler)
-	router.GET("/statistics", messageHandler.GetStatisticsHandler)
-	router.PUT("/messages/:id/process", messageHandler.ProcessMessageHandler)
+	registerRoutes(router, messageHandler)
 
 	// Simulate Kafka processing in a separate goroutine
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -309,7 +248,7 @@ func TestEndToEndKafkaProcessingScenario(t *testing.T) {
 			case <-ctx.Done():
 				return
 			default:
-				messageBytes, err := mockConsumer.ReadMessage(ctx, "test-topic")
+				delivery, err := mockConsumer.FetchMessage(ctx, "test-topic")
 				if err != nil {
 					if ctx.Err() != nil {
 						return
@@ -319,7 +258,7 @@ func TestEndToEndKafkaProcessingScenario(t *testing.T) {
 
 				// Decode message
 				var message model.Message
-				if err := json.Unmarshal(messageBytes, &message); err != nil {
+				if err := json.Unmarshal(delivery.Message().Value, &message); err != nil {
 					continue
 				}
 
@@ -348,6 +287,246 @@ func TestEndToEndKafkaProcessingScenario(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), response.TotalMessages)
 		assert.Equal(t, int64(1), response.ProcessedMessages)
-		assert.Equal(t, int64(0), response.UnprocessedMessages)
+		assert.Equal(t, int64(0), response.PendingMessages)
+	})
+}
+
+func TestEndToEndDeadLetterScenario(t *testing.T) {
+	repo := repository.NewMemoryMessageRepository()
+	mockProducer := &kafkatest.Producer{}
+
+	// An event that cannot be decoded is dead-lettered without being retried
+	mockConsumer := kafkatest.NewConsumer(kafkatest.Messages("test-topic", []byte("not json"))...)
+
+	testLogger, _ := logger.New()
+	messageService := service.NewMessageService(repo, time.Hour, testLogger)
+	deadLetters := dlq.NewPublisher(mockProducer, "test-topic.dlq")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	processor.New(messageService, mockConsumer, deadLetters, "test-topic", 1, retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 4, Retryable: retry.RepositoryRetryable}, time.Second, nil, testLogger).Run(ctx)
+
+	if sent := mockProducer.Sent(); assert.Len(t, sent, 1) {
+		assert.Equal(t, "test-topic.dlq", sent[0].Topic)
+		assert.Equal(t, []byte("not json"), sent[0].Value)
+		assert.Equal(t, "test-topic", sent[0].Headers[dlq.HeaderOriginalTopic])
+		assert.Equal(t, "0", sent[0].Headers[dlq.HeaderOriginalOffset])
+		assert.Equal(t, "1", sent[0].Headers[dlq.HeaderAttempts])
+		assert.Contains(t, sent[0].Headers[dlq.HeaderError], "failed to decode message")
+	}
+
+	// The offset is committed once the event is safely in the dead-letter topic
+	committed, nacked := mockConsumer.Settled()
+	assert.Equal(t, []int64{0}, committed)
+	assert.Empty(t, nacked)
+}
+
+func TestEndToEndCommitScenario(t *testing.T) {
+	repo := repository.NewMemoryMessageRepository()
+	createdMessage, err := repo.CreateMessage(context.Background(), "Test message")
+	assert.NoError(t, err)
+
+	processed, _ := json.Marshal(createdMessage)
+	missing, _ := json.Marshal(&model.Message{ID: 42, Content: "Missing message", Status: model.StatusPending})
+
+	testLogger, _ := logger.New()
+
+	// Test that processed and skipped events are committed
+	t.Run("CommitsHandledEvents", func(t *testing.T) {
+		mockProducer := &kafkatest.Producer{}
+		mockConsumer := kafkatest.NewConsumer(kafkatest.Messages("test-topic", processed, missing)...)
+		messageService := service.NewMessageService(repo, time.Hour, testLogger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		processor.New(messageService, mockConsumer, dlq.NewPublisher(mockProducer, "test-topic.dlq"), "test-topic", 1, retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 4, Retryable: retry.RepositoryRetryable}, time.Second, nil, testLogger).Run(ctx)
+
+		committed, nacked := mockConsumer.Settled()
+		assert.Equal(t, []int64{0, 1}, committed)
+		assert.Empty(t, nacked)
+		assert.Empty(t, mockProducer.Sent())
+	})
+
+	// Test that an event is left uncommitted when it cannot be dead-lettered
+	t.Run("NacksWhenDeadLetteringFails", func(t *testing.T) {
+		mockProducer := &kafkatest.Producer{Err: errors.New("kafka unavailable")}
+		mockConsumer := kafkatest.NewConsumer(kafkatest.Messages("test-topic", []byte("not json"))...)
+		messageService := service.NewMessageService(repo, time.Hour, testLogger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		processor.New(messageService, mockConsumer, dlq.NewPublisher(mockProducer, "test-topic.dlq"), "test-topic", 1, retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 4, Retryable: retry.RepositoryRetryable}, time.Second, nil, testLogger).Run(ctx)
+
+		committed, nacked := mockConsumer.Settled()
+		assert.Empty(t, committed)
+		assert.Equal(t, []int64{0}, nacked)
 	})
-}
\ No newline at end of file
+}
+
+func TestEndToEndIdempotentCreate(t *testing.T) {
+	router, repo, _, _ := setupEndToEndTestRouter()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(handler.IdempotencyKeyHeader, "retry-key")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The original request and its retry produce one message
+	first := post(`{"content": "Test message"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	retry := post(`{"content": "Test message"}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(handler.IdempotentReplayedHeader))
+	assertStoredMessages(t, repo, 1)
+
+	events, err := repo.ClaimOutboxEvents(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	// Reusing the key for a different message is a conflict
+	conflict := post(`{"content": "Different message"}`)
+	assert.Equal(t, http.StatusConflict, conflict.Code)
+	assertStoredMessages(t, repo, 1)
+}
+
+func TestEndToEndMemoryBrokerScenario(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	testLogger := &logger.Logger{Logger: zap.New(core)}
+	gin.SetMode(gin.TestMode)
+	exporter := tracingtest.Install(t)
+
+	cfg := &config.Config{
+		ServerPort:             "8080",
+		KafkaTopic:             "messages",
+		KafkaDLQTopic:          "messages.dlq",
+		KafkaWorkers:           2,
+		KafkaRetryDelayMs:      10,
+		KafkaRetryMaxDelayMs:   10,
+		KafkaMaxRetries:        3,
+		KafkaDrainTimeoutMs:    1000,
+		OutboxBatchSize:        10,
+		OutboxPollIntervalMs:   10,
+		OutboxRetryDelayMs:     10,
+		OutboxRetryMaxDelayMs:  10,
+		IdempotencyKeyTTLHours: 24,
+	}
+
+	broker := memorybroker.New(2, 100)
+	repo := repository.NewMemoryMessageRepository()
+	deps := dependencies{
+		repo:     repo,
+		producer: broker.NewProducer(),
+		newConsumer: func(topic, groupID string) interfaces.KafkaConsumer {
+			return broker.NewConsumer(topic, groupID)
+		},
+	}
+	a := newApp(modeAll, cfg, deps, metrics.New(), testLogger)
+
+	// Run the relay and the processor as runServer does
+	ctx, cancel := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	processorDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		a.relay.Run(ctx)
+	}()
+	go func() {
+		defer close(processorDone)
+		a.processor.Run(ctx)
+	}()
+
+	// Create messages through the API; the first request is part of a trace of the caller
+	// and carries its own request ID
+	var ids []int64
+	for i, content := range []string{"First message", "Second message", "Third message"} {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(`{"content": "`+content+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if i == 0 {
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			req.Header.Set(requestid.Header, "req-1")
+		}
+
+		rr := httptest.NewRecorder()
+		a.router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get(requestid.Header))
+
+		var response handler.CreateMessageResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		ids = append(ids, response.ID)
+	}
+
+	// The relay publishes the outbox events and the processor consumes and processes them
+	assert.Eventually(t, func() bool {
+		stats, err := repo.GetStatistics(context.Background())
+		return err == nil && stats.ProcessedMessages == int64(len(ids))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, id := range ids {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/messages/%d", id), nil)
+		rr := httptest.NewRecorder()
+		a.router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var message model.Message
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &message))
+		assert.Equal(t, model.StatusProcessed, message.Status)
+	}
+
+	cancel()
+	<-relayDone
+	<-processorDone
+	assert.NoError(t, a.consumer.Close())
+
+	// The processed events were committed, so the group has nothing left to read
+	consumer := broker.NewConsumer(cfg.KafkaTopic, "message-processor-group")
+	defer func() {
+		_ = consumer.Close()
+	}()
+	fetchCtx, cancelFetch := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelFetch()
+	_, err := consumer.FetchMessage(fetchCtx, cfg.KafkaTopic)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The processing of the first message joined the trace of the request that created it
+	var request, processing []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			continue
+		}
+		switch span.Name {
+		case "POST /messages":
+			request = append(request, span)
+		case cfg.KafkaTopic + " process":
+			processing = append(processing, span)
+		}
+	}
+	if assert.Len(t, request, 1) && assert.Len(t, processing, 1) {
+		assert.Equal(t, request[0].SpanContext.SpanID(), processing[0].Parent.SpanID())
+	}
+
+	// The logs of the request and of the processing of its event share its request ID
+	correlated := logs.FilterField(zap.String("request_id", "req-1"))
+	assert.Equal(t, 1, correlated.FilterMessage("Creating new message").Len())
+	assert.Equal(t, 1, correlated.FilterMessage("Processing Kafka message").Len())
+}
+
+// assertStoredMessages checks how many messages the repository holds
+func assertStoredMessages(t *testing.T, repo *repository.MemoryMessageRepository, expected int64) {
+	t.Helper()
+
+	stats, err := repo.GetStatistics(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, stats.TotalMessages)
+	}
+}
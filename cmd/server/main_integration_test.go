@@ -19,9 +19,12 @@ import (
 
 // Mock implementations for integration testing
 type mockMessageService struct {
-	createMessageFunc  func(ctx context.Context, content string) (int64, error)
-	processMessageFunc func(ctx context.Context, id int64) error
-	getStatisticsFunc  func(ctx context.Context) (*model.Statistics, error)
+	createMessageFunc    func(ctx context.Context, content string) (int64, error)
+	createIdempotentFunc func(ctx context.Context, content, key string) (int64, bool, error)
+	processMessageFunc   func(ctx context.Context, id int64) error
+	getMessageFunc       func(ctx context.Context, id int64) (*model.Message, error)
+	listMessagesFunc     func(ctx context.Context, filter model.MessageFilter) (*model.MessagePage, error)
+	getStatisticsFunc    func(ctx context.Context) (*model.Statistics, error)
 }
 
 func (m *mockMessageService) CreateMessage(ctx context.Context, content string) (int64, error) {
@@ -31,6 +34,13 @@ func (m *mockMessageService) CreateMessage(ctx context.Context, content string)
 	return 0, nil
 }
 
+func (m *mockMessageService) CreateMessageIdempotent(ctx context.Context, content, key string) (int64, bool, error) {
+	if m.createIdempotentFunc != nil {
+		return m.createIdempotentFunc(ctx, content, key)
+	}
+	return 0, false, nil
+}
+
 func (m *mockMessageService) ProcessMessage(ctx context.Context, id int64) error {
 	if m.processMessageFunc != nil {
 		return m.processMessageFunc(ctx, id)
@@ -38,6 +48,28 @@ func (m *mockMessageService) ProcessMessage(ctx context.Context, id int64) error
 	return nil
 }
 
+func (m *mockMessageService) FailMessage(_ context.Context, _ int64, _ string) error {
+	return nil
+}
+
+func (m *mockMessageService) DeadLetterMessage(_ context.Context, _ int64, _ string) error {
+	return nil
+}
+
+func (m *mockMessageService) GetMessage(ctx context.Context, id int64) (*model.Message, error) {
+	if m.getMessageFunc != nil {
+		return m.getMessageFunc(ctx, id)
+	}
+	return &model.Message{ID: id}, nil
+}
+
+func (m *mockMessageService) ListMessages(ctx context.Context, filter model.MessageFilter) (*model.MessagePage, error) {
+	if m.listMessagesFunc != nil {
+		return m.listMessagesFunc(ctx, filter)
+	}
+	return &model.MessagePage{}, nil
+}
+
 func (m *mockMessageService) GetStatistics(ctx context.Context) (*model.Statistics, error) {
 	if m.getStatisticsFunc != nil {
 		return m.getStatisticsFunc(ctx)
@@ -56,9 +88,9 @@ func setupTestRouter() *gin.Engine {
 		},
 		getStatisticsFunc: func(_ context.Context) (*model.Statistics, error) {
 			return &model.Statistics{
-				TotalMessages:       10,
-				ProcessedMessages:   7,
-				UnprocessedMessages: 3,
+				TotalMessages:     10,
+				PendingMessages:   3,
+				ProcessedMessages: 7,
 			}, nil
 		},
 	}
@@ -72,9 +104,7 @@ func setupTestRouter() *gin.Engine {
 	// Setup routes with Gin
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.POST("/messages", messageHandler.CreateMessageHandler)
-	router.GET("/statistics", messageHandler.GetStatisticsHandler)
-	router.PUT("/messages/:id/process", messageHandler.ProcessMessageHandler)
+	registerRoutes(router, messageHandler)
 
 	return router
 }
@@ -113,7 +143,7 @@ func TestServerIntegration(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, int64(10), response.TotalMessages)
 		assert.Equal(t, int64(7), response.ProcessedMessages)
-		assert.Equal(t, int64(3), response.UnprocessedMessages)
+		assert.Equal(t, int64(3), response.PendingMessages)
 	})
 
 	// Test processing a message
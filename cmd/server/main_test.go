@@ -1,8 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"httpchat/internal/config"
+	"httpchat/internal/interfaces"
+	"httpchat/internal/kafka"
+	"httpchat/internal/kafka/kafkatest"
+	"httpchat/internal/lifecycle"
+	"httpchat/internal/logger"
+	"httpchat/internal/metrics"
+	"httpchat/internal/migration"
+	"httpchat/internal/outbox"
+	"httpchat/internal/repository"
+	"httpchat/internal/retry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetEnv(t *testing.T) {
@@ -55,3 +77,305 @@ func TestGetEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestNewAppRunModes(t *testing.T) {
+	testLogger, _ := logger.New()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		ServerPort:             "8080",
+		WorkerPort:             "8081",
+		AdminToken:             "secret",
+		KafkaTopic:             "messages",
+		KafkaDLQTopic:          "messages.dlq",
+		KafkaWorkers:           1,
+		IdempotencyKeyTTLHours: 24,
+	}
+
+	tests := []struct {
+		mode          string
+		addr          string
+		routes        []string
+		missingRoutes []string
+		relay         bool
+		processor     bool
+		checks        []string
+	}{
+		{
+			mode:      modeAll,
+			addr:      ":8080",
+			routes:    []string{"GET /healthz", "GET /readyz", "GET /metrics", "POST /messages", "POST /admin/dlq/replay"},
+			relay:     true,
+			processor: true,
+			checks:    []string{"broker", "processor"},
+		},
+		{
+			mode:   modeAPI,
+			addr:   ":8080",
+			routes: []string{"GET /healthz", "GET /readyz", "GET /metrics", "POST /messages", "POST /admin/dlq/replay"},
+			relay:  true,
+			checks: []string{"broker"},
+		},
+		{
+			mode:          modeWorker,
+			addr:          ":8081",
+			routes:        []string{"GET /healthz", "GET /readyz", "GET /metrics"},
+			missingRoutes: []string{"POST /messages", "GET /statistics", "POST /admin/dlq/replay"},
+			processor:     true,
+			checks:        []string{"broker", "processor"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var openedTopics []string
+			deps := dependencies{
+				repo:     repository.NewMemoryMessageRepository(),
+				producer: &kafkatest.Producer{},
+				newConsumer: func(topic, _ string) interfaces.KafkaConsumer {
+					openedTopics = append(openedTopics, topic)
+					return kafkatest.NewConsumer()
+				},
+				checkBroker: func(context.Context) error { return nil },
+			}
+
+			a := newApp(tt.mode, cfg, deps, metrics.New(), testLogger)
+
+			routes := make(map[string]bool)
+			for _, route := range a.router.Routes() {
+				routes[route.Method+" "+route.Path] = true
+			}
+			for _, route := range tt.routes {
+				assert.True(t, routes[route], "expected route %s", route)
+			}
+			for _, route := range tt.missingRoutes {
+				assert.False(t, routes[route], "unexpected route %s", route)
+			}
+
+			assert.Equal(t, tt.addr, a.addr)
+			assert.Equal(t, tt.relay, a.relay != nil)
+			assert.Equal(t, tt.relay, a.sweeper != nil)
+			assert.Equal(t, tt.processor, a.processor != nil)
+
+			// Readiness checks what the run mode depends on; the memory storage has nothing to check
+			var checks []string
+			for name := range a.readiness.Check(context.Background()).Checks {
+				checks = append(checks, name)
+			}
+			assert.ElementsMatch(t, tt.checks, checks)
+
+			// Only the processor opens a Kafka reader while wiring; the API never does
+			if tt.processor {
+				assert.Equal(t, []string{"messages"}, openedTopics)
+				assert.NotNil(t, a.consumer)
+			} else {
+				assert.Empty(t, openedTopics)
+				assert.Nil(t, a.consumer)
+			}
+		})
+	}
+}
+
+// stopRecorder records the order in which the components of an app stop
+type stopRecorder struct {
+	mu      sync.Mutex
+	stopped []string
+}
+
+func (r *stopRecorder) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = append(r.stopped, name)
+}
+
+func (r *stopRecorder) order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.stopped...)
+}
+
+type recordingProducer struct {
+	*kafkatest.Producer
+	recorder *stopRecorder
+}
+
+func (p *recordingProducer) Close() error {
+	p.recorder.record("producer")
+	return nil
+}
+
+type recordingConsumer struct {
+	*kafkatest.Consumer
+	recorder *stopRecorder
+}
+
+func (c *recordingConsumer) Close() error {
+	c.recorder.record("consumer")
+	return nil
+}
+
+type recordingStore struct {
+	*repository.MemoryMessageRepository
+	recorder *stopRecorder
+}
+
+func (s *recordingStore) Close() error {
+	s.recorder.record("database")
+	return nil
+}
+
+func TestShutdownPhasesOrder(t *testing.T) {
+	testLogger, _ := logger.New()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		ServerPort:                   "8080",
+		KafkaTopic:                   "messages",
+		KafkaDLQTopic:                "messages.dlq",
+		KafkaWorkers:                 1,
+		KafkaDrainTimeoutMs:          1000,
+		OutboxBatchSize:              10,
+		OutboxPollIntervalMs:         10,
+		IdempotencyKeyTTLHours:       24,
+		IdempotencyCleanupIntervalMs: 1000,
+		ShutdownHTTPTimeoutMs:        1000,
+		ShutdownBackgroundTimeoutMs:  1000,
+		ShutdownCloseTimeoutMs:       1000,
+	}
+
+	recorder := &stopRecorder{}
+	deps := dependencies{
+		repo:     &recordingStore{MemoryMessageRepository: repository.NewMemoryMessageRepository(), recorder: recorder},
+		producer: &recordingProducer{Producer: &kafkatest.Producer{}, recorder: recorder},
+		newConsumer: func(string, string) interfaces.KafkaConsumer {
+			return &recordingConsumer{Consumer: kafkatest.NewConsumer(), recorder: recorder}
+		},
+	}
+	a := newApp(modeAll, cfg, deps, metrics.New(), testLogger)
+
+	// A request that is still running when the shutdown starts
+	entered := make(chan struct{})
+	a.router.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		time.Sleep(100 * time.Millisecond)
+		recorder.record("request")
+		c.Status(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := &http.Server{Handler: a.router, ReadHeaderTimeout: time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	a.startBackground(cfg, testLogger)
+
+	url := "http://" + listener.Addr().String()
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-entered
+
+	flushTraces := func(context.Context) error {
+		recorder.record("traces")
+		return nil
+	}
+	err = lifecycle.Shutdown(a.shutdownPhases(cfg, server, deps, flushTraces), testLogger)
+	assert.NoError(t, err)
+
+	// The in-flight request completes before the processor stops and the connections close
+	assert.Equal(t, http.StatusOK, <-status)
+	assert.Equal(t, []string{"request", "consumer", "producer", "database", "traces"}, recorder.order())
+	assert.Error(t, a.processor.Check(context.Background()))
+
+	// New requests are refused
+	_, err = http.Get(url + "/healthz")
+	assert.Error(t, err)
+}
+
+func TestPrintMigrationStatus(t *testing.T) {
+	appliedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	err := printMigrationStatus(&out, []migration.Status{
+		{Version: 1, Name: "create_messages", AppliedAt: &appliedAt},
+		{Version: 2, Name: "create_outbox"},
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{"0001", "create_messages", "2024-01-01T12:00:00Z"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"0002", "create_outbox", "pending"}, strings.Fields(lines[2]))
+	}
+}
+
+// outboxRecorder records which outbox events the relay marks as sent
+type outboxRecorder struct {
+	*repository.MemoryMessageRepository
+	mu     sync.Mutex
+	sent   []int64
+	failed []int64
+}
+
+func (r *outboxRecorder) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	r.sent = append(r.sent, id)
+	r.mu.Unlock()
+	return r.MemoryMessageRepository.MarkOutboxEventSent(ctx, id)
+}
+
+func (r *outboxRecorder) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	r.mu.Lock()
+	r.failed = append(r.failed, id)
+	r.mu.Unlock()
+	return r.MemoryMessageRepository.MarkOutboxEventFailed(ctx, id, reason, retryAfter)
+}
+
+func TestProducerWaitsForDeliveryWhenAsyncIsConfigured(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	cfg := &config.Config{
+		KafkaProducerBatchSize:      100,
+		KafkaProducerBatchTimeoutMs: 10,
+		KafkaProducerRequiredAcks:   "all",
+		KafkaProducerCompression:    "none",
+		KafkaProducerBalancer:       "murmur2",
+		KafkaProducerAsync:          true,
+	}
+	producerConfig := newProducerConfig(cfg, testLogger)
+	assert.False(t, producerConfig.Async)
+
+	// Nothing listens on the broker address, so the event cannot be delivered
+	producer, err := kafka.NewProducer([]string{"127.0.0.1:1"}, producerConfig, kafka.SecurityConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		_ = producer.Close()
+	}()
+
+	repo := &outboxRecorder{MemoryMessageRepository: repository.NewMemoryMessageRepository()}
+	_, err = repo.CreateMessage(context.Background(), "hello")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	relay := outbox.NewRelay(repo, producer, "messages", 10, time.Second, retry.Policy{InitialInterval: time.Second}, testLogger)
+	claimed, err := relay.RelayPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+
+	// The failed delivery leaves the event in the outbox to be published again
+	assert.Empty(t, repo.sent)
+	assert.Len(t, repo.failed, 1)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"httpchat/internal/config"
+	"httpchat/internal/logger"
+	"httpchat/internal/migration"
+	"httpchat/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// runMigrate implements the migrate command: "migrate up", "migrate down [-steps N]" and "migrate status"
+func runMigrate(args []string, cfg *config.Config, appLogger *logger.Logger) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	if repository.IsSQLiteURL(cfg.DatabaseURL) {
+		return errors.New("migrate supports PostgreSQL only, SQLite creates its schema on startup")
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert (down only)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	migrator, err := migration.New(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		appLogger.Info("Applied migrations", zap.Int("count", applied), zap.Int("latest", migrator.Latest()))
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		appLogger.Info("Reverted migrations", zap.Int("count", reverted))
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return printMigrationStatus(os.Stdout, statuses)
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q", args[0])
+	}
+}
+
+// printMigrationStatus writes one line per migration with the time it was applied
+func printMigrationStatus(w io.Writer, statuses []migration.Status) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(tw, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,241 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/kafka/kafkatest"
+	"httpchat/internal/logger"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockMessageRepository records status updates
+type mockMessageRepository struct {
+	updates map[int64]model.MessageStatus
+	err     error
+}
+
+func (m *mockMessageRepository) CreateMessage(_ context.Context, _ string) (*model.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageRepository) CreateMessageIdempotent(_ context.Context, _, _, _ string, _ time.Duration) (*model.Message, bool, error) {
+	return nil, false, nil
+}
+
+func (m *mockMessageRepository) GetMessageByID(_ context.Context, _ int64) (*model.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageRepository) UpdateMessageStatus(_ context.Context, id int64, status model.MessageStatus, _ string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.updates[id] = status
+	return nil
+}
+
+func (m *mockMessageRepository) ListMessages(_ context.Context, _ model.MessageFilter) ([]*model.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageRepository) GetStatistics(_ context.Context) (*model.Statistics, error) {
+	return nil, nil
+}
+
+// Ensure mockMessageRepository implements interfaces.MessageRepository
+var _ interfaces.MessageRepository = (*mockMessageRepository)(nil)
+
+func TestPublisherPublish(t *testing.T) {
+	producer := &kafkatest.Producer{}
+	publisher := NewPublisher(producer, "messages.dlq")
+
+	message := &model.KafkaMessage{
+		Topic:     "messages",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("7"),
+		Value:     []byte(`{"id":7}`),
+		Headers:   map[string]string{model.HeaderCorrelationID: "abc"},
+	}
+	err := publisher.Publish(context.Background(), message, errors.New("database unavailable"), 4)
+	assert.NoError(t, err)
+
+	if sent := producer.Sent(); assert.Len(t, sent, 1) {
+		sent := sent[0]
+		assert.Equal(t, "messages.dlq", sent.Topic)
+		assert.Equal(t, message.Key, sent.Key)
+		assert.Equal(t, message.Value, sent.Value)
+		assert.Equal(t, "abc", sent.Headers[model.HeaderCorrelationID])
+		assert.Equal(t, "messages", sent.Headers[HeaderOriginalTopic])
+		assert.Equal(t, "3", sent.Headers[HeaderOriginalPartition])
+		assert.Equal(t, "42", sent.Headers[HeaderOriginalOffset])
+		assert.Equal(t, "database unavailable", sent.Headers[HeaderError])
+		assert.Equal(t, "4", sent.Headers[HeaderAttempts])
+		_, err := time.Parse(time.RFC3339Nano, sent.Headers[HeaderDeadLetteredAt])
+		assert.NoError(t, err)
+	}
+
+	// Test that producer errors are returned
+	producer.Err = errors.New("kafka write error")
+	err = publisher.Publish(context.Background(), message, errors.New("boom"), 1)
+	assert.Error(t, err)
+}
+
+func TestReplayerReplay(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	newEntry := func(id int64) *model.KafkaMessage {
+		envelope, _ := model.NewMessageCreatedEvent(&model.Message{ID: id}, time.Now())
+		payload, _ := envelope.Encode()
+		headers := envelope.Headers()
+		headers[HeaderOriginalOffset] = strconv.FormatInt(id, 10)
+		return &model.KafkaMessage{
+			Topic:   "messages.dlq",
+			Key:     model.MessageEventKey(id),
+			Value:   payload,
+			Headers: headers,
+		}
+	}
+
+	// legacyEntry is an event from before the envelope, which is the bare message
+	legacyEntry := func(id int64) *model.KafkaMessage {
+		payload, _ := json.Marshal(model.Message{ID: id})
+		return &model.KafkaMessage{
+			Topic:   "messages.dlq",
+			Value:   payload,
+			Headers: map[string]string{HeaderOriginalOffset: strconv.FormatInt(id, 10)},
+		}
+	}
+
+	// Test that entries are requeued and republished until the topic is drained
+	t.Run("ReplaysUntilIdle", func(t *testing.T) {
+		first := newEntry(1)
+		consumer := kafkatest.NewConsumer(first, legacyEntry(2))
+		producer := &kafkatest.Producer{}
+		repo := &mockMessageRepository{updates: make(map[int64]model.MessageStatus)}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.idleTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, replayed)
+		assert.True(t, consumer.Closed())
+		committed, _ := consumer.Settled()
+		assert.Len(t, committed, 2)
+		assert.Equal(t, map[int64]model.MessageStatus{1: model.StatusPending, 2: model.StatusPending}, repo.updates)
+		if sent := producer.Sent(); assert.Len(t, sent, 2) {
+			// The event keeps its key and headers but loses the dead-letter headers
+			assert.Equal(t, "messages", sent[0].Topic)
+			assert.Equal(t, first.Key, sent[0].Key)
+			assert.Equal(t, first.Headers[model.HeaderCorrelationID], sent[0].Headers[model.HeaderCorrelationID])
+			assert.NotContains(t, sent[0].Headers, HeaderOriginalOffset)
+			assert.NotEmpty(t, sent[0].Headers[HeaderReplayedAt])
+		}
+	})
+
+	// Test that a slow group join does not count against the idle timeout
+	t.Run("WaitsForGroupJoin", func(t *testing.T) {
+		consumer := kafkatest.NewConsumer(newEntry(1), newEntry(2))
+		consumer.JoinDelay = 50 * time.Millisecond
+		producer := &kafkatest.Producer{}
+		repo := &mockMessageRepository{updates: make(map[int64]model.MessageStatus)}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.idleTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, replayed)
+	})
+
+	// Test that an empty topic is reported as drained once the start timeout expires
+	t.Run("StopsWhenNothingArrives", func(t *testing.T) {
+		consumer := kafkatest.NewConsumer()
+		producer := &kafkatest.Producer{}
+		repo := &mockMessageRepository{updates: make(map[int64]model.MessageStatus)}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.startTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, replayed)
+	})
+
+	// Test that the limit caps the number of replayed entries
+	t.Run("RespectsLimit", func(t *testing.T) {
+		consumer := kafkatest.NewConsumer(newEntry(1), newEntry(2), newEntry(3))
+		producer := &kafkatest.Producer{}
+		repo := &mockMessageRepository{updates: make(map[int64]model.MessageStatus)}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.idleTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, replayed)
+		assert.Equal(t, 1, consumer.Remaining())
+	})
+
+	// Test that a message that is no longer dead-lettered is still republished
+	t.Run("IgnoresInvalidTransition", func(t *testing.T) {
+		consumer := kafkatest.NewConsumer(newEntry(1))
+		producer := &kafkatest.Producer{}
+		repo := &mockMessageRepository{
+			err: repositoryerr.New(repositoryerr.ErrorCodeInvalidStatusTransition, "UpdateMessageStatus", repositoryerr.ErrInvalidStatusTransition),
+		}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.idleTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+		assert.Len(t, producer.Sent(), 1)
+	})
+
+	// Test that a database failure stops the replay
+	t.Run("StopsOnRepositoryError", func(t *testing.T) {
+		consumer := kafkatest.NewConsumer(newEntry(1))
+		producer := &kafkatest.Producer{}
+		repo := &mockMessageRepository{err: errors.New("database error")}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.idleTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 10)
+		assert.Error(t, err)
+		assert.Equal(t, 0, replayed)
+		assert.Empty(t, producer.Sent())
+		committed, nacked := consumer.Settled()
+		assert.Empty(t, committed)
+		assert.Len(t, nacked, 1)
+	})
+
+	// Test that an entry is not committed when it cannot be republished
+	t.Run("NacksOnPublishError", func(t *testing.T) {
+		consumer := kafkatest.NewConsumer(newEntry(1))
+		producer := &kafkatest.Producer{Err: errors.New("kafka write error")}
+		repo := &mockMessageRepository{updates: make(map[int64]model.MessageStatus)}
+
+		replayer := NewReplayer(func() interfaces.KafkaConsumer { return consumer }, producer, repo, "messages.dlq", "messages", testLogger)
+		replayer.idleTimeout = 10 * time.Millisecond
+
+		replayed, err := replayer.Replay(context.Background(), 10)
+		assert.Error(t, err)
+		assert.Equal(t, 0, replayed)
+		committed, nacked := consumer.Settled()
+		assert.Empty(t, committed)
+		assert.Len(t, nacked, 1)
+	})
+}
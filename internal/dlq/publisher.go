@@ -0,0 +1,69 @@
+// Package dlq provides publishing and replaying of dead-lettered Kafka events.
+package dlq
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+)
+
+// Headers attached to every event published to the dead-letter topic
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderAttempts          = "x-attempts"
+	HeaderDeadLetteredAt    = "x-dead-lettered-at"
+	HeaderReplayedAt        = "x-replayed-at"
+)
+
+// deadLetterHeaders are the headers added by Publish, which a replay removes again
+var deadLetterHeaders = []string{
+	HeaderOriginalTopic,
+	HeaderOriginalPartition,
+	HeaderOriginalOffset,
+	HeaderError,
+	HeaderAttempts,
+	HeaderDeadLetteredAt,
+}
+
+// Publisher sends events that could not be processed to the dead-letter topic
+type Publisher struct {
+	producer interfaces.KafkaProducer
+	topic    string
+}
+
+// NewPublisher creates a new Publisher instance
+func NewPublisher(producer interfaces.KafkaProducer, topic string) *Publisher {
+	return &Publisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// Publish sends the original event with its key and headers to the dead-letter topic. The
+// added headers record where the event came from, why it failed and after how many
+// processing attempts.
+func (p *Publisher) Publish(ctx context.Context, message *model.KafkaMessage, cause error, attempts int) error {
+	headers := make(map[string]string, len(message.Headers)+6)
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+	headers[HeaderOriginalTopic] = message.Topic
+	headers[HeaderOriginalPartition] = strconv.Itoa(message.Partition)
+	headers[HeaderOriginalOffset] = strconv.FormatInt(message.Offset, 10)
+	headers[HeaderError] = cause.Error()
+	headers[HeaderAttempts] = strconv.Itoa(attempts)
+	headers[HeaderDeadLetteredAt] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if err := p.producer.SendMessageWithKey(ctx, p.topic, message.Key, message.Value, headers); err != nil {
+		return fmt.Errorf("failed to publish to dead-letter topic %s: %w", p.topic, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultStartTimeout is how long a replay waits for its first dead-lettered event.
+	// It covers the consumer group join and partition assignment, which take several
+	// seconds before the first fetch can return anything.
+	defaultStartTimeout = 30 * time.Second
+
+	// defaultIdleTimeout is how long a replay waits for the next dead-lettered event
+	// before it assumes the topic has been drained
+	defaultIdleTimeout = 5 * time.Second
+)
+
+// Replayer moves dead-lettered events back onto the main topic.
+// A fresh consumer is opened for every replay so that the dead-letter topic is only
+// read while a replay is running.
+type Replayer struct {
+	newConsumer  func() interfaces.KafkaConsumer
+	producer     interfaces.KafkaProducer
+	repo         interfaces.MessageRepository
+	dlqTopic     string
+	topic        string
+	startTimeout time.Duration
+	idleTimeout  time.Duration
+	logger       *logger.Logger
+
+	// mu serializes replays, which share the dead-letter consumer group
+	mu sync.Mutex
+}
+
+// NewReplayer creates a new Replayer instance
+func NewReplayer(
+	newConsumer func() interfaces.KafkaConsumer,
+	producer interfaces.KafkaProducer,
+	repo interfaces.MessageRepository,
+	dlqTopic string,
+	topic string,
+	logger *logger.Logger,
+) *Replayer {
+	return &Replayer{
+		newConsumer:  newConsumer,
+		producer:     producer,
+		repo:         repo,
+		dlqTopic:     dlqTopic,
+		topic:        topic,
+		startTimeout: defaultStartTimeout,
+		idleTimeout:  defaultIdleTimeout,
+		logger:       logger,
+	}
+}
+
+// Ensure Replayer implements interfaces.DeadLetterReplayer
+var _ interfaces.DeadLetterReplayer = (*Replayer)(nil)
+
+// Replay republishes up to limit dead-lettered events to the main topic and returns
+// how many were replayed. It stops early once no event arrives within the idle timeout;
+// the idle timeout only applies after the first fetch, which gets the start timeout instead.
+func (r *Replayer) Replay(ctx context.Context, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	consumer := r.newConsumer()
+	defer func() {
+		if err := consumer.Close(); err != nil {
+			r.logger.Error("Error closing dead-letter consumer", zap.Error(err))
+		}
+	}()
+
+	replayed := 0
+	timeout := r.startTimeout
+	for replayed < limit {
+		readCtx, cancel := context.WithTimeout(ctx, timeout)
+		delivery, err := consumer.FetchMessage(readCtx, r.dlqTopic)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return replayed, ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				// Nothing more to replay
+				break
+			}
+			return replayed, fmt.Errorf("failed to read dead-lettered event: %w", err)
+		}
+		// The consumer has joined its group, so the next fetch either returns quickly or the topic is drained
+		timeout = r.idleTimeout
+
+		if err := r.replayEntry(ctx, delivery.Message()); err != nil {
+			// Keep the entry in the dead-letter topic so that a later replay picks it up
+			if nackErr := delivery.Nack(ctx); nackErr != nil {
+				r.logger.Error("Failed to nack dead-lettered event", zap.Error(nackErr))
+			}
+			return replayed, err
+		}
+		replayed++
+
+		// The entry is only removed from the dead-letter topic once it is back on the main topic
+		if err := delivery.Commit(ctx); err != nil {
+			return replayed, fmt.Errorf("failed to commit dead-lettered event: %w", err)
+		}
+	}
+
+	r.logger.Info("Replayed dead-lettered events", zap.Int("count", replayed), zap.String("topic", r.topic))
+
+	return replayed, nil
+}
+
+// replayEntry resets the message status and republishes a single dead-lettered event
+func (r *Replayer) replayEntry(ctx context.Context, entry *model.KafkaMessage) error {
+	// Events that never decoded carry no message ID; they are republished as-is
+	var message model.Message
+	if envelope, err := model.DecodeEvent(entry.Value); err == nil {
+		if decoded, err := envelope.Message(); err == nil {
+			message = *decoded
+		}
+	}
+	if message.ID > 0 {
+		// A dead-lettered message cannot be processed again until it is back in pending
+		if err := r.repo.UpdateMessageStatus(ctx, message.ID, model.StatusPending, ""); err != nil {
+			var repoErr *repositoryerr.RepositoryError
+			if !errors.As(err, &repoErr) ||
+				(repoErr.ErrorCode() != repositoryerr.ErrorCodeMessageNotFound &&
+					repoErr.ErrorCode() != repositoryerr.ErrorCodeInvalidStatusTransition) {
+				return fmt.Errorf("failed to requeue message %d: %w", message.ID, err)
+			}
+			r.logger.Warn("Replaying event without requeuing its message",
+				zap.Int64("id", message.ID),
+				zap.Error(err))
+		}
+	}
+
+	// The event goes back with its own key and headers
+	headers := make(map[string]string, len(entry.Headers)+1)
+	for key, value := range entry.Headers {
+		headers[key] = value
+	}
+	for _, key := range deadLetterHeaders {
+		delete(headers, key)
+	}
+	headers[HeaderReplayedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	if err := r.producer.SendMessageWithKey(ctx, r.topic, entry.Key, entry.Value, headers); err != nil {
+		return fmt.Errorf("failed to republish dead-lettered event: %w", err)
+	}
+
+	r.logger.Info("Replayed dead-lettered event",
+		zap.Int64("id", message.ID),
+		zap.String("original_offset", entry.Headers[HeaderOriginalOffset]))
+
+	return nil
+}
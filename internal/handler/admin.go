@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+	"httpchat/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AdminHandler handles operational HTTP requests
+type AdminHandler struct {
+	replayer  interfaces.DeadLetterReplayer
+	logger    *logger.Logger
+	validator validation.MessageValidator
+}
+
+// ReplayDeadLettersResponse represents the response body for a dead-letter replay
+type ReplayDeadLettersResponse struct {
+	Replayed int `json:"replayed" example:"3"`
+}
+
+// defaultReplayLimit is the number of events replayed when the client does not pass a limit
+const defaultReplayLimit = 100
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(replayer interfaces.DeadLetterReplayer, logger *logger.Logger) *AdminHandler {
+	return &AdminHandler{
+		replayer:  replayer,
+		logger:    logger,
+		validator: *validation.NewMessageValidator(1000), // Only the limit checks are used here
+	}
+}
+
+// RequireAdminToken rejects requests that do not carry the admin token as a bearer token
+func (h *AdminHandler) RequireAdminToken(token string) gin.HandlerFunc {
+	expected := []byte(token)
+	return func(c *gin.Context) {
+		presented, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), expected) != 1 {
+			h.logger.FromContext(c.Request.Context()).Warn("Rejected admin request without a valid token", zap.String("path", c.Request.URL.Path))
+			respondError(c, newHTTPError(http.StatusUnauthorized, ErrorCodeUnauthorized, "Unauthorized"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// ReplayDeadLettersHandler republishes dead-lettered events to the main topic
+// @Summary Replay dead-lettered events
+// @Description Moves events from the dead-letter topic back onto the main topic and resets their messages to pending
+// @Tags admin
+// @Produce  json
+// @Param limit query int false "Maximum number of events to replay (1-1000)" default(100)
+// @Param Authorization header string true "Bearer ADMIN_TOKEN"
+// @Success 200 {object} handler.ReplayDeadLettersResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /admin/dlq/replay [post]
+func (h *AdminHandler) ReplayDeadLettersHandler(c *gin.Context) {
+	log := h.logger.FromContext(c.Request.Context())
+
+	// Step 1: Parse and validate the replay limit
+	limit := defaultReplayLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			log.Warn("Invalid replay limit format", zap.String("limit", limitStr), zap.Error(err))
+			respondError(c, fieldError("limit", validation.ValidationErrorCodeInvalidLimit, "Invalid limit"))
+			return
+		}
+		limit = parsed
+	}
+	if err := h.validator.ValidateReplayLimit(limit); err != nil {
+		log.Warn("Invalid replay limit value", zap.Int("limit", limit))
+		respondError(c, validationError("limit", err, "Invalid limit (must be between 1 and "+strconv.Itoa(validation.MaxReplayLimit)+")"))
+		return
+	}
+
+	log.Info("Replaying dead-lettered events", zap.Int("limit", limit))
+
+	// Step 2: Replay the events
+	replayed, err := h.replayer.Replay(c.Request.Context(), limit)
+	if err != nil {
+		log.Error("Failed to replay dead-lettered events", zap.Int("replayed", replayed), zap.Error(err))
+		respondError(c, newHTTPError(http.StatusInternalServerError, ErrorCodeReplayFailed, "Failed to replay dead-lettered events"))
+		return
+	}
+
+	log.Info("Successfully replayed dead-lettered events", zap.Int("replayed", replayed))
+
+	// Step 3: Report how many events were replayed
+	c.JSON(http.StatusOK, ReplayDeadLettersResponse{Replayed: replayed})
+}
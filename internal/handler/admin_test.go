@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockDeadLetterReplayer implements interfaces.DeadLetterReplayer for testing
+type mockDeadLetterReplayer struct {
+	replayFunc func(ctx context.Context, limit int) (int, error)
+}
+
+func (m *mockDeadLetterReplayer) Replay(ctx context.Context, limit int) (int, error) {
+	if m.replayFunc != nil {
+		return m.replayFunc(ctx, limit)
+	}
+	return 0, nil
+}
+
+// Ensure mockDeadLetterReplayer implements interfaces.DeadLetterReplayer
+var _ interfaces.DeadLetterReplayer = (*mockDeadLetterReplayer)(nil)
+
+func TestReplayDeadLettersHandler(t *testing.T) {
+	var receivedLimit int
+
+	// Create a mock replayer that fails for a sentinel limit
+	replayer := &mockDeadLetterReplayer{
+		replayFunc: func(_ context.Context, limit int) (int, error) {
+			receivedLimit = limit
+			if limit == 13 {
+				return 2, errors.New("kafka read error")
+			}
+			return 3, nil
+		},
+	}
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Create handler with mock replayer
+	handler := NewAdminHandler(replayer, testLogger)
+
+	// Setup router
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/dlq/replay", handler.RequireAdminToken("secret"), handler.ReplayDeadLettersHandler)
+
+	post := func(query, authorization string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/admin/dlq/replay"+query, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test that requests without the admin token are rejected before replaying
+	for name, authorization := range map[string]string{
+		"MissingToken": "",
+		"WrongToken":   "Bearer guess",
+		"WrongScheme":  "Basic secret",
+	} {
+		t.Run(name, func(t *testing.T) {
+			receivedLimit = 0
+
+			rr := post("", authorization)
+
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Zero(t, receivedLimit)
+
+			var response ErrorResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, ErrorCodeUnauthorized, response.Code)
+		})
+	}
+
+	// Test replay with the default limit
+	t.Run("DefaultLimit", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/admin/dlq/replay", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, defaultReplayLimit, receivedLimit)
+
+		var response ReplayDeadLettersResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, response.Replayed)
+	})
+
+	// Test replay failure
+	t.Run("ReplayError", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/admin/dlq/replay?limit=13", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+		var response ErrorResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, ErrorCodeReplayFailed, response.Code)
+	})
+
+	// Test invalid limits
+	for name, query := range map[string]string{
+		"InvalidLimitFormat": "limit=abc",
+		"ZeroLimit":          "limit=0",
+		"LimitTooLarge":      "limit=1001",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/admin/dlq/replay?"+query, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
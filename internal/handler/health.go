@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"httpchat/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler handles health check requests
+type HealthHandler struct {
+	readiness *health.Checker
+}
+
+// HealthResponse represents the response body of a health check
+type HealthResponse struct {
+	Status string `json:"status" example:"ok"`
+}
+
+// NewHealthHandler creates a new HealthHandler instance
+func NewHealthHandler(readiness *health.Checker) *HealthHandler {
+	return &HealthHandler{readiness: readiness}
+}
+
+// LivenessHandler reports that the process is up and able to serve requests
+// @Summary Liveness check
+// @Description Reports that the process is running; served in every run mode
+// @Tags health
+// @Produce  json
+// @Success 200 {object} handler.HealthResponse
+// @Router /healthz [get]
+func (h *HealthHandler) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// ReadinessHandler reports whether the dependencies of the run mode are usable
+// @Summary Readiness check
+// @Description Checks the database, the broker and the event processor, and reports not ready once shutdown has started
+// @Tags health
+// @Produce  json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) ReadinessHandler(c *gin.Context) {
+	report := h.readiness.Check(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"httpchat/internal/health"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/healthz", NewHealthHandler(health.NewChecker(time.Second, time.Second)).LivenessHandler)
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response HealthResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", response.Status)
+}
+
+func TestReadinessHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	checker := health.NewChecker(time.Second, 0)
+	checker.Register("database", func(context.Context) error { return nil })
+	router := gin.New()
+	router.GET("/readyz", NewHealthHandler(checker).ReadinessHandler)
+
+	probe := func() (int, health.Report) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report health.Report
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		return rr.Code, report
+	}
+
+	code, report := probe()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusReady, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+
+	// A failing dependency is reported by name
+	checker.Register("broker", func(context.Context) error { return errors.New("connection refused") })
+	code, report = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusNotReady, report.Status)
+	assert.Equal(t, "connection refused", report.Checks["broker"].Error)
+
+	// Readiness fails once shutdown starts, whatever the dependencies report
+	checker.Register("broker", func(context.Context) error { return nil })
+	checker.SetShuttingDown()
+	code, report = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusShuttingDown, report.Status)
+}
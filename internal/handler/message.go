@@ -3,11 +3,15 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"httpchat/internal/interfaces"
 	"httpchat/internal/logger"
+	"httpchat/internal/model"
 	"httpchat/internal/repositoryerr"
 	"httpchat/internal/validation"
 
@@ -32,16 +36,20 @@ type CreateMessageResponse struct {
 	ID int64 `json:"id" example:"1"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error" example:"Something went wrong"`
+// ListMessagesResponse represents the response body for listing messages
+type ListMessagesResponse struct {
+	Messages   []*model.Message `json:"messages"`
+	NextCursor string           `json:"next_cursor,omitempty" example:"eyJjcmVhdGVkX2F0IjoiMjAyNC0wMS0wMVQwMDowMDowMFoiLCJpZCI6NDJ9"`
 }
 
-// httpError represents an HTTP error with status code
-type httpError struct {
-	statusCode int
-	message    string
-}
+// Headers used for idempotent message creation
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// defaultListLimit is the page size used when the client does not pass one
+const defaultListLimit = 50
 
 // NewMessageHandler creates a new MessageHandler instance
 func NewMessageHandler(service interfaces.MessageService, logger *logger.Logger) *MessageHandler {
@@ -53,48 +61,61 @@ func NewMessageHandler(service interfaces.MessageService, logger *logger.Logger)
 }
 
 // handleServiceError converts service errors to appropriate HTTP responses
-func (h *MessageHandler) handleServiceError(err error) *httpError {
+func (h *MessageHandler) handleServiceError(c *gin.Context, err error) *httpError {
+	log := h.logger.FromContext(c.Request.Context())
+
 	var repoErr *repositoryerr.RepositoryError
 	if errors.As(err, &repoErr) {
 		switch repoErr.ErrorCode() {
 		case repositoryerr.ErrorCodeInvalidInput:
-			h.logger.Warn("Invalid input", zap.Error(err))
-			return &httpError{http.StatusBadRequest, "Invalid input"}
+			log.Warn("Invalid input", zap.Error(err))
+			return newHTTPError(http.StatusBadRequest, repoErr.Code, "Invalid input")
 		case repositoryerr.ErrorCodeDuplicateEntry:
-			h.logger.Warn("Duplicate entry", zap.Error(err))
-			return &httpError{http.StatusBadRequest, "Duplicate entry"}
+			log.Warn("Duplicate entry", zap.Error(err))
+			return newHTTPError(http.StatusConflict, repoErr.Code, "Message already exists")
+		case repositoryerr.ErrorCodeIdempotencyKeyMismatch:
+			log.Warn("Idempotency key reused with a different request", zap.Error(err))
+			return newHTTPError(http.StatusConflict, repoErr.Code, "Idempotency-Key was already used with a different request")
 		case repositoryerr.ErrorCodeMessageNotFound:
-			h.logger.Warn("Message not found", zap.Error(err))
-			return &httpError{http.StatusNotFound, "Message not found"}
+			log.Warn("Message not found", zap.Error(err))
+			return newHTTPError(http.StatusNotFound, repoErr.Code, "Message not found")
+		case repositoryerr.ErrorCodeInvalidStatusTransition:
+			log.Warn("Invalid status transition", zap.Error(err))
+			return newHTTPError(http.StatusConflict, repoErr.Code, "Message status does not allow this operation")
 		case repositoryerr.ErrorCodeDatabaseConnection:
-			h.logger.Error("Database connection error", zap.Error(err))
-			return &httpError{http.StatusServiceUnavailable, "Service temporarily unavailable"}
+			log.Error("Database connection error", zap.Error(err))
+			return newHTTPError(http.StatusServiceUnavailable, repoErr.Code, "Service temporarily unavailable")
 		default:
-			h.logger.Error("Service error", zap.Error(err))
-			return &httpError{http.StatusInternalServerError, "Internal server error"}
+			// Other codes describe internal failures that the client cannot act on
+			log.Error("Service error", zap.Error(err))
+			return newHTTPError(http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
 		}
 	}
-	h.logger.Error("Unexpected service error", zap.Error(err))
-	return &httpError{http.StatusInternalServerError, "Internal server error"}
+	log.Error("Unexpected service error", zap.Error(err))
+	return newHTTPError(http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
 }
 
-// CreateMessageHandler creates a new message and sends it to Kafka
+// CreateMessageHandler creates a new message and enqueues it for Kafka
 // @Summary Create a new message
-// @Description Creates a new message and sends it to Kafka
+// @Description Creates a new message; its Kafka event is published asynchronously via the outbox
 // @Tags messages
 // @Accept  json
 // @Produce  json
 // @Param content body handler.CreateMessageRequest true "Message content"
+// @Param Idempotency-Key header string false "Client-generated key that makes retries safe"
 // @Success 200 {object} handler.CreateMessageResponse
 // @Failure 400 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
 // @Failure 500 {object} handler.ErrorResponse
 // @Router /messages [post]
 func (h *MessageHandler) CreateMessageHandler(c *gin.Context) {
+	log := h.logger.FromContext(c.Request.Context())
+
 	// Step 1: Parse the JSON request body
 	var req CreateMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Warn("Invalid JSON in create message request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		log.Warn("Invalid JSON in create message request", zap.Error(err))
+		respondError(c, newHTTPError(http.StatusBadRequest, ErrorCodeInvalidJSON, "Invalid JSON"))
 		return
 	}
 
@@ -104,44 +125,66 @@ func (h *MessageHandler) CreateMessageHandler(c *gin.Context) {
 		if ok {
 			switch validationErr.Code {
 			case validation.ValidationErrorCodeEmptyContent:
-				h.logger.Warn("Empty message content")
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Message content cannot be empty"})
+				log.Warn("Empty message content")
+				respondError(c, validationError("content", err, "Message content cannot be empty"))
 				return
 			case validation.ValidationErrorCodeContentTooLong:
-				h.logger.Warn("Message content too long", zap.Int("length", len(req.Content)))
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Message content too long (max 1000 characters)"})
+				log.Warn("Message content too long", zap.Int("length", len(req.Content)))
+				respondError(c, validationError("content", err, "Message content too long (max 1000 characters)"))
 				return
 			case validation.ValidationErrorCodeInvalidCharacters:
-				h.logger.Warn("Message content contains invalid characters", zap.String("content", req.Content))
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Message content contains invalid characters"})
+				log.Warn("Message content contains invalid characters", zap.String("content", req.Content))
+				respondError(c, validationError("content", err, "Message content contains invalid characters"))
 				return
 			}
 		}
-		h.logger.Warn("Validation error", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message content"})
+		log.Warn("Validation error", zap.Error(err))
+		respondError(c, validationError("content", err, "Invalid message content"))
 		return
 	}
 
-	h.logger.Info("Creating new message", zap.String("content", req.Content))
+	// Step 3: Retries carrying the same Idempotency-Key must not create a second message
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	if idempotencyKey != "" {
+		if err := h.validator.ValidateIdempotencyKey(idempotencyKey); err != nil {
+			log.Warn("Invalid idempotency key", zap.Error(err))
+			respondError(c, validationError(IdempotencyKeyHeader, err, "Invalid Idempotency-Key header"))
+			return
+		}
+	}
+
+	log.Info("Creating new message", zap.String("content", req.Content))
 
-	// Step 3: Process the message through the service layer
-	id, err := h.service.CreateMessage(c.Request.Context(), req.Content)
+	// Step 4: Process the message through the service layer
+	var id int64
+	var replayed bool
+	var err error
+	if idempotencyKey != "" {
+		id, replayed, err = h.service.CreateMessageIdempotent(c.Request.Context(), req.Content, idempotencyKey)
+	} else {
+		id, err = h.service.CreateMessage(c.Request.Context(), req.Content)
+	}
 	if err != nil {
-		httpErr := h.handleServiceError(err)
-		c.JSON(httpErr.statusCode, gin.H{"error": httpErr.message})
+		httpErr := h.handleServiceError(c, err)
+		respondError(c, httpErr)
 		return
 	}
 
-	h.logger.Info("Successfully created message", zap.Int64("id", id))
+	if replayed {
+		log.Info("Replayed message for idempotency key", zap.Int64("id", id))
+		c.Header(IdempotentReplayedHeader, "true")
+	} else {
+		log.Info("Successfully created message", zap.Int64("id", id))
+	}
 
-	// Step 4: Return the new message ID to confirm successful creation
+	// Step 5: Return the message ID to confirm successful creation
 	response := CreateMessageResponse{ID: id}
 	c.JSON(http.StatusOK, response)
 }
 
-// GetStatisticsHandler returns statistics on processed and unprocessed messages
+// GetStatisticsHandler returns message counts per lifecycle status
 // @Summary Get message statistics
-// @Description Returns statistics on processed and unprocessed messages
+// @Description Returns message counts per lifecycle status
 // @Tags statistics
 // @Produce  json
 // @Success 200 {object} model.Statistics
@@ -149,20 +192,22 @@ func (h *MessageHandler) CreateMessageHandler(c *gin.Context) {
 // @Failure 503 {object} handler.ErrorResponse
 // @Router /statistics [get]
 func (h *MessageHandler) GetStatisticsHandler(c *gin.Context) {
-	h.logger.Info("Fetching message statistics")
+	log := h.logger.FromContext(c.Request.Context())
+
+	log.Info("Fetching message statistics")
 
 	// Get message statistics from the service layer
 	stats, err := h.service.GetStatistics(c.Request.Context())
 	if err != nil {
-		httpErr := h.handleServiceError(err)
-		c.JSON(httpErr.statusCode, gin.H{"error": httpErr.message})
+		httpErr := h.handleServiceError(c, err)
+		respondError(c, httpErr)
 		return
 	}
 
-	h.logger.Info("Successfully fetched statistics", 
+	log.Info("Successfully fetched statistics",
 		zap.Int64("total", stats.TotalMessages),
 		zap.Int64("processed", stats.ProcessedMessages),
-		zap.Int64("unprocessed", stats.UnprocessedMessages))
+		zap.Int64("dead_lettered", stats.DeadLetteredMessages))
 
 	// Return statistics as JSON response
 	c.JSON(http.StatusOK, stats)
@@ -176,42 +221,231 @@ func (h *MessageHandler) GetStatisticsHandler(c *gin.Context) {
 // @Success 200
 // @Failure 400 {object} handler.ErrorResponse
 // @Failure 404 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
 // @Failure 500 {object} handler.ErrorResponse
 // @Router /messages/{id}/process [put]
 func (h *MessageHandler) ProcessMessageHandler(c *gin.Context) {
-	// Step 1: Extract and parse the message ID from URL parameters
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	log := h.logger.FromContext(c.Request.Context())
+
+	// Step 1: Extract and validate the message ID from URL parameters
+	id, httpErr := h.parseMessageID(c)
+	if httpErr != nil {
+		respondError(c, httpErr)
+		return
+	}
+
+	log.Info("Processing message", zap.Int64("id", id))
+
+	// Step 2: Mark the specified message as processed through the service layer
+	if err := h.service.ProcessMessage(c.Request.Context(), id); err != nil {
+		httpErr := h.handleServiceError(c, err)
+		respondError(c, httpErr)
+		return
+	}
+
+	log.Info("Successfully processed message", zap.Int64("id", id))
+
+	// Step 3: Return success response (200 OK)
+	c.Status(http.StatusOK)
+}
+
+// GetMessageHandler returns a single message by ID
+// @Summary Get a message
+// @Description Returns a message by ID. Supports conditional requests via ETag / If-None-Match
+// @Tags messages
+// @Produce  json
+// @Param id path int true "Message ID"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {object} model.Message
+// @Success 304 "Not Modified"
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /messages/{id} [get]
+func (h *MessageHandler) GetMessageHandler(c *gin.Context) {
+	log := h.logger.FromContext(c.Request.Context())
+
+	// Step 1: Extract and validate the message ID from URL parameters
+	id, httpErr := h.parseMessageID(c)
+	if httpErr != nil {
+		respondError(c, httpErr)
+		return
+	}
+
+	log.Info("Fetching message", zap.Int64("id", id))
+
+	// Step 2: Load the message through the service layer
+	message, err := h.service.GetMessage(c.Request.Context(), id)
 	if err != nil {
-		h.logger.Warn("Invalid message ID format", zap.String("id", idStr), zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		httpErr := h.handleServiceError(c, err)
+		respondError(c, httpErr)
 		return
 	}
 
-	// Step 2: Validate the message ID
-	if err := h.validator.ValidateMessageID(id); err != nil {
-		validationErr, ok := err.(*validation.Error)
-		if ok && validationErr.Code == validation.ValidationErrorCodeInvalidID {
-			h.logger.Warn("Invalid message ID value", zap.Int64("id", id))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
-			return
-		}
-		h.logger.Warn("Validation error", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+	// Step 3: Answer with 304 if the client already has the current version
+	etag := messageETag(message)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		log.Info("Message not modified", zap.Int64("id", id))
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	h.logger.Info("Processing message", zap.Int64("id", id))
+	log.Info("Successfully fetched message", zap.Int64("id", id))
 
-	// Step 3: Mark the specified message as processed through the service layer
-	if err := h.service.ProcessMessage(c.Request.Context(), id); err != nil {
-		httpErr := h.handleServiceError(err)
-		c.JSON(httpErr.statusCode, gin.H{"error": httpErr.message})
+	// Step 4: Return the message
+	c.JSON(http.StatusOK, message)
+}
+
+// ListMessagesHandler returns a page of messages using keyset pagination
+// @Summary List messages
+// @Description Returns messages ordered by creation time with cursor-based pagination
+// @Tags messages
+// @Produce  json
+// @Param limit query int false "Page size (1-500)" default(50)
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param status query string false "Filter by lifecycle status" Enums(pending, processing, processed, failed, dead_lettered)
+// @Param created_from query string false "Only messages created at or after this RFC 3339 time"
+// @Param created_to query string false "Only messages created before this RFC 3339 time"
+// @Param order query string false "Sort order by created_at" Enums(asc, desc) default(desc)
+// @Success 200 {object} handler.ListMessagesResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Failure 503 {object} handler.ErrorResponse
+// @Router /messages [get]
+func (h *MessageHandler) ListMessagesHandler(c *gin.Context) {
+	log := h.logger.FromContext(c.Request.Context())
+
+	// Step 1: Parse the query parameters into a filter
+	filter, httpErr := h.parseListFilter(c)
+	if httpErr != nil {
+		respondError(c, httpErr)
 		return
 	}
 
-	h.logger.Info("Successfully processed message", zap.Int64("id", id))
+	log.Info("Listing messages", zap.Int("limit", filter.Limit), zap.String("order", string(filter.Order)))
 
-	// Step 4: Return success response (200 OK)
-	c.Status(http.StatusOK)
+	// Step 2: Fetch the page through the service layer
+	page, err := h.service.ListMessages(c.Request.Context(), *filter)
+	if err != nil {
+		httpErr := h.handleServiceError(c, err)
+		respondError(c, httpErr)
+		return
+	}
+
+	log.Info("Successfully listed messages", zap.Int("count", len(page.Messages)))
+
+	// Step 3: Return the page along with the cursor for the next one
+	c.JSON(http.StatusOK, ListMessagesResponse{
+		Messages:   page.Messages,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// parseListFilter builds a message filter from the query string of a list request
+func (h *MessageHandler) parseListFilter(c *gin.Context) (*model.MessageFilter, *httpError) {
+	log := h.logger.FromContext(c.Request.Context())
+
+	filter := &model.MessageFilter{
+		Order: model.SortOrderDesc,
+		Limit: defaultListLimit,
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			log.Warn("Invalid limit format", zap.String("limit", limitStr), zap.Error(err))
+			return nil, fieldError("limit", validation.ValidationErrorCodeInvalidLimit, "Invalid limit")
+		}
+		filter.Limit = limit
+	}
+	if err := h.validator.ValidateListLimit(filter.Limit); err != nil {
+		log.Warn("Invalid limit value", zap.Int("limit", filter.Limit))
+		return nil, validationError("limit", err, "Invalid limit (must be between 1 and "+strconv.Itoa(validation.MaxListLimit)+")")
+	}
+
+	switch order := c.Query("order"); order {
+	case "", string(model.SortOrderDesc):
+	case string(model.SortOrderAsc):
+		filter.Order = model.SortOrderAsc
+	default:
+		log.Warn("Invalid sort order", zap.String("order", order))
+		return nil, fieldError("order", ErrorCodeInvalidOrder, "Invalid order (must be asc or desc)")
+	}
+
+	if statusStr := c.Query("status"); statusStr != "" {
+		status, err := model.ParseMessageStatus(statusStr)
+		if err != nil {
+			log.Warn("Invalid status filter", zap.String("status", statusStr), zap.Error(err))
+			return nil, fieldError("status", ErrorCodeInvalidStatus, "Invalid status filter")
+		}
+		filter.Status = &status
+	}
+
+	for param, target := range map[string]**time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			log.Warn("Invalid time filter", zap.String(param, value), zap.Error(err))
+			return nil, fieldError(param, ErrorCodeInvalidTime, "Invalid "+param+" (expected RFC 3339 time)")
+		}
+		*target = &parsed
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := model.DecodeMessageCursor(cursorStr)
+		if err != nil {
+			log.Warn("Invalid cursor", zap.String("cursor", cursorStr), zap.Error(err))
+			return nil, fieldError("cursor", ErrorCodeInvalidCursor, "Invalid cursor")
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
+
+// parseMessageID extracts and validates the :id URL parameter
+func (h *MessageHandler) parseMessageID(c *gin.Context) (int64, *httpError) {
+	log := h.logger.FromContext(c.Request.Context())
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Warn("Invalid message ID format", zap.String("id", idStr), zap.Error(err))
+		return 0, fieldError("id", validation.ValidationErrorCodeInvalidID, "Invalid message ID")
+	}
+
+	if err := h.validator.ValidateMessageID(id); err != nil {
+		log.Warn("Invalid message ID value", zap.Int64("id", id), zap.Error(err))
+		return 0, validationError("id", err, "Invalid message ID")
+	}
+
+	return id, nil
+}
+
+// messageETag builds a strong entity tag that changes whenever the message is updated
+func messageETag(message *model.Message) string {
+	return fmt.Sprintf(`"%d-%d"`, message.ID, message.UpdatedAt.UnixNano())
+}
+
+// etagMatches reports whether an If-None-Match header value matches the entity tag.
+// Weak comparison is used, as RFC 9110 requires for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
@@ -6,11 +6,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"httpchat/internal/interfaces"
 	"httpchat/internal/logger"
 	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+	"httpchat/internal/requestid"
+	"httpchat/internal/validation"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -18,9 +23,14 @@ import (
 
 // mockMessageService implements interfaces.MessageService for testing
 type mockMessageService struct {
-	createMessageFunc  func(ctx context.Context, content string) (int64, error)
-	processMessageFunc func(ctx context.Context, id int64) error
-	getStatisticsFunc  func(ctx context.Context) (*model.Statistics, error)
+	createMessageFunc    func(ctx context.Context, content string) (int64, error)
+	createIdempotentFunc func(ctx context.Context, content, key string) (int64, bool, error)
+	processMessageFunc   func(ctx context.Context, id int64) error
+	failMessageFunc      func(ctx context.Context, id int64, reason string) error
+	deadLetterFunc       func(ctx context.Context, id int64, reason string) error
+	getMessageFunc       func(ctx context.Context, id int64) (*model.Message, error)
+	listMessagesFunc     func(ctx context.Context, filter model.MessageFilter) (*model.MessagePage, error)
+	getStatisticsFunc    func(ctx context.Context) (*model.Statistics, error)
 }
 
 func (m *mockMessageService) CreateMessage(ctx context.Context, content string) (int64, error) {
@@ -30,6 +40,13 @@ func (m *mockMessageService) CreateMessage(ctx context.Context, content string)
 	return 0, nil
 }
 
+func (m *mockMessageService) CreateMessageIdempotent(ctx context.Context, content, key string) (int64, bool, error) {
+	if m.createIdempotentFunc != nil {
+		return m.createIdempotentFunc(ctx, content, key)
+	}
+	return 0, false, nil
+}
+
 func (m *mockMessageService) ProcessMessage(ctx context.Context, id int64) error {
 	if m.processMessageFunc != nil {
 		return m.processMessageFunc(ctx, id)
@@ -37,6 +54,34 @@ func (m *mockMessageService) ProcessMessage(ctx context.Context, id int64) error
 	return nil
 }
 
+func (m *mockMessageService) FailMessage(ctx context.Context, id int64, reason string) error {
+	if m.failMessageFunc != nil {
+		return m.failMessageFunc(ctx, id, reason)
+	}
+	return nil
+}
+
+func (m *mockMessageService) DeadLetterMessage(ctx context.Context, id int64, reason string) error {
+	if m.deadLetterFunc != nil {
+		return m.deadLetterFunc(ctx, id, reason)
+	}
+	return nil
+}
+
+func (m *mockMessageService) GetMessage(ctx context.Context, id int64) (*model.Message, error) {
+	if m.getMessageFunc != nil {
+		return m.getMessageFunc(ctx, id)
+	}
+	return &model.Message{ID: id}, nil
+}
+
+func (m *mockMessageService) ListMessages(ctx context.Context, filter model.MessageFilter) (*model.MessagePage, error) {
+	if m.listMessagesFunc != nil {
+		return m.listMessagesFunc(ctx, filter)
+	}
+	return &model.MessagePage{}, nil
+}
+
 func (m *mockMessageService) GetStatistics(ctx context.Context) (*model.Statistics, error) {
 	if m.getStatisticsFunc != nil {
 		return m.getStatisticsFunc(ctx)
@@ -50,7 +95,10 @@ var _ interfaces.MessageService = (*mockMessageService)(nil)
 func setupTestRouter(handler *MessageHandler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	router.Use(RequestIDMiddleware())
 	router.POST("/messages", handler.CreateMessageHandler)
+	router.GET("/messages", handler.ListMessagesHandler)
+	router.GET("/messages/:id", handler.GetMessageHandler)
 	router.GET("/statistics", handler.GetStatisticsHandler)
 	router.PUT("/messages/:id/process", handler.ProcessMessageHandler)
 	return router
@@ -104,7 +152,8 @@ func TestCreateMessageHandler(t *testing.T) {
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Message content cannot be empty", response.Error)
+		assert.Equal(t, "Message content cannot be empty", response.Detail)
+		assert.Equal(t, validation.ValidationErrorCodeEmptyContent, response.Code)
 	})
 
 	// Test content too long
@@ -116,16 +165,29 @@ func TestCreateMessageHandler(t *testing.T) {
 		requestBody := `{"content": "` + longContent + `"}`
 		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(requestBody))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(requestid.Header, "req-1")
 
 		rr := httptest.NewRecorder()
 		router.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, ProblemContentType, rr.Header().Get("Content-Type"))
 
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Message content too long (max 1000 characters)", response.Error)
+		assert.Equal(t, ErrorResponse{
+			Type:      "about:blank",
+			Title:     "Bad Request",
+			Status:    http.StatusBadRequest,
+			Code:      validation.ValidationErrorCodeContentTooLong,
+			Detail:    "Message content too long (max 1000 characters)",
+			Instance:  "/messages",
+			RequestID: "req-1",
+			Errors: []FieldError{
+				{Field: "content", Code: validation.ValidationErrorCodeContentTooLong, Message: "message content too long"},
+			},
+		}, response)
 	})
 
 	// Test invalid characters
@@ -142,7 +204,8 @@ func TestCreateMessageHandler(t *testing.T) {
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Message content contains invalid characters", response.Error)
+		assert.Equal(t, "Message content contains invalid characters", response.Detail)
+		assert.Equal(t, validation.ValidationErrorCodeInvalidCharacters, response.Code)
 	})
 
 	// Test invalid JSON
@@ -159,16 +222,19 @@ func TestCreateMessageHandler(t *testing.T) {
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Invalid JSON", response.Error)
+		assert.Equal(t, "Invalid JSON", response.Detail)
+		assert.Equal(t, ErrorCodeInvalidJSON, response.Code)
+		assert.Empty(t, response.Errors)
 	})
 }
 
 func TestGetStatisticsHandler(t *testing.T) {
 	// Create a mock service
 	stats := &model.Statistics{
-		TotalMessages:       10,
-		ProcessedMessages:   7,
-		UnprocessedMessages: 3,
+		TotalMessages:        10,
+		PendingMessages:      2,
+		ProcessedMessages:    7,
+		DeadLetteredMessages: 1,
 	}
 
 	mockService := &mockMessageService{
@@ -200,14 +266,18 @@ func TestGetStatisticsHandler(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, stats.TotalMessages, response.TotalMessages)
 		assert.Equal(t, stats.ProcessedMessages, response.ProcessedMessages)
-		assert.Equal(t, stats.UnprocessedMessages, response.UnprocessedMessages)
+		assert.Equal(t, stats.PendingMessages, response.PendingMessages)
+		assert.Equal(t, stats.DeadLetteredMessages, response.DeadLetteredMessages)
 	})
 }
 
 func TestProcessMessageHandler(t *testing.T) {
 	// Create a mock service
 	mockService := &mockMessageService{
-		processMessageFunc: func(_ context.Context, _ int64) error {
+		processMessageFunc: func(_ context.Context, id int64) error {
+			if id == 2 {
+				return repositoryerr.New(repositoryerr.ErrorCodeInvalidStatusTransition, "UpdateMessageStatus", repositoryerr.ErrInvalidStatusTransition)
+			}
 			return nil
 		},
 	}
@@ -231,6 +301,16 @@ func TestProcessMessageHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rr.Code)
 	})
 
+	// Test a message whose status does not allow processing
+	t.Run("InvalidStatusTransition", func(t *testing.T) {
+		req, _ := http.NewRequest("PUT", "/messages/2/process", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
 	// Test invalid ID format
 	t.Run("InvalidIDFormat", func(t *testing.T) {
 		req, _ := http.NewRequest("PUT", "/messages/abc/process", nil)
@@ -243,7 +323,7 @@ func TestProcessMessageHandler(t *testing.T) {
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Invalid message ID", response.Error)
+		assert.Equal(t, "Invalid message ID", response.Detail)
 	})
 
 	// Test zero ID
@@ -258,7 +338,7 @@ func TestProcessMessageHandler(t *testing.T) {
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Invalid message ID", response.Error)
+		assert.Equal(t, "Invalid message ID", response.Detail)
 	})
 
 	// Test negative ID
@@ -273,6 +353,312 @@ func TestProcessMessageHandler(t *testing.T) {
 		var response ErrorResponse
 		err := json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, "Invalid message ID", response.Error)
+		assert.Equal(t, "Invalid message ID", response.Detail)
+	})
+}
+
+func TestListMessagesHandler(t *testing.T) {
+	var receivedFilter model.MessageFilter
+
+	// Create a mock service
+	mockService := &mockMessageService{
+		listMessagesFunc: func(_ context.Context, filter model.MessageFilter) (*model.MessagePage, error) {
+			receivedFilter = filter
+			return &model.MessagePage{
+				Messages:   []*model.Message{{ID: 2, Content: "Test message"}},
+				NextCursor: "next",
+			}, nil
+		},
+	}
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Create handler with mock service
+	handler := NewMessageHandler(mockService, testLogger)
+
+	// Setup router
+	router := setupTestRouter(handler)
+
+	// Test default parameters
+	t.Run("Defaults", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, defaultListLimit, receivedFilter.Limit)
+		assert.Equal(t, model.SortOrderDesc, receivedFilter.Order)
+		assert.Nil(t, receivedFilter.Status)
+		assert.Nil(t, receivedFilter.After)
+
+		var response ListMessagesResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Len(t, response.Messages, 1)
+		assert.Equal(t, "next", response.NextCursor)
+	})
+
+	// Test filters and cursor are passed through
+	t.Run("FiltersAndCursor", func(t *testing.T) {
+		createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cursor := model.MessageCursor{CreatedAt: createdAt, ID: 42}.Encode()
+		req, _ := http.NewRequest("GET", "/messages?limit=10&order=asc&status=dead_lettered&created_from=2024-01-01T00:00:00Z&created_to=2024-02-01T00:00:00Z&cursor="+cursor, nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 10, receivedFilter.Limit)
+		assert.Equal(t, model.SortOrderAsc, receivedFilter.Order)
+		if assert.NotNil(t, receivedFilter.Status) {
+			assert.Equal(t, model.StatusDeadLettered, *receivedFilter.Status)
+		}
+		if assert.NotNil(t, receivedFilter.CreatedFrom) {
+			assert.True(t, receivedFilter.CreatedFrom.Equal(createdAt))
+		}
+		assert.NotNil(t, receivedFilter.CreatedTo)
+		if assert.NotNil(t, receivedFilter.After) {
+			assert.Equal(t, int64(42), receivedFilter.After.ID)
+			assert.True(t, receivedFilter.After.CreatedAt.Equal(createdAt))
+		}
+	})
+
+	// Test invalid query parameters
+	invalidQueries := map[string]struct {
+		query string
+		field string
+		code  string
+	}{
+		"InvalidLimitFormat": {"limit=abc", "limit", validation.ValidationErrorCodeInvalidLimit},
+		"LimitTooLarge":      {"limit=501", "limit", validation.ValidationErrorCodeInvalidLimit},
+		"ZeroLimit":          {"limit=0", "limit", validation.ValidationErrorCodeInvalidLimit},
+		"InvalidOrder":       {"order=sideways", "order", ErrorCodeInvalidOrder},
+		"InvalidStatus":      {"status=maybe", "status", ErrorCodeInvalidStatus},
+		"InvalidCreatedFrom": {"created_from=yesterday", "created_from", ErrorCodeInvalidTime},
+		"InvalidCursor":      {"cursor=not-a-cursor", "cursor", ErrorCodeInvalidCursor},
+	}
+	for name, tt := range invalidQueries {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/messages?"+tt.query, nil)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+			// Every rejected parameter is named along with its code
+			var response ErrorResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.code, response.Code)
+			if assert.Len(t, response.Errors, 1) {
+				assert.Equal(t, tt.field, response.Errors[0].Field)
+				assert.Equal(t, tt.code, response.Errors[0].Code)
+			}
+		})
+	}
+}
+
+func TestGetMessageHandler(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Create a mock service
+	mockService := &mockMessageService{
+		getMessageFunc: func(_ context.Context, id int64) (*model.Message, error) {
+			if id != 1 {
+				return nil, repositoryerr.New(repositoryerr.ErrorCodeMessageNotFound, "GetMessageByID", repositoryerr.ErrMessageNotFound)
+			}
+			return &model.Message{ID: 1, Content: "Test message", Status: model.StatusProcessed, UpdatedAt: updatedAt}, nil
+		},
+	}
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Create handler with mock service
+	handler := NewMessageHandler(mockService, testLogger)
+
+	// Setup router
+	router := setupTestRouter(handler)
+
+	var etag string
+
+	// Test successful retrieval
+	t.Run("SuccessfulRetrieval", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages/1", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		etag = rr.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		var response model.Message
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), response.ID)
+		assert.Equal(t, model.StatusProcessed, response.Status)
+	})
+
+	// Test conditional request with a matching ETag
+	t.Run("NotModified", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages/1", nil)
+		req.Header.Set("If-None-Match", `"stale", W/`+etag)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+		assert.Empty(t, rr.Body.Bytes())
+	})
+
+	// Test conditional request with a stale ETag
+	t.Run("Modified", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages/1", nil)
+		req.Header.Set("If-None-Match", `"1-0"`)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	// Test message not found
+	t.Run("NotFound", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages/2", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var response ErrorResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "Message not found", response.Detail)
+		assert.Equal(t, repositoryerr.ErrorCodeMessageNotFound, response.Code)
+		assert.Equal(t, "/messages/2", response.Instance)
+	})
+
+	// Test invalid ID format
+	t.Run("InvalidIDFormat", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/messages/abc", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestCreateMessageHandlerIdempotency(t *testing.T) {
+	// Create a mock service that remembers the content used with each key
+	used := map[string]string{}
+	mockService := &mockMessageService{
+		createMessageFunc: func(_ context.Context, _ string) (int64, error) {
+			t.Error("CreateMessage must not be called when an Idempotency-Key is present")
+			return 0, nil
+		},
+		createIdempotentFunc: func(_ context.Context, content, key string) (int64, bool, error) {
+			previous, exists := used[key]
+			if !exists {
+				used[key] = content
+				return 7, false, nil
+			}
+			if previous != content {
+				return 0, false, repositoryerr.New(repositoryerr.ErrorCodeIdempotencyKeyMismatch, "CreateMessageIdempotent", repositoryerr.ErrIdempotencyKeyMismatch)
+			}
+			return 7, true, nil
+		},
+	}
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Create handler with mock service
+	handler := NewMessageHandler(mockService, testLogger)
+
+	// Setup router
+	router := setupTestRouter(handler)
+
+	post := func(body, key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, key)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test first request and its retry
+	t.Run("ReplayOnRetry", func(t *testing.T) {
+		rr := post(`{"content": "Test message"}`, "key-1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get(IdempotentReplayedHeader))
+
+		rr = post(`{"content": "Test message"}`, "key-1")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "true", rr.Header().Get(IdempotentReplayedHeader))
+
+		var response CreateMessageResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), response.ID)
+	})
+
+	// Test key reuse with a different body
+	t.Run("ConflictOnDifferentBody", func(t *testing.T) {
+		rr := post(`{"content": "Another message"}`, "key-1")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		var response ErrorResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "Idempotency-Key was already used with a different request", response.Detail)
+		assert.Equal(t, repositoryerr.ErrorCodeIdempotencyKeyMismatch, response.Code)
+	})
+
+	// Test malformed key
+	t.Run("InvalidKey", func(t *testing.T) {
+		rr := post(`{"content": "Test message"}`, strings.Repeat("k", 300))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 }
+
+func TestCreateMessageHandlerDuplicateEntry(t *testing.T) {
+	// Create a mock service whose storage reports a unique violation
+	mockService := &mockMessageService{
+		createMessageFunc: func(_ context.Context, _ string) (int64, error) {
+			return 0, repositoryerr.New(repositoryerr.ErrorCodeDuplicateEntry, "CreateMessage", repositoryerr.ErrDuplicateEntry)
+		},
+	}
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Create handler with mock service
+	handler := NewMessageHandler(mockService, testLogger)
+
+	// Setup router
+	router := setupTestRouter(handler)
+
+	// Test that a duplicate without an Idempotency-Key is not blamed on the key
+	req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(`{"content": "Test message"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	var response ErrorResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Message already exists", response.Detail)
+	assert.Equal(t, repositoryerr.ErrorCodeDuplicateEntry, response.Code)
+}
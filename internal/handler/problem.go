@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"httpchat/internal/requestid"
+	"httpchat/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Error codes of the failures detected by the handlers. Failures reported by the
+// validator and the repository keep the codes of validation and repositoryerr.
+const (
+	ErrorCodeInvalidJSON   = "INVALID_JSON"
+	ErrorCodeInvalidInput  = "INVALID_INPUT"
+	ErrorCodeInvalidOrder  = "INVALID_ORDER"
+	ErrorCodeInvalidStatus = "INVALID_STATUS"
+	ErrorCodeInvalidTime   = "INVALID_TIME"
+	ErrorCodeInvalidCursor = "INVALID_CURSOR"
+	ErrorCodeUnauthorized  = "UNAUTHORIZED"
+	ErrorCodeReplayFailed  = "DLQ_REPLAY_FAILED"
+	ErrorCodeInternal      = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is a problem details object (RFC 7807). Clients should branch on code,
+// which is stable, rather than on detail, which is meant for people.
+type ErrorResponse struct {
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Bad Request"`
+	Status    int          `json:"status" example:"400"`
+	Code      string       `json:"code" example:"CONTENT_TOO_LONG"`
+	Detail    string       `json:"detail" example:"Message content too long (max 1000 characters)"`
+	Instance  string       `json:"instance" example:"/messages"`
+	RequestID string       `json:"request_id,omitempty" example:"6f1c2a9e-3b7d-4e5f-8a90-1b2c3d4e5f60"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError tells which field of the request was rejected and why
+type FieldError struct {
+	Field   string `json:"field" example:"content"`
+	Code    string `json:"code" example:"CONTENT_TOO_LONG"`
+	Message string `json:"message" example:"message content too long"`
+}
+
+// httpError represents an HTTP error with status code
+type httpError struct {
+	statusCode int
+	code       string
+	message    string
+	fields     []FieldError
+}
+
+// newHTTPError creates an error of the request as a whole
+func newHTTPError(statusCode int, code, message string) *httpError {
+	return &httpError{statusCode: statusCode, code: code, message: message}
+}
+
+// fieldError reports a rejected field, whose code is also the code of the response
+func fieldError(field, code, message string) *httpError {
+	err := newHTTPError(http.StatusBadRequest, code, message)
+	err.fields = []FieldError{{Field: field, Code: code, Message: message}}
+	return err
+}
+
+// validationError reports a field rejected by the validator, keeping the code and
+// message of the validator for the field
+func validationError(field string, err error, detail string) *httpError {
+	code := ErrorCodeInvalidInput
+	var validationErr *validation.Error
+	if errors.As(err, &validationErr) {
+		code = validationErr.Code
+	}
+	httpErr := newHTTPError(http.StatusBadRequest, code, detail)
+	httpErr.fields = []FieldError{{Field: field, Code: code, Message: err.Error()}}
+	return httpErr
+}
+
+// respondError aborts the request with err as an application/problem+json response
+func respondError(c *gin.Context, err *httpError) {
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(err.statusCode, ErrorResponse{
+		Type:      "about:blank",
+		Title:     http.StatusText(err.statusCode),
+		Status:    err.statusCode,
+		Code:      err.code,
+		Detail:    err.message,
+		Instance:  c.Request.URL.Path,
+		RequestID: requestid.FromContext(c.Request.Context()),
+		Errors:    err.fields,
+	})
+}
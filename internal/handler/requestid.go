@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"httpchat/internal/logger"
+	"httpchat/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxRequestIDLength bounds the request IDs accepted from callers, since they end up in
+// every log entry
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware gives every request an ID: the X-Request-ID header of the caller when
+// it is usable, or a new one. The ID is echoed in the response and stored in the context of
+// the request together with the route and client IP for the request-scoped loggers.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !validRequestID(id) {
+			id = requestid.New()
+		}
+		c.Header(requestid.Header, id)
+
+		ctx := requestid.NewContext(c.Request.Context(), id)
+		ctx = logger.ContextWithFields(ctx,
+			zap.String("request_id", id),
+			zap.String("route", c.FullPath()),
+			zap.String("client_ip", c.ClientIP()),
+		)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// validRequestID reports whether a request ID sent by a caller is short and printable
+// ASCII, so that it cannot break up or bloat the log entries
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"httpchat/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var seen string
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/messages/:id", func(c *gin.Context) {
+		seen = requestid.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/messages/1", nil)
+		if header != "" {
+			req.Header.Set(requestid.Header, header)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The ID of the caller is kept and echoed
+	rr := serve("req-1")
+	assert.Equal(t, "req-1", seen)
+	assert.Equal(t, "req-1", rr.Header().Get(requestid.Header))
+
+	// A missing or unusable ID is replaced by a new one
+	for _, header := range []string{"", "has space", strings.Repeat("a", maxRequestIDLength+1)} {
+		rr = serve(header)
+		assert.Len(t, seen, 32)
+		assert.NotEqual(t, header, seen)
+		assert.Equal(t, seen, rr.Header().Get(requestid.Header))
+	}
+}
@@ -0,0 +1,160 @@
+// Package health provides the readiness checks of the dependencies of the service.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable. It must return once ctx is done.
+type Check func(ctx context.Context) error
+
+// Statuses of a report and of its checks
+const (
+	StatusReady        = "ready"
+	StatusNotReady     = "not_ready"
+	StatusShuttingDown = "shutting_down"
+
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status    string    `json:"status" example:"ok"`
+	Error     string    `json:"error,omitempty" example:"dial tcp 127.0.0.1:9092: connect: connection refused"`
+	CheckedAt time.Time `json:"checked_at" example:"2024-01-01T12:00:00Z"`
+}
+
+// Report is the readiness of the service with the result of every check by name
+type Report struct {
+	Status string                 `json:"status" example:"ready"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Ready reports whether the service should receive traffic
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Checker runs the registered checks with a timeout each. A result is reused until it
+// is cacheTTL old, so that frequent probes do not load the dependencies.
+type Checker struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.Mutex
+	checks map[string]*cachedCheck
+
+	shuttingDown atomic.Bool
+}
+
+// cachedCheck is a check with its last result. mu is held while the check runs, so
+// concurrent probes wait for a single run instead of starting their own.
+type cachedCheck struct {
+	check Check
+
+	mu      sync.Mutex
+	result  CheckResult
+	expires time.Time
+}
+
+// NewChecker creates a new Checker instance
+func NewChecker(timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+		checks:   make(map[string]*cachedCheck),
+	}
+}
+
+// Register adds a check under name, replacing a check registered before under it
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = &cachedCheck{check: check}
+}
+
+// SetShuttingDown makes every later report not ready, so that load balancers stop
+// sending requests while the server drains
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs the checks concurrently and reports the service ready when all of them pass
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]*cachedCheck, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check *cachedCheck) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusNotReady
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+	return report
+}
+
+// run returns the cached result of check or runs it when the result has expired
+func (c *Checker) run(ctx context.Context, check *cachedCheck) CheckResult {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(check.expires) {
+		return check.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := check.check(checkCtx)
+	if err == nil && checkCtx.Err() != nil {
+		// The check ignored the timeout but must not pass late
+		err = checkCtx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, CheckedAt: now.UTC()}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("check timed out after %s", c.timeout)
+		}
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+
+	// A probe that was cancelled says nothing about the dependency, so it is not cached
+	if ctx.Err() == nil {
+		check.result = result
+		check.expires = now.Add(c.cacheTTL)
+	}
+	return result
+}
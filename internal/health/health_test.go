@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckerReport(t *testing.T) {
+	checker := NewChecker(time.Second, time.Minute)
+	checker.Register("database", func(context.Context) error { return nil })
+	report := checker.Check(context.Background())
+	assert.True(t, report.Ready())
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Empty(t, report.Checks["database"].Error)
+	assert.False(t, report.Checks["database"].CheckedAt.IsZero())
+
+	// A single failing check makes the service not ready
+	checker.Register("broker", func(context.Context) error { return errors.New("connection refused") })
+	report = checker.Check(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusNotReady, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, CheckResult{Status: StatusFailed, Error: "connection refused", CheckedAt: report.Checks["broker"].CheckedAt}, report.Checks["broker"])
+}
+
+func TestCheckerCachesResults(t *testing.T) {
+	var calls atomic.Int32
+	checker := NewChecker(time.Second, 50*time.Millisecond)
+	checker.Register("database", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	// Concurrent probes share one run of the check
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, checker.Check(context.Background()).Ready())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The check runs again once its result has expired
+	time.Sleep(60 * time.Millisecond)
+	checker.Check(context.Background())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	checker := NewChecker(20*time.Millisecond, time.Minute)
+	checker.Register("broker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checker.Register("slow", func(context.Context) error {
+		// Ignores the timeout but cannot pass once it expired
+		time.Sleep(40 * time.Millisecond)
+		return nil
+	})
+
+	start := time.Now()
+	report := checker.Check(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, StatusNotReady, report.Status)
+	assert.Equal(t, "check timed out after 20ms", report.Checks["broker"].Error)
+	assert.Equal(t, "check timed out after 20ms", report.Checks["slow"].Error)
+}
+
+func TestCheckerCancelledProbeIsNotCached(t *testing.T) {
+	var healthy atomic.Bool
+	checker := NewChecker(time.Second, time.Minute)
+	checker.Register("database", func(ctx context.Context) error {
+		if !healthy.Load() {
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, checker.Check(ctx).Ready())
+
+	healthy.Store(true)
+	assert.True(t, checker.Check(context.Background()).Ready())
+}
+
+func TestCheckerShuttingDown(t *testing.T) {
+	checker := NewChecker(time.Second, time.Minute)
+	checker.Register("database", func(context.Context) error { return nil })
+	checker.SetShuttingDown()
+
+	// The checks are still reported, but the service is no longer ready
+	report := checker.Check(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusShuttingDown, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+}
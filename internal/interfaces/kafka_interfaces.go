@@ -4,21 +4,49 @@ package interfaces
 import (
 	"context"
 
+	"httpchat/internal/model"
+
 	"github.com/segmentio/kafka-go"
 )
 
 // KafkaProducer defines the interface for Kafka message production
 type KafkaProducer interface {
 	SendMessage(ctx context.Context, topic string, message []byte) error
+	// SendMessages writes the key, value and headers of each message of a batch in a single
+	// request. When only some messages fail the error is a model.BatchSendError that reports
+	// the failure of each message.
+	SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error
+	SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error
+	// SendMessageWithKey writes a message to the partition of its key, so that messages
+	// with the same key are consumed in the order they were sent
+	SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) error
 	Close() error
 }
 
-// KafkaConsumer defines the interface for Kafka message consumption
+// KafkaConsumer defines the interface for Kafka message consumption.
+// Fetched messages are not committed until their delivery is committed.
 type KafkaConsumer interface {
-	ReadMessage(ctx context.Context, topic string) ([]byte, error)
+	FetchMessage(ctx context.Context, topic string) (KafkaDelivery, error)
+	// Commit commits several deliveries fetched by this consumer in a single request
+	Commit(ctx context.Context, deliveries ...KafkaDelivery) error
 	Close() error
 }
 
+// KafkaDelivery is a fetched message whose offset has not been committed yet
+type KafkaDelivery interface {
+	// Message returns the fetched message
+	Message() *model.KafkaMessage
+	// Commit marks the message as handled so that it is not delivered again
+	Commit(ctx context.Context) error
+	// Nack gives up on the message without committing it so that it is delivered again
+	Nack(ctx context.Context) error
+}
+
+// DeadLetterReplayer defines the interface for replaying dead-lettered events onto the main topic
+type DeadLetterReplayer interface {
+	Replay(ctx context.Context, limit int) (int, error)
+}
+
 // KafkaWriter is an interface that wraps kafka-go Writer for testing
 type KafkaWriter interface {
 	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
@@ -27,6 +55,7 @@ type KafkaWriter interface {
 
 // KafkaReader is an interface that wraps kafka-go Reader for testing
 type KafkaReader interface {
-	ReadMessage(ctx context.Context) (kafka.Message, error)
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
 	Close() error
 }
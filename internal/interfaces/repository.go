@@ -3,6 +3,7 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"httpchat/internal/model"
 )
@@ -10,8 +11,23 @@ import (
 // MessageRepository defines the interface for message repository operations
 type MessageRepository interface {
 	CreateMessage(ctx context.Context, content string) (*model.Message, error)
+	// CreateMessageIdempotent treats keys older than keyTTL as unused
+	CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (*model.Message, bool, error)
 	GetMessageByID(ctx context.Context, id int64) (*model.Message, error)
-	UpdateMessageStatus(ctx context.Context, id int64, processed bool) error
-	GetAllMessages(ctx context.Context) ([]*model.Message, error)
+	UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) error
+	ListMessages(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error)
 	GetStatistics(ctx context.Context) (*model.Statistics, error)
-}
\ No newline at end of file
+}
+
+// IdempotencyKeyRepository defines the retention operations for idempotency keys
+type IdempotencyKeyRepository interface {
+	// DeleteExpiredIdempotencyKeys deletes keys older than keyTTL and returns how many were deleted
+	DeleteExpiredIdempotencyKeys(ctx context.Context, keyTTL time.Duration) (int64, error)
+}
+
+// OutboxRepository defines the operations used by the outbox relay
+type OutboxRepository interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxEvent, error)
+	MarkOutboxEventSent(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error
+}
@@ -9,12 +9,28 @@ import (
 
 // MessageService defines the interface for message-related business logic
 type MessageService interface {
-	// CreateMessage creates a new message and sends it to Kafka
+	// CreateMessage creates a new message and enqueues it for delivery to Kafka
 	CreateMessage(ctx context.Context, content string) (int64, error)
 
-	// ProcessMessage marks a message as processed
+	// CreateMessageIdempotent creates a message once per idempotency key and reports whether
+	// the result was replayed from an earlier request
+	CreateMessageIdempotent(ctx context.Context, content, idempotencyKey string) (int64, bool, error)
+
+	// ProcessMessage claims a message for processing and marks it as processed
 	ProcessMessage(ctx context.Context, id int64) error
 
+	// FailMessage records a failed processing attempt
+	FailMessage(ctx context.Context, id int64, reason string) error
+
+	// DeadLetterMessage marks a message whose retries were exhausted
+	DeadLetterMessage(ctx context.Context, id int64, reason string) error
+
+	// GetMessage returns a single message by ID
+	GetMessage(ctx context.Context, id int64) (*model.Message, error)
+
+	// ListMessages returns a page of messages matching the filter
+	ListMessages(ctx context.Context, filter model.MessageFilter) (*model.MessagePage, error)
+
 	// GetStatistics returns message statistics
 	GetStatistics(ctx context.Context) (*model.Statistics, error)
 }
@@ -4,25 +4,40 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
 
 	"github.com/segmentio/kafka-go"
 )
 
-// ConsumerImpl implements the interfaces.KafkaConsumer interface for Kafka
+// ConsumerImpl implements the interfaces.KafkaConsumer interface for Kafka.
+// Kafka has no per-message negative acknowledgement and a group reader cannot rewind, so a
+// nacked offset is held: later offsets of the same partition are not committed until the
+// nacked message is delivered again (after a restart or rebalance) and committed.
 type ConsumerImpl struct {
 	reader interfaces.KafkaReader
 	topic  string
+
+	// held maps a partition to its lowest nacked offset
+	mu   sync.Mutex
+	held map[int]int64
 }
 
 // NewConsumer creates a new Kafka consumer
-func NewConsumer(brokers []string, topic string, groupID string) interfaces.KafkaConsumer {
+func NewConsumer(brokers []string, topic string, groupID string, security SecurityConfig) (interfaces.KafkaConsumer, error) {
+	dialer, err := security.newDialer()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create Kafka reader configuration
 	config := kafka.ReaderConfig{
 		Brokers: brokers,
 		Topic:   topic,
 		GroupID: groupID,
+		Dialer:  dialer,
 	}
 
 	// Create Kafka reader
@@ -32,22 +47,130 @@ func NewConsumer(brokers []string, topic string, groupID string) interfaces.Kafk
 	return &ConsumerImpl{
 		reader: reader,
 		topic:  topic,
-	}
+	}, nil
 }
 
 // Ensure ConsumerImpl implements interfaces.KafkaConsumer
 var _ interfaces.KafkaConsumer = (*ConsumerImpl)(nil)
 
-// ReadMessage reads a message from Kafka
-func (c *ConsumerImpl) ReadMessage(ctx context.Context, _ string) ([]byte, error) {
-	// Read a message from Kafka
-	message, err := c.reader.ReadMessage(ctx)
+// FetchMessage reads a message from Kafka without committing its offset
+func (c *ConsumerImpl) FetchMessage(ctx context.Context, _ string) (interfaces.KafkaDelivery, error) {
+	// Fetch a message from Kafka
+	message, err := c.reader.FetchMessage(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read message from Kafka: %w", err)
 	}
 
-	// Return just the message value (payload)
-	return message.Value, nil
+	// Return the payload together with a handle for committing it
+	return &delivery{
+		consumer: c,
+		raw:      message,
+		message:  fromKafkaMessage(message),
+	}, nil
+}
+
+// Commit commits the offsets of several deliveries in a single request
+func (c *ConsumerImpl) Commit(ctx context.Context, deliveries ...interfaces.KafkaDelivery) error {
+	messages := make([]kafka.Message, 0, len(deliveries))
+	for _, d := range deliveries {
+		fetched, ok := d.(*delivery)
+		if !ok || fetched.consumer != c {
+			return fmt.Errorf("delivery was not fetched by this consumer")
+		}
+		messages = append(messages, fetched.raw)
+	}
+	return c.commit(ctx, messages...)
+}
+
+// commit commits the offsets of messages, skipping those behind a nacked offset of their partition
+func (c *ConsumerImpl) commit(ctx context.Context, messages ...kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	commits := messages[:0:0]
+	for _, message := range messages {
+		if held, ok := c.held[message.Partition]; ok {
+			if message.Offset > held {
+				// Committing would also commit the nacked message
+				continue
+			}
+			if message.Offset == held {
+				// The nacked message was delivered again and has now been handled
+				delete(c.held, message.Partition)
+			}
+		}
+		commits = append(commits, message)
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+
+	if err := c.reader.CommitMessages(ctx, commits...); err != nil {
+		return fmt.Errorf("failed to commit message offset: %w", err)
+	}
+	return nil
+}
+
+// nack holds back commits on the partition of a message so that it is delivered again
+func (c *ConsumerImpl) nack(message kafka.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.held == nil {
+		c.held = make(map[int]int64)
+	}
+	if held, ok := c.held[message.Partition]; !ok || message.Offset < held {
+		c.held[message.Partition] = message.Offset
+	}
+}
+
+// delivery implements interfaces.KafkaDelivery for a message fetched by ConsumerImpl
+type delivery struct {
+	consumer *ConsumerImpl
+	raw      kafka.Message
+	message  *model.KafkaMessage
+}
+
+// Ensure delivery implements interfaces.KafkaDelivery
+var _ interfaces.KafkaDelivery = (*delivery)(nil)
+
+// Message returns the fetched message
+func (d *delivery) Message() *model.KafkaMessage {
+	return d.message
+}
+
+// Commit commits the offset of the message
+func (d *delivery) Commit(ctx context.Context) error {
+	return d.consumer.commit(ctx, d.raw)
+}
+
+// Nack leaves the offset of the message uncommitted
+func (d *delivery) Nack(_ context.Context) error {
+	d.consumer.nack(d.raw)
+	return nil
+}
+
+// fromKafkaMessage converts a kafka-go message into a model.KafkaMessage
+func fromKafkaMessage(message kafka.Message) *model.KafkaMessage {
+	var headers map[string]string
+	if len(message.Headers) > 0 {
+		headers = make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			headers[header.Key] = string(header.Value)
+		}
+	}
+
+	return &model.KafkaMessage{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Value:     message.Value,
+		Headers:   headers,
+		Time:      message.Time,
+
+		HighWaterMark: message.HighWaterMark,
+	}
 }
 
 // Close closes the connection to Kafka
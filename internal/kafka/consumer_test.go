@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 
+	"httpchat/internal/interfaces"
+
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,18 +17,23 @@ type MockKafkaReader struct {
 	mock.Mock
 }
 
-func (m *MockKafkaReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+func (m *MockKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
 	args := m.Called(ctx)
 	return args.Get(0).(kafka.Message), args.Error(1)
 }
 
+func (m *MockKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
 func (m *MockKafkaReader) Close() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
-// TestConsumerReadMessage tests the ReadMessage method of ConsumerImpl
-func TestConsumerReadMessage(t *testing.T) {
+// TestConsumerFetchMessage tests the FetchMessage method of ConsumerImpl
+func TestConsumerFetchMessage(t *testing.T) {
 	// Create a mock Kafka reader
 	mockReader := new(MockKafkaReader)
 
@@ -37,21 +44,35 @@ func TestConsumerReadMessage(t *testing.T) {
 
 	// Set up expectations
 	expectedMessage := kafka.Message{
-		Value: []byte("test message"),
+		Topic:     "test-topic",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("7"),
+		Value:     []byte("test message"),
+		Headers:   []kafka.Header{{Key: "x-attempts", Value: []byte("3")}},
 	}
-	mockReader.On("ReadMessage", mock.Anything).Return(expectedMessage, nil)
+	mockReader.On("FetchMessage", mock.Anything).Return(expectedMessage, nil)
 
 	// Test reading a message
-	messageBytes, err := consumer.ReadMessage(context.Background(), "test-topic")
+	delivery, err := consumer.FetchMessage(context.Background(), "test-topic")
 	assert.NoError(t, err)
-	assert.Equal(t, []byte("test message"), messageBytes)
+	message := delivery.Message()
+	assert.Equal(t, []byte("test message"), message.Value)
+	assert.Equal(t, "test-topic", message.Topic)
+	assert.Equal(t, 2, message.Partition)
+	assert.Equal(t, int64(42), message.Offset)
+	assert.Equal(t, []byte("7"), message.Key)
+	assert.Equal(t, map[string]string{"x-attempts": "3"}, message.Headers)
+
+	// Test that fetching does not commit the offset
+	mockReader.AssertNotCalled(t, "CommitMessages", mock.Anything, mock.Anything)
 
 	// Verify expectations
 	mockReader.AssertExpectations(t)
 }
 
-// TestConsumerReadMessageError tests the ReadMessage method error handling
-func TestConsumerReadMessageError(t *testing.T) {
+// TestConsumerFetchMessageError tests the FetchMessage method error handling
+func TestConsumerFetchMessageError(t *testing.T) {
 	// Create a mock Kafka reader
 	mockReader := new(MockKafkaReader)
 
@@ -62,10 +83,10 @@ func TestConsumerReadMessageError(t *testing.T) {
 
 	// Set up expectations
 	expectedError := errors.New("kafka read error")
-	mockReader.On("ReadMessage", mock.Anything).Return(kafka.Message{}, expectedError)
+	mockReader.On("FetchMessage", mock.Anything).Return(kafka.Message{}, expectedError)
 
 	// Test reading a message with error
-	_, err := consumer.ReadMessage(context.Background(), "test-topic")
+	_, err := consumer.FetchMessage(context.Background(), "test-topic")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to read message from Kafka")
 
@@ -73,6 +94,143 @@ func TestConsumerReadMessageError(t *testing.T) {
 	mockReader.AssertExpectations(t)
 }
 
+// TestConsumerCommit tests that Commit commits the offset of the fetched message
+func TestConsumerCommit(t *testing.T) {
+	// Create a mock Kafka reader
+	mockReader := new(MockKafkaReader)
+
+	// Create a consumer with the mock reader
+	consumer := &ConsumerImpl{
+		reader: mockReader,
+	}
+
+	// Set up expectations
+	message := kafka.Message{Topic: "test-topic", Partition: 1, Offset: 7, Value: []byte("test message")}
+	mockReader.On("FetchMessage", mock.Anything).Return(message, nil)
+	mockReader.On("CommitMessages", mock.Anything, []kafka.Message{message}).Return(nil)
+
+	// Test committing a fetched message
+	delivery, err := consumer.FetchMessage(context.Background(), "test-topic")
+	assert.NoError(t, err)
+	assert.NoError(t, delivery.Commit(context.Background()))
+
+	// Verify expectations
+	mockReader.AssertExpectations(t)
+}
+
+// TestConsumerCommitError tests the Commit method error handling
+func TestConsumerCommitError(t *testing.T) {
+	// Create a mock Kafka reader
+	mockReader := new(MockKafkaReader)
+
+	// Create a consumer with the mock reader
+	consumer := &ConsumerImpl{
+		reader: mockReader,
+	}
+
+	// Set up expectations
+	mockReader.On("FetchMessage", mock.Anything).Return(kafka.Message{Offset: 7}, nil)
+	mockReader.On("CommitMessages", mock.Anything, mock.Anything).Return(errors.New("kafka commit error"))
+
+	// Test committing a message with error
+	delivery, err := consumer.FetchMessage(context.Background(), "test-topic")
+	assert.NoError(t, err)
+	err = delivery.Commit(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to commit message offset")
+
+	// Verify expectations
+	mockReader.AssertExpectations(t)
+}
+
+// TestConsumerNack tests that a nacked offset holds back later commits of its partition
+func TestConsumerNack(t *testing.T) {
+	// Create a mock Kafka reader
+	mockReader := new(MockKafkaReader)
+
+	// Create a consumer with the mock reader
+	consumer := &ConsumerImpl{
+		reader: mockReader,
+	}
+
+	nacked := kafka.Message{Partition: 0, Offset: 10}
+	later := kafka.Message{Partition: 0, Offset: 11}
+	otherPartition := kafka.Message{Partition: 1, Offset: 11}
+
+	// Set up expectations
+	mockReader.On("FetchMessage", mock.Anything).Return(nacked, nil).Once()
+	mockReader.On("FetchMessage", mock.Anything).Return(later, nil).Once()
+	mockReader.On("FetchMessage", mock.Anything).Return(otherPartition, nil).Once()
+	mockReader.On("FetchMessage", mock.Anything).Return(nacked, nil).Once()
+	mockReader.On("CommitMessages", mock.Anything, []kafka.Message{otherPartition}).Return(nil).Once()
+	mockReader.On("CommitMessages", mock.Anything, []kafka.Message{nacked}).Return(nil).Once()
+
+	ctx := context.Background()
+	fetch := func() interfaces.KafkaDelivery {
+		delivery, err := consumer.FetchMessage(ctx, "test-topic")
+		assert.NoError(t, err)
+		return delivery
+	}
+
+	// Test that nacking does not commit
+	assert.NoError(t, fetch().Nack(ctx))
+
+	// Test that later offsets of the same partition are not committed
+	assert.NoError(t, fetch().Commit(ctx))
+
+	// Test that other partitions are committed as usual
+	assert.NoError(t, fetch().Commit(ctx))
+
+	// Test that committing the redelivered message releases the partition
+	assert.NoError(t, fetch().Commit(ctx))
+	assert.Empty(t, consumer.held)
+
+	// Verify expectations
+	mockReader.AssertExpectations(t)
+	mockReader.AssertNumberOfCalls(t, "CommitMessages", 2)
+}
+
+// TestConsumerCommitBatch tests that several deliveries are committed in one request
+func TestConsumerCommitBatch(t *testing.T) {
+	// Create a mock Kafka reader
+	mockReader := new(MockKafkaReader)
+
+	// Create a consumer with the mock reader
+	consumer := &ConsumerImpl{
+		reader: mockReader,
+	}
+
+	first := kafka.Message{Partition: 0, Offset: 10}
+	nacked := kafka.Message{Partition: 0, Offset: 11}
+	later := kafka.Message{Partition: 0, Offset: 12}
+	otherPartition := kafka.Message{Partition: 1, Offset: 4}
+
+	// Set up expectations
+	for _, message := range []kafka.Message{first, nacked, later, otherPartition} {
+		mockReader.On("FetchMessage", mock.Anything).Return(message, nil).Once()
+	}
+	mockReader.On("CommitMessages", mock.Anything, []kafka.Message{first, otherPartition}).Return(nil).Once()
+
+	ctx := context.Background()
+	var deliveries []interfaces.KafkaDelivery
+	for i := 0; i < 4; i++ {
+		delivery, err := consumer.FetchMessage(ctx, "test-topic")
+		assert.NoError(t, err)
+		deliveries = append(deliveries, delivery)
+	}
+	assert.NoError(t, deliveries[1].Nack(ctx))
+
+	// Test that offsets behind the nacked one are left out of the batch
+	assert.NoError(t, consumer.Commit(ctx, deliveries[0], deliveries[2], deliveries[3]))
+
+	// Test that deliveries of another consumer are rejected
+	assert.Error(t, consumer.Commit(ctx, deliveries[0], &delivery{consumer: &ConsumerImpl{}}))
+
+	// Verify expectations
+	mockReader.AssertExpectations(t)
+	mockReader.AssertNumberOfCalls(t, "CommitMessages", 1)
+}
+
 // TestConsumerClose tests the Close method of ConsumerImpl
 func TestConsumerClose(t *testing.T) {
 	// Create a mock Kafka reader
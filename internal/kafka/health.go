@@ -0,0 +1,33 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BrokerCheck returns a check that connects to the brokers in turn until one accepts,
+// with the TLS and SASL settings of the producer and consumer
+func BrokerCheck(brokers []string, security SecurityConfig) (func(ctx context.Context) error, error) {
+	dialer, err := security.newDialer()
+	if err != nil {
+		return nil, err
+	}
+	if dialer == nil {
+		dialer = &kafka.Dialer{Timeout: dialTimeout, DualStack: true}
+	}
+
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, broker := range brokers {
+			conn, err := dialer.DialContext(ctx, "tcp", broker)
+			if err == nil {
+				return conn.Close()
+			}
+			errs = append(errs, err)
+		}
+		return fmt.Errorf("no Kafka broker is reachable: %w", errors.Join(errs...))
+	}, nil
+}
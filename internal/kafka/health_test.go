@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBrokerCheck tests that the check passes once any broker accepts a connection
+func TestBrokerCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen:", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	// An address nothing listens on, taken from a closed listener
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen:", err)
+	}
+	unreachable := closed.Addr().String()
+	_ = closed.Close()
+
+	check, err := BrokerCheck([]string{unreachable, listener.Addr().String()}, SecurityConfig{})
+	if assert.NoError(t, err) {
+		assert.NoError(t, check(context.Background()))
+	}
+
+	check, err = BrokerCheck([]string{unreachable}, SecurityConfig{})
+	if assert.NoError(t, err) {
+		err = check(context.Background())
+		assert.ErrorContains(t, err, "no Kafka broker is reachable")
+		assert.ErrorContains(t, err, unreachable)
+	}
+
+	// Invalid settings are rejected up front
+	_, err = BrokerCheck([]string{listener.Addr().String()}, SecurityConfig{SASLMechanism: "plain"})
+	assert.Error(t, err)
+}
@@ -1,15 +1,23 @@
 package kafka
 
-import "context"
+import (
+	"context"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+)
 
 // Producer defines the interface for sending messages to Kafka
 type Producer interface {
 	SendMessage(ctx context.Context, topic string, message []byte) error
+	SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error
+	SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error
+	SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) error
 	Close() error
 }
 
 // Consumer defines the interface for reading messages from Kafka
 type Consumer interface {
-	ReadMessage(ctx context.Context, topic string) ([]byte, error)
+	FetchMessage(ctx context.Context, topic string) (interfaces.KafkaDelivery, error)
 	Close() error
 }
\ No newline at end of file
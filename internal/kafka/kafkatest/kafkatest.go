@@ -0,0 +1,256 @@
+// Package kafkatest provides an in-memory Kafka producer and consumer, so that tests can
+// assert on what is sent to the broker and which offsets are settled.
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+)
+
+// Producer records every message it is asked to send. Its fields configure the failures
+// and must be set before the producer is used.
+type Producer struct {
+	// Err fails every send; SendMessages returns it for the whole batch
+	Err error
+	// Failures fails the first sends, or every send if negative
+	Failures int
+	// FailOn fails the sends of this payload; SendMessages reports them in a model.BatchSendError
+	FailOn string
+
+	mu      sync.Mutex
+	sent    []*model.KafkaMessage
+	calls   int
+	batches int
+}
+
+// SendMessage records a message without a key or headers
+func (p *Producer) SendMessage(ctx context.Context, topic string, message []byte) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, nil)
+}
+
+// SendMessages records a batch of messages
+func (p *Producer) SendMessages(_ context.Context, topic string, messages []*model.KafkaMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.batches++
+	if p.Err != nil {
+		return p.Err
+	}
+
+	batchErr := make(model.BatchSendError, len(messages))
+	failed := false
+	for i, message := range messages {
+		if err := p.send(topic, message.Key, message.Value, message.Headers); err != nil {
+			batchErr[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return batchErr
+	}
+	return nil
+}
+
+// SendMessageWithHeaders records a message without a key
+func (p *Producer) SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, headers)
+}
+
+// SendMessageWithKey records a message
+func (p *Producer) SendMessageWithKey(_ context.Context, topic string, key, message []byte, headers map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.send(topic, key, message, headers)
+}
+
+// send records a message unless the configured failures fail it. p.mu must be held.
+func (p *Producer) send(topic string, key, value []byte, headers map[string]string) error {
+	p.calls++
+	switch {
+	case p.Err != nil:
+		return p.Err
+	case p.Failures < 0 || p.calls <= p.Failures:
+		return errors.New("kafka unavailable")
+	case p.FailOn != "" && string(value) == p.FailOn:
+		return errors.New("kafka write error")
+	}
+	p.sent = append(p.sent, &model.KafkaMessage{Topic: topic, Key: key, Value: value, Headers: headers})
+	return nil
+}
+
+// Close does nothing
+func (p *Producer) Close() error {
+	return nil
+}
+
+// Sent returns the messages that were sent successfully
+func (p *Producer) Sent() []*model.KafkaMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*model.KafkaMessage(nil), p.sent...)
+}
+
+// Calls returns the number of messages the producer was asked to send, including failed ones
+func (p *Producer) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// Batches returns the number of SendMessages calls
+func (p *Producer) Batches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.batches
+}
+
+// Ensure Producer implements interfaces.KafkaProducer
+var _ interfaces.KafkaProducer = (*Producer)(nil)
+
+// Consumer returns the queued messages in order and then blocks until the context is
+// done. Its fields must be set before the consumer is used.
+type Consumer struct {
+	// JoinDelay delays the first fetch, like a real consumer joining its group
+	JoinDelay time.Duration
+	// BeforeCommit runs at the start of every Commit call
+	BeforeCommit func()
+
+	mu        sync.Mutex
+	joined    bool
+	messages  []*model.KafkaMessage
+	committed []int64
+	nacked    []int64
+	batches   [][]int64
+	closed    bool
+}
+
+// NewConsumer creates a Consumer that returns messages
+func NewConsumer(messages ...*model.KafkaMessage) *Consumer {
+	return &Consumer{messages: messages}
+}
+
+// Messages builds messages of topic with the given values, numbering their offsets from zero
+func Messages(topic string, values ...[]byte) []*model.KafkaMessage {
+	messages := make([]*model.KafkaMessage, len(values))
+	for i, value := range values {
+		messages[i] = &model.KafkaMessage{Topic: topic, Offset: int64(i), Value: value}
+	}
+	return messages
+}
+
+// FetchMessage returns the next queued message
+func (c *Consumer) FetchMessage(ctx context.Context, _ string) (interfaces.KafkaDelivery, error) {
+	c.mu.Lock()
+	joined := c.joined
+	c.mu.Unlock()
+	if !joined {
+		select {
+		case <-time.After(c.JoinDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+		c.joined = true
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	if len(c.messages) == 0 {
+		c.mu.Unlock()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	message := c.messages[0]
+	c.messages = c.messages[1:]
+	c.mu.Unlock()
+	return &delivery{consumer: c, message: message}, nil
+}
+
+// Commit records the offsets of deliveries as one batch
+func (c *Consumer) Commit(_ context.Context, deliveries ...interfaces.KafkaDelivery) error {
+	if c.BeforeCommit != nil {
+		c.BeforeCommit()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var batch []int64
+	for _, delivery := range deliveries {
+		batch = append(batch, delivery.Message().Offset)
+	}
+	c.committed = append(c.committed, batch...)
+	c.batches = append(c.batches, batch)
+	return nil
+}
+
+// Close records that the consumer was closed
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// Settled returns the offsets that were committed and nacked
+func (c *Consumer) Settled() (committed, nacked []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int64(nil), c.committed...), append([]int64(nil), c.nacked...)
+}
+
+// Batches returns the offsets committed by every Commit call
+func (c *Consumer) Batches() [][]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]int64(nil), c.batches...)
+}
+
+// Remaining returns the number of messages that have not been fetched yet
+func (c *Consumer) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.messages)
+}
+
+// Closed reports whether the consumer was closed
+func (c *Consumer) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Ensure Consumer implements interfaces.KafkaConsumer
+var _ interfaces.KafkaConsumer = (*Consumer)(nil)
+
+// delivery records whether its message was committed or nacked
+type delivery struct {
+	consumer *Consumer
+	message  *model.KafkaMessage
+}
+
+func (d *delivery) Message() *model.KafkaMessage {
+	return d.message
+}
+
+func (d *delivery) Commit(_ context.Context) error {
+	d.consumer.mu.Lock()
+	defer d.consumer.mu.Unlock()
+	d.consumer.committed = append(d.consumer.committed, d.message.Offset)
+	return nil
+}
+
+func (d *delivery) Nack(_ context.Context) error {
+	d.consumer.mu.Lock()
+	defer d.consumer.mu.Unlock()
+	d.consumer.nacked = append(d.consumer.nacked, d.message.Offset)
+	return nil
+}
+
+// Ensure delivery implements interfaces.KafkaDelivery
+var _ interfaces.KafkaDelivery = (*delivery)(nil)
@@ -3,25 +3,141 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/tracing"
 
 	"github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ProducerImpl implements the interfaces.KafkaProducer interface for Kafka
+// ProducerImpl implements the interfaces.KafkaProducer interface for Kafka.
+// In async mode its sends return once the messages are queued and only
+// ProducerConfig.OnDelivery learns whether Kafka stored them.
 type ProducerImpl struct {
 	writer interfaces.KafkaWriter
 }
 
+// ProducerConfig configures the writer of the Kafka producer
+type ProducerConfig struct {
+	// BatchSize is the most messages sent to a partition in one request
+	BatchSize int
+	// BatchTimeout bounds how long the writer waits to fill a batch before sending it.
+	// Sync writes wait for it, so a long timeout caps every caller at one write per timeout.
+	BatchTimeout time.Duration
+	// RequiredAcks is all, one or none
+	RequiredAcks string
+	// Compression is none, gzip, snappy, lz4 or zstd
+	Compression string
+	// Balancer is murmur2, hash, crc32, round-robin or least-bytes. Only the first three
+	// send messages with the same key to the same partition.
+	Balancer string
+	// Async makes sends return once the messages are queued, before Kafka stored them.
+	// Only for fire-and-forget sends: a nil error does not mean the messages were delivered.
+	Async bool
+	// OnDelivery reports the outcome of every batch written in async mode
+	OnDelivery DeliveryReport
+}
+
+// DeliveryReport is called with the messages of a batch written in async mode and the
+// error that failed them, or nil once Kafka stored them
+type DeliveryReport func(messages []*model.KafkaMessage, err error)
+
+// DefaultProducerConfig returns the settings used when nothing else is configured
+func DefaultProducerConfig() ProducerConfig {
+	return ProducerConfig{
+		BatchSize:    100,
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: "all",
+		Compression:  "none",
+		Balancer:     "murmur2",
+	}
+}
+
+// Values accepted by ProducerConfig
+var (
+	requiredAcks = map[string]kafka.RequiredAcks{
+		"all":  kafka.RequireAll,
+		"one":  kafka.RequireOne,
+		"none": kafka.RequireNone,
+	}
+	compressionCodecs = map[string]kafka.Compression{
+		"none":   0,
+		"gzip":   kafka.Gzip,
+		"snappy": kafka.Snappy,
+		"lz4":    kafka.Lz4,
+		"zstd":   kafka.Zstd,
+	}
+	balancers = map[string]func() kafka.Balancer{
+		// The partition the Java client would pick for the key
+		"murmur2":     func() kafka.Balancer { return &kafka.Murmur2Balancer{} },
+		"hash":        func() kafka.Balancer { return &kafka.Hash{} },
+		"crc32":       func() kafka.Balancer { return &kafka.CRC32Balancer{} },
+		"round-robin": func() kafka.Balancer { return &kafka.RoundRobin{} },
+		"least-bytes": func() kafka.Balancer { return &kafka.LeastBytes{} },
+	}
+)
+
 // NewProducer creates a new ProducerImpl instance
-func NewProducer(brokers []string) interfaces.KafkaProducer {
-	return &ProducerImpl{
-		writer: &kafka.Writer{
-			Addr: kafka.TCP(brokers...),
-		},
+func NewProducer(brokers []string, cfg ProducerConfig, security SecurityConfig) (interfaces.KafkaProducer, error) {
+	writer, err := newWriter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	writer.Addr = kafka.TCP(brokers...)
+
+	// Leave the default transport in place when the connection is not secured
+	transport, err := security.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		writer.Transport = transport
+	}
+
+	return &ProducerImpl{writer: writer}, nil
+}
+
+// newWriter builds a kafka-go writer from the producer settings
+func newWriter(cfg ProducerConfig) (*kafka.Writer, error) {
+	acks, ok := requiredAcks[cfg.RequiredAcks]
+	if !ok {
+		return nil, fmt.Errorf("unknown Kafka required acks %q", cfg.RequiredAcks)
 	}
+	codec, ok := compressionCodecs[cfg.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown Kafka compression codec %q", cfg.Compression)
+	}
+	newBalancer, ok := balancers[cfg.Balancer]
+	if !ok {
+		return nil, fmt.Errorf("unknown Kafka balancer %q", cfg.Balancer)
+	}
+
+	writer := &kafka.Writer{
+		BatchSize:    cfg.BatchSize,
+		BatchTimeout: cfg.BatchTimeout,
+		RequiredAcks: acks,
+		Compression:  codec,
+		Balancer:     newBalancer(),
+		Async:        cfg.Async,
+	}
+	if cfg.Async && cfg.OnDelivery != nil {
+		report := cfg.OnDelivery
+		writer.Completion = func(messages []kafka.Message, err error) {
+			delivered := make([]*model.KafkaMessage, len(messages))
+			for i, message := range messages {
+				delivered[i] = fromKafkaMessage(message)
+			}
+			report(delivered, err)
+		}
+	}
+	return writer, nil
 }
 
 // Ensure ProducerImpl implements interfaces.KafkaProducer
@@ -29,14 +145,77 @@ var _ interfaces.KafkaProducer = (*ProducerImpl)(nil)
 
 // SendMessage sends a message to Kafka
 func (p *ProducerImpl) SendMessage(ctx context.Context, topic string, message []byte) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, nil)
+}
+
+// SendMessages sends a batch of messages to Kafka in a single write
+func (p *ProducerImpl) SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	kafkaMessages := make([]kafka.Message, len(messages))
+	spans := make([]trace.Span, len(messages))
+	for i, message := range messages {
+		var headers map[string]string
+		headers, spans[i] = startPublishSpan(ctx, topic, message.Headers)
+		kafkaMessages[i] = kafka.Message{
+			Topic:   topic,
+			Key:     message.Key,
+			Value:   message.Value,
+			Headers: toKafkaHeaders(headers),
+		}
+	}
+
+	// Send the whole batch to the specified Kafka topic
+	err := p.writer.WriteMessages(ctx, kafkaMessages...)
+	if err == nil {
+		for _, span := range spans {
+			span.End()
+		}
+		return nil
+	}
+
+	// Report which messages failed when the writer tells us
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == len(messages) {
+		batchErr := make(model.BatchSendError, len(writeErrs))
+		for i, writeErr := range writeErrs {
+			if writeErr != nil {
+				batchErr[i] = fmt.Errorf("failed to write message to Kafka: %w", writeErr)
+			}
+			tracing.End(spans[i], batchErr[i])
+		}
+		return batchErr
+	}
+
+	err = fmt.Errorf("failed to write messages to Kafka: %w", err)
+	for _, span := range spans {
+		tracing.End(span, err)
+	}
+	return err
+}
+
+// SendMessageWithHeaders sends a message with the given headers to Kafka
+func (p *ProducerImpl) SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, headers)
+}
+
+// SendMessageWithKey sends a message with the given key and headers to Kafka. The writer
+// picks the partition from the key, so messages with the same key stay in order.
+func (p *ProducerImpl) SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) (err error) {
+	headers, span := startPublishSpan(ctx, topic, headers)
+	defer func() { tracing.End(span, err) }()
+
 	// Send the message to the specified Kafka topic
-	err := p.writer.WriteMessages(ctx,
+	err = p.writer.WriteMessages(ctx,
 		kafka.Message{
-			Topic: topic,
-			Value: message,
+			Topic:   topic,
+			Key:     key,
+			Value:   message,
+			Headers: toKafkaHeaders(headers),
 		},
 	)
-
 	if err != nil {
 		return fmt.Errorf("failed to write message to Kafka: %w", err)
 	}
@@ -44,6 +223,48 @@ func (p *ProducerImpl) SendMessage(ctx context.Context, topic string, message []
 	return nil
 }
 
+// startPublishSpan starts the producer span of a message and returns a copy of headers
+// that carries its W3C trace context, which the consumer continues. A trace context
+// already in headers, such as the one the outbox stored with an event, takes precedence
+// over the one of ctx.
+func startPublishSpan(ctx context.Context, topic string, headers map[string]string) (map[string]string, trace.Span) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, headers), topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingOperationTypePublish,
+		),
+	)
+
+	traced := make(map[string]string, len(headers)+1)
+	for key, value := range headers {
+		traced[key] = value
+	}
+	tracing.Inject(ctx, traced)
+	return traced, span
+}
+
+// toKafkaHeaders converts headers into kafka-go headers
+func toKafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	// Sort header keys so the produced record does not depend on map iteration order
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kafkaHeaders := make([]kafka.Header, 0, len(keys))
+	for _, key := range keys {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: key, Value: []byte(headers[key])})
+	}
+	return kafkaHeaders
+}
+
 // Close closes the connection to Kafka
 func (p *ProducerImpl) Close() error {
 	// Close the Kafka writer connection
@@ -0,0 +1,222 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"httpchat/internal/model"
+
+	"github.com/segmentio/kafka-go"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// fakeTransport stands in for a Kafka broker behind a network with the given round trip
+// latency. Produce requests are encoded as they would be on the wire, which applies the
+// compression codec, and are answered with errorCode. produced counts the partition
+// batches written.
+type fakeTransport struct {
+	partitions int
+	latency    time.Duration
+	errorCode  kafka.Error
+
+	mu       sync.Mutex
+	produced int
+}
+
+func (f *fakeTransport) RoundTrip(ctx context.Context, _ net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch r := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{
+			Brokers: []metadataAPI.ResponseBroker{{NodeID: 0, Host: "localhost", Port: 9092}},
+		}
+		for _, name := range r.TopicNames {
+			topic := metadataAPI.ResponseTopic{Name: name}
+			for i := 0; i < f.partitions; i++ {
+				topic.Partitions = append(topic.Partitions, metadataAPI.ResponsePartition{PartitionIndex: int32(i)})
+			}
+			res.Topics = append(res.Topics, topic)
+		}
+		return res, nil
+
+	case *produceAPI.Request:
+		select {
+		case <-time.After(f.latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		res := &produceAPI.Response{}
+		for _, topic := range r.Topics {
+			resTopic := produceAPI.ResponseTopic{Topic: topic.Topic}
+			for _, partition := range topic.Partitions {
+				records := partition.RecordSet
+				records.Version = 2
+				if _, err := records.WriteTo(io.Discard); err != nil {
+					return nil, err
+				}
+
+				f.mu.Lock()
+				f.produced++
+				f.mu.Unlock()
+
+				resTopic.Partitions = append(resTopic.Partitions, produceAPI.ResponsePartition{
+					Partition: partition.Partition,
+					ErrorCode: int16(f.errorCode),
+				})
+			}
+			res.Topics = append(res.Topics, resTopic)
+		}
+		return res, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected request %T", req)
+	}
+}
+
+// newFakeProducer creates a producer that writes to a fake broker
+func newFakeProducer(tb testing.TB, transport *fakeTransport, cfg ProducerConfig) *ProducerImpl {
+	tb.Helper()
+
+	writer, err := newWriter(cfg)
+	if err != nil {
+		tb.Fatal("Failed to create writer:", err)
+	}
+	writer.Addr = kafka.TCP("localhost:9092")
+	writer.Transport = transport
+	return &ProducerImpl{writer: writer}
+}
+
+// benchmarkPayload is an event of the size the service produces
+var benchmarkPayload = func() []byte {
+	envelope, _ := model.NewMessageCreatedEvent(&model.Message{ID: 1, Content: "Hello, this is a chat message of a typical length"}, time.Now())
+	payload, _ := envelope.Encode()
+	return payload
+}()
+
+// reportThroughput records how many messages per second the benchmark sent
+func reportThroughput(b *testing.B, messages int) {
+	b.ReportMetric(float64(messages)/b.Elapsed().Seconds(), "msgs/s")
+}
+
+// The throughput benchmarks simulate a broker one millisecond away
+const benchmarkLatency = time.Millisecond
+
+// BenchmarkProducerSync sends one message at a time and waits for each, as the DLQ publisher does.
+// Every send waits for the batch timeout, so throughput is bound by it and the latency.
+func BenchmarkProducerSync(b *testing.B) {
+	producer := newFakeProducer(b, &fakeTransport{partitions: 4, latency: benchmarkLatency}, DefaultProducerConfig())
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := producer.SendMessageWithKey(ctx, "messages", model.MessageEventKey(int64(i)), benchmarkPayload, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportThroughput(b, b.N)
+	_ = producer.Close()
+}
+
+// BenchmarkProducerSyncParallel sends single messages from many goroutines, whose writes
+// share batches
+func BenchmarkProducerSyncParallel(b *testing.B) {
+	producer := newFakeProducer(b, &fakeTransport{partitions: 4, latency: benchmarkLatency}, DefaultProducerConfig())
+	ctx := context.Background()
+	var key atomic.Int64
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := producer.SendMessageWithKey(ctx, "messages", model.MessageEventKey(key.Add(1)), benchmarkPayload, nil); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	reportThroughput(b, b.N)
+	_ = producer.Close()
+}
+
+// BenchmarkProducerBatch sends batches of 100 messages, as the outbox relay does
+func BenchmarkProducerBatch(b *testing.B) {
+	producer := newFakeProducer(b, &fakeTransport{partitions: 4, latency: benchmarkLatency}, DefaultProducerConfig())
+	ctx := context.Background()
+
+	batch := make([]*model.KafkaMessage, 100)
+	for i := range batch {
+		batch[i] = &model.KafkaMessage{Key: model.MessageEventKey(int64(i)), Value: benchmarkPayload}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := producer.SendMessages(ctx, "messages", batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportThroughput(b, b.N*len(batch))
+	_ = producer.Close()
+}
+
+// BenchmarkProducerAsync sends one message at a time without waiting for Kafka. The
+// benchmark includes waiting for the last deliveries on close.
+func BenchmarkProducerAsync(b *testing.B) {
+	var delivered atomic.Int64
+	cfg := DefaultProducerConfig()
+	cfg.Async = true
+	cfg.OnDelivery = func(messages []*model.KafkaMessage, err error) {
+		if err != nil {
+			b.Error(err)
+		}
+		delivered.Add(int64(len(messages)))
+	}
+	producer := newFakeProducer(b, &fakeTransport{partitions: 4, latency: benchmarkLatency}, cfg)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := producer.SendMessageWithKey(ctx, "messages", model.MessageEventKey(int64(i)), benchmarkPayload, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	_ = producer.Close()
+	reportThroughput(b, b.N)
+
+	if delivered.Load() != int64(b.N) {
+		b.Fatalf("delivered %d of %d messages", delivered.Load(), b.N)
+	}
+}
+
+// BenchmarkProducerCompression measures the cost of encoding batches with each codec
+func BenchmarkProducerCompression(b *testing.B) {
+	for _, codec := range []string{"none", "gzip", "snappy", "lz4", "zstd"} {
+		b.Run(codec, func(b *testing.B) {
+			cfg := DefaultProducerConfig()
+			cfg.Compression = codec
+			producer := newFakeProducer(b, &fakeTransport{partitions: 1}, cfg)
+			ctx := context.Background()
+
+			batch := make([]*model.KafkaMessage, 100)
+			for i := range batch {
+				batch[i] = &model.KafkaMessage{Key: model.MessageEventKey(int64(i)), Value: benchmarkPayload}
+			}
+
+			b.SetBytes(int64(len(batch) * len(benchmarkPayload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := producer.SendMessages(ctx, "messages", batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportThroughput(b, b.N*len(batch))
+			_ = producer.Close()
+		})
+	}
+}
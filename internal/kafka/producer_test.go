@@ -3,11 +3,18 @@ package kafka
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
+
+	"httpchat/internal/model"
+	"httpchat/internal/tracing"
+	"httpchat/internal/tracing/tracingtest"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MockKafkaWriter is a mock implementation of interfaces.KafkaWriter for testing
@@ -69,6 +76,152 @@ func TestProducerSendMessageError(t *testing.T) {
 	mockWriter.AssertExpectations(t)
 }
 
+// TestProducerSendMessages tests that a batch is written in a single call
+func TestProducerSendMessages(t *testing.T) {
+	// Create a mock Kafka writer
+	mockWriter := new(MockKafkaWriter)
+
+	// Create a producer with the mock writer
+	producer := &ProducerImpl{
+		writer: mockWriter,
+	}
+
+	// Set up expectations
+	mockWriter.On("WriteMessages", mock.Anything, mock.MatchedBy(func(msgs []kafka.Message) bool {
+		return len(msgs) == 2 && msgs[0].Topic == "test-topic" && string(msgs[1].Value) == "second" &&
+			string(msgs[0].Key) == "1" && msgs[1].Key == nil &&
+			assert.ObjectsAreEqual([]kafka.Header{{Key: "content-type", Value: []byte("application/json")}}, msgs[0].Headers)
+	})).Return(nil).Once()
+
+	// Test sending a batch
+	err := producer.SendMessages(context.Background(), "test-topic", []*model.KafkaMessage{
+		{Key: []byte("1"), Value: []byte("first"), Headers: map[string]string{"content-type": "application/json"}},
+		{Value: []byte("second")},
+	})
+	assert.NoError(t, err)
+
+	// Verify expectations
+	mockWriter.AssertExpectations(t)
+}
+
+// TestProducerSendMessagesPartialFailure tests that per-message write errors are reported
+func TestProducerSendMessagesPartialFailure(t *testing.T) {
+	// Create a mock Kafka writer
+	mockWriter := new(MockKafkaWriter)
+
+	// Create a producer with the mock writer
+	producer := &ProducerImpl{
+		writer: mockWriter,
+	}
+
+	// Set up expectations
+	mockWriter.On("WriteMessages", mock.Anything, mock.Anything).Return(kafka.WriteErrors{nil, errors.New("leader not available")})
+
+	// Test that only the second message is reported as failed
+	err := producer.SendMessages(context.Background(), "test-topic", []*model.KafkaMessage{{Value: []byte("first")}, {Value: []byte("second")}})
+	var batchErr model.BatchSendError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.NoError(t, batchErr[0])
+		assert.ErrorContains(t, batchErr[1], "leader not available")
+	}
+
+	// Verify expectations
+	mockWriter.AssertExpectations(t)
+}
+
+// TestProducerSendMessageWithHeaders tests that headers are attached to the written message
+func TestProducerSendMessageWithHeaders(t *testing.T) {
+	// Create a mock Kafka writer
+	mockWriter := new(MockKafkaWriter)
+
+	// Create a producer with the mock writer
+	producer := &ProducerImpl{
+		writer: mockWriter,
+	}
+
+	// Set up expectations
+	expectedHeaders := []kafka.Header{
+		{Key: "x-attempts", Value: []byte("4")},
+		{Key: "x-error", Value: []byte("boom")},
+	}
+	mockWriter.On("WriteMessages", mock.Anything, mock.MatchedBy(func(msgs []kafka.Message) bool {
+		return len(msgs) == 1 && msgs[0].Topic == "test-topic.dlq" && assert.ObjectsAreEqual(expectedHeaders, msgs[0].Headers)
+	})).Return(nil)
+
+	// Test sending a message with headers
+	err := producer.SendMessageWithHeaders(context.Background(), "test-topic.dlq", []byte("test message"), map[string]string{
+		"x-error":    "boom",
+		"x-attempts": "4",
+	})
+	assert.NoError(t, err)
+
+	// Verify expectations
+	mockWriter.AssertExpectations(t)
+}
+
+// TestProducerSendMessageWithKey tests that the key is written with the message
+func TestProducerSendMessageWithKey(t *testing.T) {
+	// Create a mock Kafka writer
+	mockWriter := new(MockKafkaWriter)
+
+	// Create a producer with the mock writer
+	producer := &ProducerImpl{
+		writer: mockWriter,
+	}
+
+	// Set up expectations
+	mockWriter.On("WriteMessages", mock.Anything, mock.MatchedBy(func(msgs []kafka.Message) bool {
+		return len(msgs) == 1 && string(msgs[0].Key) == "42" && string(msgs[0].Value) == "test message" && msgs[0].Headers == nil
+	})).Return(nil)
+
+	// Test sending a keyed message
+	err := producer.SendMessageWithKey(context.Background(), "test-topic", []byte("42"), []byte("test message"), nil)
+	assert.NoError(t, err)
+
+	// Verify expectations
+	mockWriter.AssertExpectations(t)
+}
+
+// TestProducerTraceContext tests that every message carries the trace context of its
+// producer span, which continues the trace stored with the message or else the one of ctx
+func TestProducerTraceContext(t *testing.T) {
+	exporter := tracingtest.Install(t)
+
+	// Capture the written messages
+	var written []kafka.Message
+	mockWriter := new(MockKafkaWriter)
+	mockWriter.On("WriteMessages", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		written = append(written, args.Get(1).([]kafka.Message)...)
+	}).Return(nil)
+	producer := &ProducerImpl{writer: mockWriter}
+
+	ctx, request := tracing.Tracer().Start(context.Background(), "request")
+	stored := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	assert.NoError(t, producer.SendMessageWithKey(ctx, "messages.dlq", []byte("1"), []byte("value"), nil))
+	assert.NoError(t, producer.SendMessages(ctx, "messages", []*model.KafkaMessage{
+		{Value: []byte("stored"), Headers: map[string]string{"traceparent": stored}},
+	}))
+	request.End()
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, written, 2) && assert.Len(t, spans, 3) {
+		for i, name := range []string{"messages.dlq publish", "messages publish"} {
+			span, ok := tracingtest.SpanNamed(exporter, name)
+			if assert.True(t, ok, name) {
+				assert.Equal(t, trace.SpanKindProducer, span.SpanKind)
+				remote := trace.SpanContextFromContext(tracing.Extract(context.Background(), fromKafkaMessage(written[i]).Headers))
+				assert.Equal(t, span.SpanContext.SpanID(), remote.SpanID(), name)
+			}
+		}
+
+		dlqSpan, _ := tracingtest.SpanNamed(exporter, "messages.dlq publish")
+		assert.Equal(t, request.SpanContext().SpanID(), dlqSpan.Parent.SpanID())
+		publishSpan, _ := tracingtest.SpanNamed(exporter, "messages publish")
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", publishSpan.SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", publishSpan.Parent.SpanID().String())
+	}
+}
+
 // TestProducerClose tests the Close method of ProducerImpl
 func TestProducerClose(t *testing.T) {
 	// Create a mock Kafka writer
@@ -111,4 +264,112 @@ func TestProducerCloseError(t *testing.T) {
 
 	// Verify expectations
 	mockWriter.AssertExpectations(t)
-}
\ No newline at end of file
+}
+
+// TestNewProducer tests that the producer settings configure the writer
+func TestNewProducer(t *testing.T) {
+	cfg := ProducerConfig{
+		BatchSize:    500,
+		BatchTimeout: 50 * time.Millisecond,
+		RequiredAcks: "one",
+		Compression:  "zstd",
+		Balancer:     "round-robin",
+		Async:        true,
+		OnDelivery:   func([]*model.KafkaMessage, error) {},
+	}
+
+	writer, err := newWriter(cfg)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 500, writer.BatchSize)
+		assert.Equal(t, 50*time.Millisecond, writer.BatchTimeout)
+		assert.Equal(t, kafka.RequireOne, writer.RequiredAcks)
+		assert.Equal(t, kafka.Zstd, writer.Compression)
+		assert.IsType(t, &kafka.RoundRobin{}, writer.Balancer)
+		assert.True(t, writer.Async)
+		assert.NotNil(t, writer.Completion)
+	}
+
+	// The defaults wait for all replicas and keep keys on their partition
+	writer, err = newWriter(DefaultProducerConfig())
+	if assert.NoError(t, err) {
+		assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+		assert.Equal(t, kafka.Compression(0), writer.Compression)
+		assert.IsType(t, &kafka.Murmur2Balancer{}, writer.Balancer)
+		assert.False(t, writer.Async)
+		assert.Nil(t, writer.Completion)
+	}
+
+	producer, err := NewProducer([]string{"localhost:9092"}, DefaultProducerConfig(), SecurityConfig{})
+	assert.NoError(t, err)
+	assert.NoError(t, producer.Close())
+}
+
+// TestNewProducerInvalidConfig tests that unknown settings are rejected
+func TestNewProducerInvalidConfig(t *testing.T) {
+	for name, update := range map[string]func(*ProducerConfig){
+		"acks":        func(cfg *ProducerConfig) { cfg.RequiredAcks = "some" },
+		"compression": func(cfg *ProducerConfig) { cfg.Compression = "brotli" },
+		"balancer":    func(cfg *ProducerConfig) { cfg.Balancer = "random" },
+	} {
+		cfg := DefaultProducerConfig()
+		update(&cfg)
+
+		_, err := NewProducer([]string{"localhost:9092"}, cfg, SecurityConfig{})
+		assert.Error(t, err, name)
+	}
+}
+
+// TestProducerAsyncDelivery tests that async sends report the outcome of their batches
+func TestProducerAsyncDelivery(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []*model.KafkaMessage
+	var failures []error
+
+	cfg := DefaultProducerConfig()
+	cfg.Async = true
+	cfg.OnDelivery = func(messages []*model.KafkaMessage, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures = append(failures, err)
+			return
+		}
+		delivered = append(delivered, messages...)
+	}
+
+	// Messages stored by Kafka are reported with their keys and headers
+	transport := &fakeTransport{partitions: 2}
+	producer := newFakeProducer(t, transport, cfg)
+	err := producer.SendMessages(context.Background(), "test-topic", []*model.KafkaMessage{
+		{Key: []byte("1"), Value: []byte("first"), Headers: map[string]string{"content-type": "application/json"}},
+		{Key: []byte("2"), Value: []byte("second")},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, producer.Close())
+
+	mu.Lock()
+	if assert.Len(t, delivered, 2) {
+		values := map[string]string{}
+		for _, message := range delivered {
+			values[string(message.Key)] = string(message.Value)
+		}
+		assert.Equal(t, map[string]string{"1": "first", "2": "second"}, values)
+	}
+	assert.Empty(t, failures)
+	delivered, failures = nil, nil
+	mu.Unlock()
+
+	// Messages Kafka rejects are reported with the error while the send succeeded
+	transport = &fakeTransport{partitions: 1, errorCode: kafka.MessageSizeTooLarge}
+	producer = newFakeProducer(t, transport, cfg)
+	err = producer.SendMessageWithKey(context.Background(), "test-topic", []byte("3"), []byte("third"), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, producer.Close())
+
+	mu.Lock()
+	assert.Empty(t, delivered)
+	if assert.Len(t, failures, 1) {
+		assert.ErrorIs(t, failures[0], kafka.MessageSizeTooLarge)
+	}
+	mu.Unlock()
+}
@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SecurityConfig configures TLS and SASL authentication of the connections to the brokers.
+// The zero value connects in plaintext without authentication.
+type SecurityConfig struct {
+	// TLSEnabled connects to the brokers over TLS
+	TLSEnabled bool
+	// TLSCAFile is a PEM file with the CAs trusted for the broker certificates. The system
+	// pool is used when empty.
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are the PEM client certificate and key for mutual TLS
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSServerName overrides the host name checked against the broker certificates
+	TLSServerName string
+	// TLSInsecureSkipVerify accepts any broker certificate. Only meant for development.
+	TLSInsecureSkipVerify bool
+	// SASLMechanism is plain, scram-sha-256 or scram-sha-512, or empty for no SASL
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+}
+
+// dialTimeout matches the timeout of the kafka-go default dialer
+const dialTimeout = 10 * time.Second
+
+// newTransport builds the transport of the writer, or nil for the kafka-go default
+func (s SecurityConfig) newTransport() (*kafka.Transport, error) {
+	tlsConfig, mechanism, err := s.build()
+	if err != nil || (tlsConfig == nil && mechanism == nil) {
+		return nil, err
+	}
+	return &kafka.Transport{
+		DialTimeout: dialTimeout,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
+
+// newDialer builds the dialer of the reader, or nil for the kafka-go default
+func (s SecurityConfig) newDialer() (*kafka.Dialer, error) {
+	tlsConfig, mechanism, err := s.build()
+	if err != nil || (tlsConfig == nil && mechanism == nil) {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// build returns the TLS config and SASL mechanism, each nil when disabled
+func (s SecurityConfig) build() (*tls.Config, sasl.Mechanism, error) {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	mechanism, err := s.saslMechanism()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tlsConfig, mechanism, nil
+}
+
+// tlsConfig loads the TLS settings, returning nil when TLS is disabled
+func (s SecurityConfig) tlsConfig() (*tls.Config, error) {
+	if !s.TLSEnabled {
+		if s.TLSCAFile != "" || s.TLSCertFile != "" || s.TLSKeyFile != "" {
+			return nil, fmt.Errorf("TLS files for Kafka are set but TLS is disabled")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         s.TLSServerName,
+		InsecureSkipVerify: s.TLSInsecureSkipVerify,
+	}
+
+	if s.TLSCAFile != "" {
+		pem, err := os.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA file %s", s.TLSCAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key for Kafka TLS must be set together")
+	}
+	if s.TLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kafka client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// saslMechanism creates the SASL mechanism, returning nil when SASL is disabled
+func (s SecurityConfig) saslMechanism() (sasl.Mechanism, error) {
+	name := strings.ToLower(s.SASLMechanism)
+	if name == "" {
+		return nil, nil
+	}
+	if name != "plain" && name != "scram-sha-256" && name != "scram-sha-512" {
+		return nil, fmt.Errorf("unknown Kafka SASL mechanism %q", s.SASLMechanism)
+	}
+	if s.SASLUsername == "" {
+		return nil, fmt.Errorf("SASL mechanism %s for Kafka requires a username", s.SASLMechanism)
+	}
+
+	switch name {
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, s.SASLUsername, s.SASLPassword)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, s.SASLUsername, s.SASLPassword)
+	default:
+		return plain.Mechanism{Username: s.SASLUsername, Password: s.SASLPassword}, nil
+	}
+}
@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate and its key as PEM files into dir
+func writeCertificate(t *testing.T, dir, name string) (certFile, keyFile string, certificate *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Failed to generate key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Failed to create certificate:", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal("Failed to marshal key:", err)
+	}
+	certificate, _ = x509.ParseCertificate(der)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, certificate
+}
+
+// TestSecurityConfigDisabled tests that the zero value keeps the kafka-go defaults
+func TestSecurityConfigDisabled(t *testing.T) {
+	transport, err := SecurityConfig{}.newTransport()
+	assert.NoError(t, err)
+	assert.Nil(t, transport)
+
+	dialer, err := SecurityConfig{}.newDialer()
+	assert.NoError(t, err)
+	assert.Nil(t, dialer)
+}
+
+// TestSecurityConfigTLS tests that the CA, client certificate and server name are loaded
+func TestSecurityConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _, ca := writeCertificate(t, dir, "ca")
+	certFile, keyFile, client := writeCertificate(t, dir, "client")
+
+	security := SecurityConfig{
+		TLSEnabled:    true,
+		TLSCAFile:     caFile,
+		TLSCertFile:   certFile,
+		TLSKeyFile:    keyFile,
+		TLSServerName: "kafka.internal",
+	}
+	config, err := security.tlsConfig()
+	if assert.NoError(t, err) {
+		expectedPool := x509.NewCertPool()
+		expectedPool.AddCert(ca)
+		assert.True(t, expectedPool.Equal(config.RootCAs))
+		if assert.Len(t, config.Certificates, 1) {
+			assert.Equal(t, client.Raw, config.Certificates[0].Certificate[0])
+		}
+		assert.Equal(t, "kafka.internal", config.ServerName)
+		assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+		assert.False(t, config.InsecureSkipVerify)
+	}
+
+	// Without files the system CAs are trusted and no client certificate is sent
+	config, err = SecurityConfig{TLSEnabled: true, TLSInsecureSkipVerify: true}.tlsConfig()
+	if assert.NoError(t, err) {
+		assert.Nil(t, config.RootCAs)
+		assert.Empty(t, config.Certificates)
+		assert.True(t, config.InsecureSkipVerify)
+	}
+}
+
+// TestSecurityConfigSASL tests that each mechanism is created with its Kafka name
+func TestSecurityConfigSASL(t *testing.T) {
+	for mechanism, expected := range map[string]string{
+		"plain":         "PLAIN",
+		"scram-sha-256": "SCRAM-SHA-256",
+		"SCRAM-SHA-512": "SCRAM-SHA-512",
+	} {
+		security := SecurityConfig{SASLMechanism: mechanism, SASLUsername: "httpchat", SASLPassword: "secret"}
+		created, err := security.saslMechanism()
+		if assert.NoError(t, err, mechanism) {
+			assert.Equal(t, expected, created.Name())
+		}
+	}
+}
+
+// TestSecurityConfigInvalid tests that incomplete or unknown settings are rejected
+func TestSecurityConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeCertificate(t, dir, "client")
+	notPEM := filepath.Join(dir, "ca.txt")
+	assert.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+
+	for name, security := range map[string]SecurityConfig{
+		"files without TLS":   {TLSCAFile: certFile},
+		"missing CA file":     {TLSEnabled: true, TLSCAFile: filepath.Join(dir, "missing.crt")},
+		"CA file without PEM": {TLSEnabled: true, TLSCAFile: notPEM},
+		"cert without key":    {TLSEnabled: true, TLSCertFile: certFile},
+		"mismatched key pair": {TLSEnabled: true, TLSCertFile: keyFile, TLSKeyFile: certFile},
+		"unknown mechanism":   {SASLMechanism: "gssapi", SASLUsername: "httpchat"},
+		"missing username":    {SASLMechanism: "plain"},
+	} {
+		_, err := security.newTransport()
+		assert.Error(t, err, name)
+		_, err = security.newDialer()
+		assert.Error(t, err, name)
+	}
+}
+
+// TestSecurityConfigApplied tests that the settings reach the writer transport and the reader dialer
+func TestSecurityConfigApplied(t *testing.T) {
+	security := SecurityConfig{
+		TLSEnabled:    true,
+		TLSServerName: "kafka.internal",
+		SASLMechanism: "scram-sha-512",
+		SASLUsername:  "httpchat",
+		SASLPassword:  "secret",
+	}
+
+	producer, err := NewProducer([]string{"localhost:9093"}, DefaultProducerConfig(), security)
+	if assert.NoError(t, err) {
+		transport, ok := producer.(*ProducerImpl).writer.(*kafka.Writer).Transport.(*kafka.Transport)
+		if assert.True(t, ok) {
+			assert.Equal(t, "kafka.internal", transport.TLS.ServerName)
+			assert.Equal(t, "SCRAM-SHA-512", transport.SASL.Name())
+		}
+		assert.NoError(t, producer.Close())
+	}
+
+	consumer, err := NewConsumer([]string{"localhost:9093"}, "test-topic", "", security)
+	if assert.NoError(t, err) {
+		dialer := consumer.(*ConsumerImpl).reader.(*kafka.Reader).Config().Dialer
+		if assert.NotNil(t, dialer) {
+			assert.Equal(t, "kafka.internal", dialer.TLS.ServerName)
+			assert.Equal(t, "SCRAM-SHA-512", dialer.SASLMechanism.Name())
+		}
+		assert.NoError(t, consumer.Close())
+	}
+
+	// Invalid settings fail before any connection is made
+	security.SASLUsername = ""
+	_, err = NewProducer([]string{"localhost:9093"}, DefaultProducerConfig(), security)
+	assert.Error(t, err)
+	_, err = NewConsumer([]string{"localhost:9093"}, "test-topic", "", security)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+// Package lifecycle provides the ordered shutdown of the components of the service.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"httpchat/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Phase is a step of the shutdown with its own time limit
+type Phase struct {
+	Name    string
+	Timeout time.Duration
+	// Stop stops the components of the phase. It should return once ctx is done.
+	Stop func(ctx context.Context) error
+}
+
+// Shutdown runs the phases one after another, each with a context that expires after
+// its timeout. A phase that has not returned by then is abandoned, so that a stuck
+// dependency cannot hold up the phases after it. A failed phase does not stop the
+// shutdown either; the errors of all phases are returned together.
+func Shutdown(phases []Phase, logger *logger.Logger) error {
+	var errs []error
+	for _, phase := range phases {
+		start := time.Now()
+		if err := run(phase); err != nil {
+			logger.Error("Shutdown phase failed",
+				zap.String("phase", phase.Name),
+				zap.Duration("elapsed", time.Since(start)),
+				zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", phase.Name, err))
+			continue
+		}
+		logger.Info("Shutdown phase completed",
+			zap.String("phase", phase.Name),
+			zap.Duration("elapsed", time.Since(start)))
+	}
+	return errors.Join(errs...)
+}
+
+// run stops a phase and waits for it no longer than its timeout
+func run(phase Phase) error {
+	ctx, cancel := context.WithTimeout(context.Background(), phase.Timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- phase.Stop(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("did not finish within %s", phase.Timeout)
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"httpchat/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	var order []string
+	phase := func(name string, err error) Phase {
+		return Phase{Name: name, Timeout: time.Second, Stop: func(context.Context) error {
+			order = append(order, name)
+			return err
+		}}
+	}
+
+	// A failed phase is reported, and the phases after it still run in order
+	err := Shutdown([]Phase{
+		phase("http", nil),
+		phase("processing", assert.AnError),
+		phase("connections", nil),
+	}, testLogger)
+
+	assert.Equal(t, []string{"http", "processing", "connections"}, order)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "processing")
+	assert.NoError(t, Shutdown([]Phase{phase("http", nil)}, testLogger))
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	deadlines := make(chan time.Time, 1)
+	var ran bool
+	start := time.Now()
+	err := Shutdown([]Phase{
+		{Name: "respects", Timeout: 50 * time.Millisecond, Stop: func(ctx context.Context) error {
+			deadline, _ := ctx.Deadline()
+			deadlines <- deadline
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{Name: "stuck", Timeout: 50 * time.Millisecond, Stop: func(context.Context) error {
+			// Ignores its context and is abandoned
+			time.Sleep(time.Minute)
+			return nil
+		}},
+		{Name: "last", Timeout: time.Second, Stop: func(context.Context) error {
+			ran = true
+			return nil
+		}},
+	}, testLogger)
+
+	// Every phase gets its own timeout, and a stuck one does not hold up the rest
+	assert.WithinDuration(t, start.Add(50*time.Millisecond), <-deadlines, 25*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, ran)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "respects: did not finish within 50ms")
+		assert.Contains(t, err.Error(), "stuck: did not finish within 50ms")
+	}
+}
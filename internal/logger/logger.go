@@ -2,6 +2,7 @@
 package logger
 
 import (
+	"context"
 	"os"
 
 	"go.uber.org/zap"
@@ -55,6 +56,29 @@ func (l *Logger) WithFields(fields map[string]any) *Logger {
 	return &Logger{l.With(zapFields...)}
 }
 
+// fieldsKey is the context key of the fields added by ContextWithFields
+type fieldsKey struct{}
+
+// ContextWithFields returns ctx carrying fields, in addition to those it already
+// carries, for the loggers taken from it with FromContext
+func ContextWithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	existing, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	merged := make([]zap.Field, 0, len(existing)+len(fields))
+	merged = append(merged, existing...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FromContext returns a child logger with the fields carried by ctx, such as the ID,
+// route and client IP of the request being served
+func (l *Logger) FromContext(ctx context.Context) *Logger {
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	if len(fields) == 0 {
+		return l
+	}
+	return &Logger{l.With(fields...)}
+}
+
 // Close flushes any buffered log entries
 func (l *Logger) Close() error {
 	return l.Sync()
@@ -1,9 +1,12 @@
 package logger
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestLoggerCreation(t *testing.T) {
@@ -15,4 +18,21 @@ func TestLoggerCreation(t *testing.T) {
 	// Close the logger
 	err = logger.Close()
 	assert.NoError(t, err)
-}
\ No newline at end of file
+}
+
+func TestFromContext(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	base := &Logger{zap.New(core)}
+
+	// A context without fields gives the logger itself
+	assert.Same(t, base, base.FromContext(context.Background()))
+
+	ctx := ContextWithFields(context.Background(), zap.String("request_id", "req-1"))
+	ctx = ContextWithFields(ctx, zap.String("route", "/messages"))
+	base.FromContext(ctx).Info("Creating new message")
+
+	entries := logs.All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, map[string]any{"request_id": "req-1", "route": "/messages"}, entries[0].ContextMap())
+	}
+}
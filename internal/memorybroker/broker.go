@@ -0,0 +1,210 @@
+// Package memorybroker provides an in-process message broker that implements the Kafka interfaces.
+package memorybroker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by producers and consumers that have been closed
+var ErrClosed = errors.New("memory broker client is closed")
+
+// Broker is an in-process message broker with the delivery semantics of Kafka.
+// Topics are split into partitions; messages with the same key go to the same partition
+// and keep their order, messages without a key are spread over the partitions in turn.
+// Consumer groups track a committed offset per partition, and the consumers of a group
+// share its partitions so that every message is delivered to one of them.
+//
+// Each partition buffers at most bufferSize messages: a send blocks while its partition
+// is full, and messages are dropped once every consumer group reading the topic has
+// committed them. A topic keeps its messages until a consumer group starts reading it,
+// and a new group starts at the oldest buffered message.
+type Broker struct {
+	partitions int
+	bufferSize int
+
+	mu     sync.Mutex
+	topics map[string]*topic
+	// changed is closed and replaced whenever messages are added, fetched back or dropped
+	changed chan struct{}
+}
+
+// topic is a named set of partitions together with the consumer groups reading it
+type topic struct {
+	name       string
+	partitions []*partition
+	groups     map[string]*group
+	// next is the partition that receives the next message without a key
+	next int
+}
+
+// partition is the buffered tail of a partition log
+type partition struct {
+	// base is the offset of the first buffered record
+	base    int64
+	records []record
+}
+
+// record is a message stored in a partition
+type record struct {
+	key     []byte
+	value   []byte
+	headers map[string]string
+	time    time.Time
+}
+
+// group is the progress of a consumer group through the partitions of a topic
+type group struct {
+	// committed is the next offset to commit per partition
+	committed []int64
+	// position is the next offset to fetch per partition
+	position []int64
+	// next is the partition the next fetch looks at first
+	next int
+}
+
+// New creates a broker whose topics have the given number of partitions,
+// each buffering up to bufferSize messages
+func New(partitions, bufferSize int) *Broker {
+	if partitions < 1 {
+		partitions = 1
+	}
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &Broker{
+		partitions: partitions,
+		bufferSize: bufferSize,
+		topics:     make(map[string]*topic),
+		changed:    make(chan struct{}),
+	}
+}
+
+// topic returns the named topic, creating it on first use. The caller must hold b.mu.
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{
+			name:       name,
+			partitions: make([]*partition, b.partitions),
+			groups:     make(map[string]*group),
+		}
+		for i := range t.partitions {
+			t.partitions[i] = &partition{}
+		}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// join returns the group reading a topic, starting a new group at the oldest buffered
+// messages. The caller must hold b.mu.
+func (b *Broker) join(t *topic, groupID string) *group {
+	g, ok := t.groups[groupID]
+	if !ok {
+		g = &group{
+			committed: make([]int64, len(t.partitions)),
+			position:  make([]int64, len(t.partitions)),
+		}
+		for i, p := range t.partitions {
+			g.committed[i] = p.base
+			g.position[i] = p.base
+		}
+		t.groups[groupID] = g
+	}
+	return g
+}
+
+// notify wakes up every waiting send and fetch. The caller must hold b.mu.
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// wait releases b.mu until the broker changes or ctx is done, and reacquires it.
+// The caller must hold b.mu.
+func (b *Broker) wait(ctx context.Context) error {
+	changed := b.changed
+	b.mu.Unlock()
+	defer b.mu.Lock()
+
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send appends a message to the partition its key maps to, waiting while the partition is full
+func (b *Broker) send(ctx context.Context, topicName string, key, value []byte, headers map[string]string, closed func() bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topicName)
+	var p *partition
+	if len(key) > 0 {
+		hash := fnv.New32a()
+		_, _ = hash.Write(key)
+		p = t.partitions[hash.Sum32()%uint32(len(t.partitions))]
+	} else {
+		p = t.partitions[t.next]
+		t.next = (t.next + 1) % len(t.partitions)
+	}
+
+	for len(p.records) >= b.bufferSize {
+		if closed() {
+			return ErrClosed
+		}
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if closed() {
+		return ErrClosed
+	}
+
+	// Copy the message so that the caller may reuse its buffers
+	var copied map[string]string
+	if len(headers) > 0 {
+		copied = make(map[string]string, len(headers))
+		for k, v := range headers {
+			copied[k] = v
+		}
+	}
+	p.records = append(p.records, record{
+		key:     append([]byte(nil), key...),
+		value:   append([]byte(nil), value...),
+		headers: copied,
+		time:    time.Now(),
+	})
+	b.notify()
+	return nil
+}
+
+// trim drops the records of a partition that every group reading the topic has committed.
+// The caller must hold b.mu.
+func (b *Broker) trim(t *topic, index int) {
+	if len(t.groups) == 0 {
+		return
+	}
+
+	p := t.partitions[index]
+	end := p.base + int64(len(p.records))
+	for _, g := range t.groups {
+		if g.committed[index] < end {
+			end = g.committed[index]
+		}
+	}
+	if end <= p.base {
+		return
+	}
+
+	// Copy the tail so that the dropped records can be garbage collected
+	p.records = append([]record(nil), p.records[end-p.base:]...)
+	p.base = end
+	b.notify()
+}
@@ -0,0 +1,267 @@
+package memorybroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fetch reads the next message or fails the test if none arrives in time
+func fetch(t *testing.T, consumer *Consumer) interfaces.KafkaDelivery {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	delivery, err := consumer.FetchMessage(ctx, "")
+	if err != nil {
+		t.Fatal("Failed to fetch message:", err)
+	}
+	return delivery
+}
+
+// assertEmpty checks that no message is waiting for the consumer
+func assertEmpty(t *testing.T, consumer *Consumer) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := consumer.FetchMessage(ctx, "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// batch builds a batch of unkeyed messages with the given values
+func batch(values ...string) []*model.KafkaMessage {
+	messages := make([]*model.KafkaMessage, len(values))
+	for i, value := range values {
+		messages[i] = &model.KafkaMessage{Value: []byte(value)}
+	}
+	return messages
+}
+
+func TestBrokerSendAndFetch(t *testing.T) {
+	ctx := context.Background()
+	broker := New(1, 10)
+	producer := broker.NewProducer()
+
+	// Messages sent before the first consumer joined are kept for it
+	assert.NoError(t, producer.SendMessage(ctx, "messages", []byte("first")))
+	assert.NoError(t, producer.SendMessageWithHeaders(ctx, "messages", []byte("second"), map[string]string{"x-attempts": "2"}))
+	assert.NoError(t, producer.SendMessage(ctx, "other", []byte("other topic")))
+
+	consumer := broker.NewConsumer("messages", "group")
+
+	first := fetch(t, consumer).Message()
+	assert.Equal(t, "messages", first.Topic)
+	assert.Equal(t, int64(0), first.Offset)
+	assert.Equal(t, []byte("first"), first.Value)
+	assert.Nil(t, first.Headers)
+	assert.False(t, first.Time.IsZero())
+
+	second := fetch(t, consumer).Message()
+	assert.Equal(t, int64(1), second.Offset)
+	assert.Equal(t, []byte("second"), second.Value)
+	assert.Equal(t, map[string]string{"x-attempts": "2"}, second.Headers)
+
+	// The other topic is not delivered
+	assertEmpty(t, consumer)
+
+	// A waiting fetch returns as soon as a message arrives
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = producer.SendMessage(ctx, "messages", []byte("third"))
+	}()
+	assert.Equal(t, []byte("third"), fetch(t, consumer).Message().Value)
+}
+
+func TestBrokerPartitionsByKey(t *testing.T) {
+	ctx := context.Background()
+	broker := New(4, 100)
+	producer := broker.NewProducer()
+	consumer := broker.NewConsumer("messages", "group")
+
+	for i := 0; i < 10; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			value := fmt.Sprintf("%s-%d", key, i)
+			assert.NoError(t, producer.SendMessageWithKey(ctx, "messages", []byte(key), []byte(value), nil))
+		}
+	}
+
+	// Messages with the same key share a partition and keep their order
+	partitions := make(map[string]int)
+	next := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		message := fetch(t, consumer).Message()
+		var key string
+		var n int
+		_, err := fmt.Sscanf(string(message.Value), "%1s-%d", &key, &n)
+		assert.NoError(t, err)
+		assert.Equal(t, key, string(message.Key))
+
+		if partition, ok := partitions[key]; ok {
+			assert.Equal(t, partition, message.Partition, "key %s changed partition", key)
+		}
+		partitions[key] = message.Partition
+		assert.Equal(t, next[key], n, "key %s out of order", key)
+		next[key] = n + 1
+	}
+
+	// Messages without a key are spread over the partitions
+	unkeyed := New(4, 100)
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, unkeyed.NewProducer().SendMessage(ctx, "messages", []byte("message")))
+	}
+	spread := make(map[int]bool)
+	unkeyedConsumer := unkeyed.NewConsumer("messages", "group")
+	for i := 0; i < 4; i++ {
+		spread[fetch(t, unkeyedConsumer).Message().Partition] = true
+	}
+	assert.Len(t, spread, 4)
+}
+
+func TestBrokerConsumerGroups(t *testing.T) {
+	ctx := context.Background()
+	broker := New(1, 10)
+	producer := broker.NewProducer()
+
+	processors := broker.NewConsumer("messages", "processors")
+	auditors := broker.NewConsumer("messages", "auditors")
+	assert.NoError(t, producer.SendMessages(ctx, "messages", batch("first", "second")))
+
+	// Every group receives every message
+	for _, consumer := range []*Consumer{processors, auditors} {
+		assert.Equal(t, []byte("first"), fetch(t, consumer).Message().Value)
+		assert.Equal(t, []byte("second"), fetch(t, consumer).Message().Value)
+	}
+
+	// Consumers of the same group share the messages
+	assert.NoError(t, producer.SendMessages(ctx, "messages", batch("third", "fourth")))
+	sibling := broker.NewConsumer("messages", "processors")
+	assert.Equal(t, []byte("third"), fetch(t, sibling).Message().Value)
+	assert.Equal(t, []byte("fourth"), fetch(t, processors).Message().Value)
+	assertEmpty(t, sibling)
+}
+
+func TestBrokerCommittedOffsets(t *testing.T) {
+	ctx := context.Background()
+	broker := New(1, 10)
+	producer := broker.NewProducer()
+
+	consumer := broker.NewConsumer("messages", "group")
+	assert.NoError(t, producer.SendMessages(ctx, "messages", batch("first", "second", "third")))
+
+	first := fetch(t, consumer)
+	assert.Equal(t, int64(1), fetch(t, consumer).Message().Offset)
+	assert.NoError(t, consumer.Commit(ctx, first))
+	assert.NoError(t, consumer.Close())
+
+	// A new member of the group resumes after the committed offset
+	consumer = broker.NewConsumer("messages", "group")
+	second := fetch(t, consumer)
+	assert.Equal(t, int64(1), second.Message().Offset)
+
+	// Committing an offset also commits the offsets before it
+	third := fetch(t, consumer)
+	assert.NoError(t, consumer.Commit(ctx, third))
+	assert.NoError(t, consumer.Close())
+
+	consumer = broker.NewConsumer("messages", "group")
+	assertEmpty(t, consumer)
+	assert.NoError(t, consumer.Close())
+
+	// Deliveries from another consumer are rejected
+	assert.NoError(t, producer.SendMessage(ctx, "messages", []byte("fourth")))
+	other := broker.NewConsumer("messages", "other")
+	consumer = broker.NewConsumer("messages", "group")
+	delivery := fetch(t, consumer)
+	assert.Error(t, other.Commit(ctx, delivery))
+
+	// Closed consumers neither fetch nor commit
+	assert.NoError(t, consumer.Close())
+	_, err := consumer.FetchMessage(ctx, "")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, delivery.Commit(ctx), ErrClosed)
+}
+
+func TestBrokerNackHoldsCommits(t *testing.T) {
+	ctx := context.Background()
+	broker := New(1, 10)
+	producer := broker.NewProducer()
+
+	consumer := broker.NewConsumer("messages", "group")
+	assert.NoError(t, producer.SendMessages(ctx, "messages", batch("first", "second")))
+
+	first := fetch(t, consumer)
+	second := fetch(t, consumer)
+	assert.NoError(t, first.Nack(ctx))
+	assert.NoError(t, second.Commit(ctx))
+	assert.NoError(t, consumer.Close())
+
+	// The commit behind the nacked message was skipped, so both are delivered again
+	consumer = broker.NewConsumer("messages", "group")
+	first = fetch(t, consumer)
+	assert.Equal(t, int64(0), first.Message().Offset)
+	assert.Equal(t, int64(1), fetch(t, consumer).Message().Offset)
+	assert.NoError(t, first.Commit(ctx))
+	assert.NoError(t, consumer.Close())
+
+	consumer = broker.NewConsumer("messages", "group")
+	assert.Equal(t, int64(1), fetch(t, consumer).Message().Offset)
+}
+
+func TestBrokerBoundedBuffer(t *testing.T) {
+	ctx := context.Background()
+	broker := New(1, 2)
+	producer := broker.NewProducer()
+	consumer := broker.NewConsumer("messages", "group")
+
+	assert.NoError(t, producer.SendMessages(ctx, "messages", batch("first", "second")))
+
+	// A full partition blocks the send until the deadline
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, producer.SendMessage(timeoutCtx, "messages", []byte("third")), context.DeadlineExceeded)
+
+	// A batch reports the messages that did not fit
+	timeoutCtx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	first := fetch(t, consumer)
+	assert.NoError(t, first.Commit(ctx))
+	err := producer.SendMessages(timeoutCtx, "messages", batch("third", "fourth"))
+	var batchErr model.BatchSendError
+	if assert.True(t, errors.As(err, &batchErr)) {
+		assert.NoError(t, batchErr[0])
+		assert.ErrorIs(t, batchErr[1], context.DeadlineExceeded)
+	}
+
+	// Committing makes room for a waiting send
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, producer.SendMessage(ctx, "messages", []byte("fourth")))
+	}()
+	second := fetch(t, consumer)
+	assert.Equal(t, []byte("second"), second.Message().Value)
+	assert.NoError(t, consumer.Commit(ctx, second))
+	wg.Wait()
+
+	assert.Equal(t, []byte("third"), fetch(t, consumer).Message().Value)
+	assert.Equal(t, []byte("fourth"), fetch(t, consumer).Message().Value)
+
+	// A closed producer stops waiting
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = producer.Close()
+	}()
+	assert.ErrorIs(t, producer.SendMessage(ctx, "messages", []byte("fifth")), ErrClosed)
+}
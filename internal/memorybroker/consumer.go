@@ -0,0 +1,178 @@
+package memorybroker
+
+import (
+	"context"
+	"fmt"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+)
+
+// Consumer implements the interfaces.KafkaConsumer interface for the memory broker.
+// Like a Kafka group reader it cannot rewind: a nacked offset is held, so later offsets
+// of the same partition are not committed, and uncommitted messages are delivered
+// again once a consumer of the group is closed, as they would be after a rebalance.
+type Consumer struct {
+	broker *Broker
+	topic  *topic
+	group  *group
+
+	// held maps a partition to its lowest nacked offset; guarded by broker.mu like closed
+	held   map[int]int64
+	closed bool
+}
+
+// NewConsumer creates a consumer that reads the topic as a member of the consumer group
+func (b *Broker) NewConsumer(topic, groupID string) *Consumer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topic)
+	return &Consumer{
+		broker: b,
+		topic:  t,
+		group:  b.join(t, groupID),
+		held:   make(map[int]int64),
+	}
+}
+
+// Ensure Consumer implements interfaces.KafkaConsumer
+var _ interfaces.KafkaConsumer = (*Consumer)(nil)
+
+// FetchMessage waits for the next message of the group without committing its offset
+func (c *Consumer) FetchMessage(ctx context.Context, _ string) (interfaces.KafkaDelivery, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	for {
+		if c.closed {
+			return nil, fmt.Errorf("failed to read message from memory broker: %w", ErrClosed)
+		}
+
+		// Take turns between the partitions so that a busy one does not starve the others
+		g := c.group
+		for i := range c.topic.partitions {
+			index := (g.next + i) % len(c.topic.partitions)
+			p := c.topic.partitions[index]
+			offset := g.position[index]
+			if offset >= p.base+int64(len(p.records)) {
+				continue
+			}
+
+			g.position[index] = offset + 1
+			g.next = (index + 1) % len(c.topic.partitions)
+
+			r := p.records[offset-p.base]
+			return &delivery{
+				consumer: c,
+				message: &model.KafkaMessage{
+					Topic:     c.topic.name,
+					Partition: index,
+					Offset:    offset,
+					Key:       r.key,
+					Value:     r.value,
+					Headers:   r.headers,
+					Time:      r.time,
+				},
+			}, nil
+		}
+
+		if err := c.broker.wait(ctx); err != nil {
+			return nil, fmt.Errorf("failed to read message from memory broker: %w", err)
+		}
+	}
+}
+
+// Commit commits the offsets of several deliveries at once
+func (c *Consumer) Commit(_ context.Context, deliveries ...interfaces.KafkaDelivery) error {
+	messages := make([]*model.KafkaMessage, 0, len(deliveries))
+	for _, d := range deliveries {
+		fetched, ok := d.(*delivery)
+		if !ok || fetched.consumer != c {
+			return fmt.Errorf("delivery was not fetched by this consumer")
+		}
+		messages = append(messages, fetched.message)
+	}
+	return c.commit(messages...)
+}
+
+// commit commits the offsets of messages, skipping those behind a nacked offset of their partition
+func (c *Consumer) commit(messages ...*model.KafkaMessage) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("failed to commit message offset: %w", ErrClosed)
+	}
+
+	for _, message := range messages {
+		if held, ok := c.held[message.Partition]; ok {
+			if message.Offset > held {
+				// Committing would also commit the nacked message
+				continue
+			}
+			if message.Offset == held {
+				// The nacked message was delivered again and has now been handled
+				delete(c.held, message.Partition)
+			}
+		}
+
+		// Committing an offset commits every offset before it, as in Kafka
+		if next := message.Offset + 1; next > c.group.committed[message.Partition] {
+			c.group.committed[message.Partition] = next
+			c.broker.trim(c.topic, message.Partition)
+		}
+	}
+	return nil
+}
+
+// nack holds back commits on the partition of a message so that it is delivered again
+func (c *Consumer) nack(message *model.KafkaMessage) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	if held, ok := c.held[message.Partition]; !ok || message.Offset < held {
+		c.held[message.Partition] = message.Offset
+	}
+}
+
+// Close leaves the consumer group. The group fetches its uncommitted messages again.
+func (c *Consumer) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	copy(c.group.position, c.group.committed)
+
+	// Wake up a fetch waiting for messages
+	c.broker.notify()
+	return nil
+}
+
+// delivery implements interfaces.KafkaDelivery for a message fetched by Consumer
+type delivery struct {
+	consumer *Consumer
+	message  *model.KafkaMessage
+}
+
+// Ensure delivery implements interfaces.KafkaDelivery
+var _ interfaces.KafkaDelivery = (*delivery)(nil)
+
+// Message returns the fetched message
+func (d *delivery) Message() *model.KafkaMessage {
+	return d.message
+}
+
+// Commit commits the offset of the message
+func (d *delivery) Commit(_ context.Context) error {
+	return d.consumer.commit(d.message)
+}
+
+// Nack leaves the offset of the message uncommitted
+func (d *delivery) Nack(_ context.Context) error {
+	d.consumer.nack(d.message)
+	return nil
+}
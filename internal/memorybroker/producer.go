@@ -0,0 +1,81 @@
+package memorybroker
+
+import (
+	"context"
+	"fmt"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+)
+
+// Producer implements the interfaces.KafkaProducer interface for the memory broker
+type Producer struct {
+	broker *Broker
+
+	// closed is guarded by broker.mu
+	closed bool
+}
+
+// NewProducer creates a producer that sends messages to the broker
+func (b *Broker) NewProducer() *Producer {
+	return &Producer{broker: b}
+}
+
+// Ensure Producer implements interfaces.KafkaProducer
+var _ interfaces.KafkaProducer = (*Producer)(nil)
+
+// SendMessage sends a message without a key to the topic
+func (p *Producer) SendMessage(ctx context.Context, topic string, message []byte) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, nil)
+}
+
+// SendMessages sends a batch of messages to the topic in order
+func (p *Producer) SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error {
+	for i, message := range messages {
+		err := p.SendMessageWithKey(ctx, topic, message.Key, message.Value, message.Headers)
+		if err == nil {
+			continue
+		}
+		if i == 0 {
+			return err
+		}
+
+		// The messages before the failed one were sent
+		batchErr := make(model.BatchSendError, len(messages))
+		for j := i; j < len(messages); j++ {
+			batchErr[j] = err
+		}
+		return batchErr
+	}
+	return nil
+}
+
+// SendMessageWithHeaders sends a message with the given headers to the topic
+func (p *Producer) SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, headers)
+}
+
+// SendMessageWithKey sends a message to the partition of its key, so that messages
+// with the same key are consumed in the order they were sent
+func (p *Producer) SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) error {
+	if err := p.broker.send(ctx, topic, key, message, headers, p.isClosed); err != nil {
+		return fmt.Errorf("failed to write message to memory broker: %w", err)
+	}
+	return nil
+}
+
+// Close stops the producer; the broker and its messages are left untouched
+func (p *Producer) Close() error {
+	p.broker.mu.Lock()
+	defer p.broker.mu.Unlock()
+
+	p.closed = true
+	// Wake up sends waiting for a full partition
+	p.broker.notify()
+	return nil
+}
+
+// isClosed reports whether the producer was closed. The caller must hold broker.mu.
+func (p *Producer) isClosed() bool {
+	return p.closed
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+)
+
+// Results of sending a message to the broker
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+// instrumentedProducer counts the messages sent to each topic and whether they were sent
+type instrumentedProducer struct {
+	producer interfaces.KafkaProducer
+	metrics  *Metrics
+}
+
+// InstrumentProducer wraps producer so that the messages it sends are counted
+func (m *Metrics) InstrumentProducer(producer interfaces.KafkaProducer) interfaces.KafkaProducer {
+	return &instrumentedProducer{producer: producer, metrics: m}
+}
+
+// observe counts messages sent to topic with err as the outcome
+func (p *instrumentedProducer) observe(topic string, messages int, err error) {
+	result := resultSuccess
+	if err != nil {
+		result = resultError
+	}
+	p.metrics.kafkaProduced.WithLabelValues(topic, result).Add(float64(messages))
+}
+
+// SendMessage sends a message with the wrapped producer
+func (p *instrumentedProducer) SendMessage(ctx context.Context, topic string, message []byte) error {
+	err := p.producer.SendMessage(ctx, topic, message)
+	p.observe(topic, 1, err)
+	return err
+}
+
+// SendMessages sends a batch with the wrapped producer, counting each message of a
+// partially failed batch by its own result
+func (p *instrumentedProducer) SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error {
+	err := p.producer.SendMessages(ctx, topic, messages)
+
+	var batchErr model.BatchSendError
+	if errors.As(err, &batchErr) && len(batchErr) == len(messages) {
+		for _, messageErr := range batchErr {
+			p.observe(topic, 1, messageErr)
+		}
+		return err
+	}
+	p.observe(topic, len(messages), err)
+	return err
+}
+
+// SendMessageWithHeaders sends a message with headers with the wrapped producer
+func (p *instrumentedProducer) SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error {
+	err := p.producer.SendMessageWithHeaders(ctx, topic, message, headers)
+	p.observe(topic, 1, err)
+	return err
+}
+
+// SendMessageWithKey sends a keyed message with the wrapped producer
+func (p *instrumentedProducer) SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) error {
+	err := p.producer.SendMessageWithKey(ctx, topic, key, message, headers)
+	p.observe(topic, 1, err)
+	return err
+}
+
+// Close closes the wrapped producer
+func (p *instrumentedProducer) Close() error {
+	return p.producer.Close()
+}
+
+// instrumentedConsumer counts fetched messages and tracks how far each partition lags behind
+type instrumentedConsumer struct {
+	consumer interfaces.KafkaConsumer
+	metrics  *Metrics
+}
+
+// InstrumentConsumer wraps consumer so that the messages it fetches are counted. The
+// lag is only known for brokers that report the high-water mark of the partition.
+func (m *Metrics) InstrumentConsumer(consumer interfaces.KafkaConsumer) interfaces.KafkaConsumer {
+	return &instrumentedConsumer{consumer: consumer, metrics: m}
+}
+
+// FetchMessage fetches a message with the wrapped consumer
+func (c *instrumentedConsumer) FetchMessage(ctx context.Context, topic string) (interfaces.KafkaDelivery, error) {
+	delivery, err := c.consumer.FetchMessage(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	c.metrics.kafkaConsumed.WithLabelValues(topic).Inc()
+	if message := delivery.Message(); message.HighWaterMark > 0 {
+		lag := message.HighWaterMark - message.Offset - 1
+		c.metrics.kafkaConsumerLag.WithLabelValues(topic, strconv.Itoa(message.Partition)).Set(float64(lag))
+	}
+	return delivery, nil
+}
+
+// Commit commits deliveries with the wrapped consumer, which fetched them
+func (c *instrumentedConsumer) Commit(ctx context.Context, deliveries ...interfaces.KafkaDelivery) error {
+	return c.consumer.Commit(ctx, deliveries...)
+}
+
+// Close closes the wrapped consumer
+func (c *instrumentedConsumer) Close() error {
+	return c.consumer.Close()
+}
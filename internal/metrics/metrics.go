@@ -0,0 +1,136 @@
+// Package metrics provides the Prometheus metrics of the service and the /metrics endpoint.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric of the service
+const namespace = "httpchat"
+
+// Metrics holds the collectors of the service on a registry of its own, so that
+// several instances can coexist in tests
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	repositoryDuration *prometheus.HistogramVec
+	repositoryErrors   *prometheus.CounterVec
+
+	kafkaProduced    *prometheus.CounterVec
+	kafkaConsumed    *prometheus.CounterVec
+	kafkaConsumerLag *prometheus.GaugeVec
+
+	processingDuration *prometheus.HistogramVec
+	processingRetries  prometheus.Counter
+}
+
+// New creates the collectors and registers them together with the Go runtime and
+// process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+
+		repositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of repository operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		repositoryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "errors_total",
+			Help:      "Failed repository operations by repository error code.",
+		}, []string{"operation", "code"}),
+
+		kafkaProduced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "produced_messages_total",
+			Help:      "Messages sent to the broker by topic and result.",
+		}, []string{"topic", "result"}),
+		kafkaConsumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "consumed_messages_total",
+			Help:      "Messages fetched from the broker by topic.",
+		}, []string{"topic"}),
+		kafkaConsumerLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "consumer_lag",
+			Help:      "Messages behind the end of the partition when the last message was fetched.",
+		}, []string{"topic", "partition"}),
+
+		processingDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "processor",
+			Name:      "processing_duration_seconds",
+			Help:      "Latency of attempts to process an event by outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"outcome"}),
+		processingRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "processor",
+			Name:      "retries_total",
+			Help:      "Failed attempts to process an event that were scheduled for a retry.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.repositoryDuration,
+		m.repositoryErrors,
+		m.kafkaProduced,
+		m.kafkaConsumed,
+		m.kafkaConsumerLag,
+		m.processingDuration,
+		m.processingRetries,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format. A collector that
+// fails is counted in promhttp_metric_handler_errors_total and does not hide the other metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+		Registry:      m.registry,
+	})
+}
+
+// ObserveProcessing records an attempt to process an event and its outcome
+func (m *Metrics) ObserveProcessing(outcome string, duration time.Duration) {
+	m.processingDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+// ObserveRetry records a failed attempt that will be retried
+func (m *Metrics) ObserveRetry() {
+	m.processingRetries.Inc()
+}
@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repository"
+	"httpchat/internal/repositoryerr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubProducer fails the sends with err
+type stubProducer struct {
+	err error
+}
+
+func (p *stubProducer) SendMessage(context.Context, string, []byte) error {
+	return p.err
+}
+
+func (p *stubProducer) SendMessages(context.Context, string, []*model.KafkaMessage) error {
+	return p.err
+}
+
+func (p *stubProducer) SendMessageWithHeaders(context.Context, string, []byte, map[string]string) error {
+	return p.err
+}
+
+func (p *stubProducer) SendMessageWithKey(context.Context, string, []byte, []byte, map[string]string) error {
+	return p.err
+}
+
+func (p *stubProducer) Close() error {
+	return nil
+}
+
+// stubDelivery is a fetched message that needs no settling
+type stubDelivery struct {
+	message *model.KafkaMessage
+}
+
+func (d *stubDelivery) Message() *model.KafkaMessage { return d.message }
+func (d *stubDelivery) Commit(context.Context) error { return nil }
+func (d *stubDelivery) Nack(context.Context) error   { return nil }
+
+// stubConsumer returns its messages in order
+type stubConsumer struct {
+	messages []*model.KafkaMessage
+}
+
+func (c *stubConsumer) FetchMessage(context.Context, string) (interfaces.KafkaDelivery, error) {
+	if len(c.messages) == 0 {
+		return nil, errors.New("no messages")
+	}
+	message := c.messages[0]
+	c.messages = c.messages[1:]
+	return &stubDelivery{message: message}, nil
+}
+
+func (c *stubConsumer) Commit(context.Context, ...interfaces.KafkaDelivery) error {
+	return nil
+}
+
+func (c *stubConsumer) Close() error {
+	return nil
+}
+
+// scrape returns the response of the metrics endpoint
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+
+	router := gin.New()
+	router.Use(m.GinMiddleware())
+	router.GET("/messages/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/messages/1", "/messages/2", "/wp-login.php"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Requests are labelled with the route pattern rather than the path
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/messages/:id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.httpDuration))
+}
+
+func TestInstrumentRepository(t *testing.T) {
+	m := New()
+	repo := m.InstrumentRepository(repository.NewMemoryMessageRepository())
+	ctx := context.Background()
+
+	message, err := repo.CreateMessage(ctx, "hello")
+	assert.NoError(t, err)
+	_, err = repo.GetMessageByID(ctx, message.ID)
+	assert.NoError(t, err)
+
+	// Errors are counted by their repository error code
+	_, err = repo.GetMessageByID(ctx, 999)
+	assert.ErrorIs(t, err, repositoryerr.ErrMessageNotFound)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.repositoryDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.repositoryErrors))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.repositoryErrors.WithLabelValues("GetMessageByID", repositoryerr.ErrorCodeMessageNotFound)))
+}
+
+func TestInstrumentProducer(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	producer := m.InstrumentProducer(&stubProducer{})
+	assert.NoError(t, producer.SendMessageWithKey(ctx, "messages", []byte("1"), []byte("value"), nil))
+	assert.NoError(t, producer.SendMessages(ctx, "messages", []*model.KafkaMessage{{}, {}}))
+
+	// Each message of a partially failed batch is counted by its own result
+	failing := m.InstrumentProducer(&stubProducer{err: model.BatchSendError{nil, errors.New("leader not available")}})
+	assert.Error(t, failing.SendMessages(ctx, "messages", []*model.KafkaMessage{{}, {}}))
+	failing = m.InstrumentProducer(&stubProducer{err: errors.New("broker down")})
+	assert.Error(t, failing.SendMessageWithHeaders(ctx, "messages.dlq", []byte("value"), nil))
+
+	assert.Equal(t, 4.0, testutil.ToFloat64(m.kafkaProduced.WithLabelValues("messages", resultSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.kafkaProduced.WithLabelValues("messages", resultError)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.kafkaProduced.WithLabelValues("messages.dlq", resultError)))
+}
+
+func TestInstrumentConsumer(t *testing.T) {
+	m := New()
+	consumer := m.InstrumentConsumer(&stubConsumer{messages: []*model.KafkaMessage{
+		{Partition: 0, Offset: 4, HighWaterMark: 10},
+		{Partition: 1, Offset: 7, HighWaterMark: 8},
+		// Brokers without a high-water mark leave the lag unknown
+		{Partition: 2, Offset: 3},
+	}})
+
+	for i := 0; i < 3; i++ {
+		_, err := consumer.FetchMessage(context.Background(), "messages")
+		assert.NoError(t, err)
+	}
+	_, err := consumer.FetchMessage(context.Background(), "messages")
+	assert.Error(t, err)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.kafkaConsumed.WithLabelValues("messages")))
+	assert.Equal(t, 5.0, testutil.ToFloat64(m.kafkaConsumerLag.WithLabelValues("messages", "0")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.kafkaConsumerLag.WithLabelValues("messages", "1")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.kafkaConsumerLag))
+}
+
+func TestProcessingMetrics(t *testing.T) {
+	m := New()
+	m.ObserveProcessing("processed", 20*time.Millisecond)
+	m.ObserveProcessing("failed", time.Second)
+	m.ObserveRetry()
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.processingDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.processingRetries))
+}
+
+func TestStatistics(t *testing.T) {
+	var reads int
+	m := New()
+	m.RegisterStatistics(func(context.Context) (*model.Statistics, error) {
+		reads++
+		return &model.Statistics{
+			TotalMessages:        6,
+			PendingMessages:      2,
+			ProcessingMessages:   1,
+			ProcessedMessages:    1,
+			FailedMessages:       1,
+			DeadLetteredMessages: 1,
+		}, nil
+	}, time.Second, time.Minute)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, "httpchat_messages_stored 6")
+	assert.Contains(t, body, `httpchat_messages{status="pending"} 2`)
+	assert.Contains(t, body, `httpchat_messages{status="dead_lettered"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+
+	// Later scrapes serve the cached statistics without reading them again
+	body = scrape(t, m)
+	assert.Contains(t, body, "httpchat_messages_stored 6")
+	assert.Equal(t, 1, reads)
+
+	// Statistics that cannot be read are left out without failing the scrape
+	failing := New()
+	failing.RegisterStatistics(func(context.Context) (*model.Statistics, error) {
+		return nil, errors.New("database unavailable")
+	}, time.Second, time.Minute)
+	body = scrape(t, failing)
+	assert.NotContains(t, body, "httpchat_messages{")
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestStatisticsExpire(t *testing.T) {
+	var total int64
+	m := New()
+	m.RegisterStatistics(func(context.Context) (*model.Statistics, error) {
+		total++
+		return &model.Statistics{TotalMessages: total}, nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Contains(t, scrape(t, m), "httpchat_messages_stored 1")
+
+	// Expired statistics are read again on the next scrape
+	time.Sleep(20 * time.Millisecond)
+	assert.Contains(t, scrape(t, m), "httpchat_messages_stored 2")
+}
+
+func TestStatisticsTimeout(t *testing.T) {
+	m := New()
+	m.RegisterStatistics(func(ctx context.Context) (*model.Statistics, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, 10*time.Millisecond, time.Minute)
+
+	// A slow read is cancelled instead of holding the scrape
+	start := time.Now()
+	body := scrape(t, m)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NotContains(t, body, "httpchat_messages{")
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+)
+
+// unknownErrorCode labels repository errors that carry no repositoryerr code
+const unknownErrorCode = "UNKNOWN"
+
+// Repository is the storage whose operations are recorded
+type Repository interface {
+	interfaces.MessageRepository
+	interfaces.OutboxRepository
+	interfaces.IdempotencyKeyRepository
+}
+
+// instrumentedRepository records the latency and errors of every repository operation
+type instrumentedRepository struct {
+	repo    Repository
+	metrics *Metrics
+}
+
+// InstrumentRepository wraps repo so that its operations are recorded
+func (m *Metrics) InstrumentRepository(repo Repository) Repository {
+	return &instrumentedRepository{repo: repo, metrics: m}
+}
+
+// observe records an operation that started at start and ended with err
+func (r *instrumentedRepository) observe(operation string, start time.Time, err error) {
+	r.metrics.repositoryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+
+	code := unknownErrorCode
+	var repoErr *repositoryerr.RepositoryError
+	if errors.As(err, &repoErr) && repoErr.Code != "" {
+		code = repoErr.Code
+	}
+	r.metrics.repositoryErrors.WithLabelValues(operation, code).Inc()
+}
+
+// CreateMessage creates a message in the wrapped repository
+func (r *instrumentedRepository) CreateMessage(ctx context.Context, content string) (*model.Message, error) {
+	start := time.Now()
+	message, err := r.repo.CreateMessage(ctx, content)
+	r.observe("CreateMessage", start, err)
+	return message, err
+}
+
+// CreateMessageIdempotent creates a message once per idempotency key in the wrapped repository
+func (r *instrumentedRepository) CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (*model.Message, bool, error) {
+	start := time.Now()
+	message, replayed, err := r.repo.CreateMessageIdempotent(ctx, content, key, fingerprint, keyTTL)
+	r.observe("CreateMessageIdempotent", start, err)
+	return message, replayed, err
+}
+
+// GetMessageByID reads a message from the wrapped repository
+func (r *instrumentedRepository) GetMessageByID(ctx context.Context, id int64) (*model.Message, error) {
+	start := time.Now()
+	message, err := r.repo.GetMessageByID(ctx, id)
+	r.observe("GetMessageByID", start, err)
+	return message, err
+}
+
+// UpdateMessageStatus updates the status of a message in the wrapped repository
+func (r *instrumentedRepository) UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) error {
+	start := time.Now()
+	err := r.repo.UpdateMessageStatus(ctx, id, status, lastError)
+	r.observe("UpdateMessageStatus", start, err)
+	return err
+}
+
+// ListMessages lists messages of the wrapped repository
+func (r *instrumentedRepository) ListMessages(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error) {
+	start := time.Now()
+	messages, err := r.repo.ListMessages(ctx, filter)
+	r.observe("ListMessages", start, err)
+	return messages, err
+}
+
+// GetStatistics counts the messages of the wrapped repository
+func (r *instrumentedRepository) GetStatistics(ctx context.Context) (*model.Statistics, error) {
+	start := time.Now()
+	stats, err := r.repo.GetStatistics(ctx)
+	r.observe("GetStatistics", start, err)
+	return stats, err
+}
+
+// ClaimOutboxEvents claims outbox events of the wrapped repository
+func (r *instrumentedRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxEvent, error) {
+	start := time.Now()
+	events, err := r.repo.ClaimOutboxEvents(ctx, limit, lease)
+	r.observe("ClaimOutboxEvents", start, err)
+	return events, err
+}
+
+// MarkOutboxEventSent deletes a sent outbox event from the wrapped repository
+func (r *instrumentedRepository) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	start := time.Now()
+	err := r.repo.MarkOutboxEventSent(ctx, id)
+	r.observe("MarkOutboxEventSent", start, err)
+	return err
+}
+
+// MarkOutboxEventFailed schedules a failed outbox event of the wrapped repository for a retry
+func (r *instrumentedRepository) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	start := time.Now()
+	err := r.repo.MarkOutboxEventFailed(ctx, id, reason, retryAfter)
+	r.observe("MarkOutboxEventFailed", start, err)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys deletes expired idempotency keys from the wrapped repository
+func (r *instrumentedRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, keyTTL time.Duration) (int64, error) {
+	start := time.Now()
+	deleted, err := r.repo.DeleteExpiredIdempotencyKeys(ctx, keyTTL)
+	r.observe("DeleteExpiredIdempotencyKeys", start, err)
+	return deleted, err
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"httpchat/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatisticsFunc returns the current message statistics
+type StatisticsFunc func(ctx context.Context) (*model.Statistics, error)
+
+// statisticsCollector mirrors model.Statistics as gauges. The statistics are read with
+// a timeout and reused until they are cacheTTL old, so that frequent scrapes do not
+// load the storage. mu is held while they are read, so concurrent scrapes wait for a
+// single read instead of starting their own.
+type statisticsCollector struct {
+	statistics StatisticsFunc
+	timeout    time.Duration
+	cacheTTL   time.Duration
+	stored     *prometheus.Desc
+	messages   *prometheus.Desc
+
+	mu      sync.Mutex
+	stats   *model.Statistics
+	err     error
+	expires time.Time
+}
+
+// RegisterStatistics exports the message statistics returned by statistics. Each read
+// is bounded by timeout and its result is served for cacheTTL. While they cannot be
+// read the statistics are left out and the scrape counts the error.
+func (m *Metrics) RegisterStatistics(statistics StatisticsFunc, timeout, cacheTTL time.Duration) {
+	m.registry.MustRegister(&statisticsCollector{
+		statistics: statistics,
+		timeout:    timeout,
+		cacheTTL:   cacheTTL,
+		stored: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "messages_stored"),
+			"Messages in storage.",
+			nil, nil,
+		),
+		messages: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "messages"),
+			"Messages in storage by status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+// Describe sends the descriptors of the statistics gauges
+func (c *statisticsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.stored
+	ch <- c.messages
+}
+
+// Collect sends the cached statistics as gauges, reading them first when they have expired
+func (c *statisticsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.read()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.messages, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.stored, prometheus.GaugeValue, float64(stats.TotalMessages))
+	for status, count := range map[model.MessageStatus]int64{
+		model.StatusPending:      stats.PendingMessages,
+		model.StatusProcessing:   stats.ProcessingMessages,
+		model.StatusProcessed:    stats.ProcessedMessages,
+		model.StatusFailed:       stats.FailedMessages,
+		model.StatusDeadLettered: stats.DeadLetteredMessages,
+	} {
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
+
+// read returns the cached statistics or reads them when they have expired
+func (c *statisticsCollector) read() (*model.Statistics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(c.expires) {
+		return c.stats, c.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// A failed read is cached as well, so that an unavailable storage is not queried on every scrape
+	c.stats, c.err = c.statistics(ctx)
+	c.expires = now.Add(c.cacheTTL)
+	return c.stats, c.err
+}
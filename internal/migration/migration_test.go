@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load(embedded)
+	assert.NoError(t, err)
+
+	if assert.NotEmpty(t, migrations) {
+		assert.Equal(t, 1, migrations[0].Version)
+		assert.Equal(t, "create_messages", migrations[0].Name)
+	}
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	// Test that migrations are ordered by version, not by file order
+	t.Run("OrdersByVersion", func(t *testing.T) {
+		migrations, err := Load(fstest.MapFS{
+			"migrations/0002_second.up.sql":   file("CREATE TABLE b ();"),
+			"migrations/0002_second.down.sql": file("DROP TABLE b;"),
+			"migrations/0001_first.up.sql":    file("CREATE TABLE a ();"),
+			"migrations/0001_first.down.sql":  file("DROP TABLE a;"),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"},
+			{Version: 2, Name: "second", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;"},
+		}, migrations)
+	})
+
+	tests := map[string]fstest.MapFS{
+		"MissingDown": {
+			"migrations/0001_first.up.sql": file("CREATE TABLE a ();"),
+		},
+		"GapInVersions": {
+			"migrations/0001_first.up.sql":   file("CREATE TABLE a ();"),
+			"migrations/0001_first.down.sql": file("DROP TABLE a;"),
+			"migrations/0003_third.up.sql":   file("CREATE TABLE c ();"),
+			"migrations/0003_third.down.sql": file("DROP TABLE c;"),
+		},
+		"MismatchedNames": {
+			"migrations/0001_first.up.sql":   file("CREATE TABLE a ();"),
+			"migrations/0001_other.down.sql": file("DROP TABLE a;"),
+		},
+		"UnexpectedFile": {
+			"migrations/README.md": file("notes"),
+		},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(fsys)
+			assert.Error(t, err)
+		})
+	}
+}
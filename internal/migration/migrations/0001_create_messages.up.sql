@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS messages (
+	id SERIAL PRIMARY KEY,
+	content TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	processed_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Upgrade tables created before the status lifecycle existed: add the new
+-- columns and convert the old processed flag into a status
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;
+
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'messages' AND column_name = 'processed'
+	) THEN
+		UPDATE messages SET status = 'processed', processed_at = updated_at WHERE processed;
+		ALTER TABLE messages DROP COLUMN processed;
+	END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_messages_processed;
+CREATE INDEX IF NOT EXISTS idx_messages_status ON messages(status);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at_id ON messages(created_at, id);
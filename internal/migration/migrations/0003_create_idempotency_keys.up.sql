@@ -0,0 +1,10 @@
+-- message_id is filled in by the same transaction that claims the key
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	fingerprint TEXT NOT NULL,
+	message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Expired keys are found by age when they are reused and when they are cleaned up
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode converts the cursor into an opaque URL-safe token
+func (c MessageCursor) Encode() string {
+	// Marshaling a struct of a time and an int cannot fail
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeMessageCursor parses a token produced by MessageCursor.Encode
+func DecodeMessageCursor(token string) (*MessageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var cursor MessageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	if cursor.ID <= 0 || cursor.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Metadata of the events produced by this service
+const (
+	// EventSchemaVersion is the envelope version written by this release
+	EventSchemaVersion = 1
+	// EventTypeMessageCreated is the type of the event recorded for every new message
+	EventTypeMessageCreated = "message.created"
+	// EventSource identifies this service as the producer of an event
+	EventSource = "httpchat"
+	// EventContentType is the content type of encoded events
+	EventContentType = "application/json"
+)
+
+// Headers sent with every event
+const (
+	HeaderContentType   = "content-type"
+	HeaderCorrelationID = "x-correlation-id"
+)
+
+// ErrUnsupportedEventVersion is returned for events written by a newer release
+var ErrUnsupportedEventVersion = errors.New("unsupported event schema version")
+
+// EventEnvelope wraps the data of an event with its metadata.
+//
+// Version 0 events predate the envelope: their value is the bare message JSON. They are
+// still decoded, so that events published before an upgrade are processed after it.
+type EventEnvelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Source        string          `json:"source"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Data          json.RawMessage `json:"data"`
+	// TraceContext holds the W3C trace context of the request that recorded the event,
+	// which the outbox relay sends along as headers
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// NewMessageCreatedEvent builds the event recorded when message is created at now.
+// A new event starts its own correlation, so its correlation ID is its event ID.
+func NewMessageCreatedEvent(message *Message, now time.Time) (*EventEnvelope, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	eventID, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventEnvelope{
+		SchemaVersion: EventSchemaVersion,
+		EventID:       eventID,
+		EventType:     EventTypeMessageCreated,
+		ProducedAt:    now.UTC(),
+		Source:        EventSource,
+		CorrelationID: eventID,
+		Data:          data,
+	}, nil
+}
+
+// Encode converts the envelope into the value of an event
+func (e *EventEnvelope) Encode() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Headers returns the headers sent with the event
+func (e *EventEnvelope) Headers() map[string]string {
+	headers := map[string]string{HeaderContentType: EventContentType}
+	if e.CorrelationID != "" {
+		headers[HeaderCorrelationID] = e.CorrelationID
+	}
+	for key, value := range e.TraceContext {
+		headers[key] = value
+	}
+	return headers
+}
+
+// Message decodes the message carried by a message.created event
+func (e *EventEnvelope) Message() (*Message, error) {
+	if e.EventType != EventTypeMessageCreated {
+		return nil, fmt.Errorf("unexpected event type %q", e.EventType)
+	}
+
+	var message Message
+	if err := json.Unmarshal(e.Data, &message); err != nil {
+		return nil, fmt.Errorf("failed to decode event data: %w", err)
+	}
+	return &message, nil
+}
+
+// DecodeEvent parses the value of an event of any supported schema version
+func DecodeEvent(value []byte) (*EventEnvelope, error) {
+	var envelope EventEnvelope
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	switch envelope.SchemaVersion {
+	case 0:
+		// A bare message from before the envelope
+		return &EventEnvelope{
+			EventType: EventTypeMessageCreated,
+			Data:      json.RawMessage(value),
+		}, nil
+	case 1:
+		if envelope.EventID == "" || envelope.EventType == "" || len(envelope.Data) == 0 {
+			return nil, errors.New("failed to decode event: envelope is incomplete")
+		}
+		return &envelope, nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedEventVersion, envelope.SchemaVersion)
+	}
+}
+
+// MessageEventKey returns the partition key of the events of a message, which keeps
+// them in order
+func MessageEventKey(messageID int64) []byte {
+	return []byte(strconv.FormatInt(messageID, 10))
+}
+
+// newEventID returns a random version 4 UUID
+func newEventID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageCreatedEvent(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+	message := &Message{ID: 7, Content: "hello", Status: StatusPending}
+
+	envelope, err := NewMessageCreatedEvent(message, now)
+	assert.NoError(t, err)
+	assert.Equal(t, EventSchemaVersion, envelope.SchemaVersion)
+	assert.Equal(t, EventTypeMessageCreated, envelope.EventType)
+	assert.Equal(t, EventSource, envelope.Source)
+	assert.Equal(t, now.UTC(), envelope.ProducedAt)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, envelope.EventID)
+	assert.Equal(t, envelope.EventID, envelope.CorrelationID)
+	assert.Equal(t, map[string]string{
+		HeaderContentType:   EventContentType,
+		HeaderCorrelationID: envelope.EventID,
+	}, envelope.Headers())
+
+	// Every event gets an ID of its own
+	other, err := NewMessageCreatedEvent(message, now)
+	assert.NoError(t, err)
+	assert.NotEqual(t, envelope.EventID, other.EventID)
+
+	// The encoded event decodes back into the same envelope and message
+	value, err := envelope.Encode()
+	assert.NoError(t, err)
+	decoded, err := DecodeEvent(value)
+	if assert.NoError(t, err) {
+		assert.Equal(t, envelope.EventID, decoded.EventID)
+		assert.True(t, envelope.ProducedAt.Equal(decoded.ProducedAt))
+		decodedMessage, err := decoded.Message()
+		assert.NoError(t, err)
+		assert.Equal(t, message.ID, decodedMessage.ID)
+		assert.Equal(t, message.Content, decodedMessage.Content)
+	}
+
+	// The stored trace context is sent along with the other headers
+	envelope.TraceContext = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	assert.Equal(t, map[string]string{
+		HeaderContentType:   EventContentType,
+		HeaderCorrelationID: envelope.EventID,
+		"traceparent":       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}, envelope.Headers())
+}
+
+func TestDecodeEvent(t *testing.T) {
+	// Events from before the envelope are the bare message
+	legacy, _ := json.Marshal(&Message{ID: 3, Content: "legacy"})
+	envelope, err := DecodeEvent(legacy)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, envelope.SchemaVersion)
+		assert.Equal(t, EventTypeMessageCreated, envelope.EventType)
+		message, err := envelope.Message()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), message.ID)
+		assert.Equal(t, "legacy", message.Content)
+		assert.Equal(t, map[string]string{HeaderContentType: EventContentType}, envelope.Headers())
+	}
+
+	// Events of a newer release are rejected
+	_, err = DecodeEvent([]byte(`{"schema_version":2,"event_id":"e","event_type":"message.created","data":{}}`))
+	assert.ErrorIs(t, err, ErrUnsupportedEventVersion)
+
+	// Incomplete envelopes and invalid JSON are rejected
+	_, err = DecodeEvent([]byte(`{"schema_version":1,"event_type":"message.created","data":{}}`))
+	assert.Error(t, err)
+	_, err = DecodeEvent([]byte("not json"))
+	assert.Error(t, err)
+
+	// Only message.created events carry a message
+	envelope, err = DecodeEvent([]byte(`{"schema_version":1,"event_id":"e","event_type":"message.deleted","data":{"id":1}}`))
+	if assert.NoError(t, err) {
+		_, err = envelope.Message()
+		assert.Error(t, err)
+	}
+}
+
+func TestMessageEventKey(t *testing.T) {
+	assert.Equal(t, []byte("42"), MessageEventKey(42))
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// KafkaMessage is a message read from or written to a Kafka topic along with its metadata
+type KafkaMessage struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Time      time.Time
+	// HighWaterMark is the offset after the last message of the partition when the
+	// message was fetched, or 0 when the broker does not report it
+	HighWaterMark int64
+}
+
+// BatchSendError reports which messages of a batch could not be sent.
+// It holds one entry per message of the batch; nil entries were sent.
+type BatchSendError []error
+
+func (e BatchSendError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d messages could not be sent: %v", failed, len(e), first)
+}
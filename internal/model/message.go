@@ -2,21 +2,80 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // Message represents a message in the system
 type Message struct {
-	ID        int64     `json:"id" db:"id"`
-	Content   string    `json:"content" db:"content"`
-	Processed bool      `json:"processed" db:"processed"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID          int64         `json:"id" db:"id"`
+	Content     string        `json:"content" db:"content"`
+	Status      MessageStatus `json:"status" db:"status"`
+	Attempts    int           `json:"attempts" db:"attempts"`
+	LastError   string        `json:"last_error,omitempty" db:"last_error"`
+	ProcessedAt *time.Time    `json:"processed_at,omitempty" db:"processed_at"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" db:"updated_at"`
 }
 
-// Statistics represents message statistics
+// Statistics represents message counts per lifecycle state
 type Statistics struct {
-	TotalMessages       int64 `json:"total_messages" db:"total_messages"`
-	ProcessedMessages   int64 `json:"processed_messages" db:"processed_messages"`
-	UnprocessedMessages int64 `json:"unprocessed_messages" db:"unprocessed_messages"`
+	TotalMessages        int64 `json:"total_messages" db:"total_messages"`
+	PendingMessages      int64 `json:"pending_messages" db:"pending_messages"`
+	ProcessingMessages   int64 `json:"processing_messages" db:"processing_messages"`
+	ProcessedMessages    int64 `json:"processed_messages" db:"processed_messages"`
+	FailedMessages       int64 `json:"failed_messages" db:"failed_messages"`
+	DeadLetteredMessages int64 `json:"dead_lettered_messages" db:"dead_lettered_messages"`
+}
+
+// MarshalJSON adds the processed field, derived from the status. The field is deprecated
+// and only kept for clients of the former processed flag; they should read status instead.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return json.Marshal(struct {
+		message
+		Processed bool `json:"processed"`
+	}{message(m), m.Status == StatusProcessed})
+}
+
+// MarshalJSON adds the unprocessed_messages field, the messages that are pending, processing
+// or failed. The field is deprecated and only kept for clients of the former statistics; they
+// should read the counts per state instead.
+func (s Statistics) MarshalJSON() ([]byte, error) {
+	type statistics Statistics
+	return json.Marshal(struct {
+		statistics
+		UnprocessedMessages int64 `json:"unprocessed_messages"`
+	}{statistics(s), s.PendingMessages + s.ProcessingMessages + s.FailedMessages})
+}
+
+// SortOrder defines the direction in which messages are listed
+type SortOrder string
+
+// Supported sort orders for message listing
+const (
+	SortOrderAsc  SortOrder = "asc"
+	SortOrderDesc SortOrder = "desc"
+)
+
+// MessageCursor points to a position in the (created_at, id) keyset
+type MessageCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        int64     `json:"id"`
+}
+
+// MessageFilter contains the filters and keyset pagination parameters for listing messages
+type MessageFilter struct {
+	Status      *MessageStatus
+	CreatedFrom *time.Time // inclusive lower bound for created_at
+	CreatedTo   *time.Time // exclusive upper bound for created_at
+	Order       SortOrder
+	Limit       int
+	After       *MessageCursor // return only messages positioned after this cursor
+}
+
+// MessagePage represents a single page of listed messages
+type MessagePage struct {
+	Messages   []*Message `json:"messages"`
+	NextCursor string     `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageJSONKeepsProcessed(t *testing.T) {
+	for status, processed := range map[MessageStatus]bool{
+		StatusPending:   false,
+		StatusFailed:    false,
+		StatusProcessed: true,
+	} {
+		data, err := json.Marshal(&Message{ID: 1, Content: "hello", Status: status})
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		var fields map[string]any
+		assert.NoError(t, json.Unmarshal(data, &fields))
+		assert.Equal(t, processed, fields["processed"], "status %s", status)
+		assert.Equal(t, string(status), fields["status"])
+		assert.Equal(t, "hello", fields["content"])
+
+		// The derived field does not get in the way of decoding
+		var decoded Message
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, status, decoded.Status)
+	}
+}
+
+func TestStatisticsJSONKeepsUnprocessed(t *testing.T) {
+	data, err := json.Marshal(Statistics{
+		TotalMessages:        15,
+		PendingMessages:      1,
+		ProcessingMessages:   2,
+		ProcessedMessages:    4,
+		FailedMessages:       3,
+		DeadLetteredMessages: 5,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, 6.0, fields["unprocessed_messages"])
+	assert.Equal(t, 4.0, fields["processed_messages"])
+	assert.Equal(t, 15.0, fields["total_messages"])
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// OutboxEvent represents a pending Kafka event recorded alongside a message
+type OutboxEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	MessageID int64     `json:"message_id" db:"message_id"`
+	Payload   []byte    `json:"payload" db:"payload"`
+	Attempts  int       `json:"attempts" db:"attempts"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
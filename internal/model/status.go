@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MessageStatus is the lifecycle state of a message
+type MessageStatus string
+
+// Message lifecycle states
+const (
+	StatusPending      MessageStatus = "pending"       // created, not yet picked up
+	StatusProcessing   MessageStatus = "processing"    // claimed by a processing attempt
+	StatusProcessed    MessageStatus = "processed"     // processed successfully
+	StatusFailed       MessageStatus = "failed"        // last attempt failed, may be retried
+	StatusDeadLettered MessageStatus = "dead_lettered" // retries exhausted, needs manual attention
+)
+
+// ErrInvalidStatus is returned when a status string is not a known lifecycle state
+var ErrInvalidStatus = errors.New("invalid message status")
+
+// MessageStatuses lists every lifecycle state in display order
+var MessageStatuses = []MessageStatus{
+	StatusPending,
+	StatusProcessing,
+	StatusProcessed,
+	StatusFailed,
+	StatusDeadLettered,
+}
+
+// statusTransitions maps each state to the states it may legally move to
+var statusTransitions = map[MessageStatus][]MessageStatus{
+	// A message may fail before it is claimed, e.g. when the database is unavailable
+	StatusPending: {StatusProcessing, StatusFailed, StatusDeadLettered},
+	// processing -> processing lets a redelivered event reclaim a message after a crash
+	StatusProcessing: {StatusProcessing, StatusProcessed, StatusFailed, StatusDeadLettered},
+	StatusFailed:     {StatusProcessing, StatusFailed, StatusDeadLettered},
+	// Replaying a dead-lettered message starts its lifecycle over
+	StatusDeadLettered: {StatusPending},
+	StatusProcessed:    {},
+}
+
+// Valid reports whether s is a known lifecycle state
+func (s MessageStatus) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether a message in state s may move to state next
+func (s MessageStatus) CanTransitionTo(next MessageStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseMessageStatus converts a string into a known lifecycle state
+func ParseMessageStatus(value string) (MessageStatus, error) {
+	status := MessageStatus(value)
+	if !status.Valid() {
+		return "", fmt.Errorf("%w: %q", ErrInvalidStatus, value)
+	}
+	return status, nil
+}
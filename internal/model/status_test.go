@@ -0,0 +1,35 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageStatusTransitions(t *testing.T) {
+	// Legal transitions along the normal and retry paths
+	assert.True(t, StatusPending.CanTransitionTo(StatusProcessing))
+	assert.True(t, StatusProcessing.CanTransitionTo(StatusProcessed))
+	assert.True(t, StatusProcessing.CanTransitionTo(StatusFailed))
+	assert.True(t, StatusFailed.CanTransitionTo(StatusProcessing))
+	assert.True(t, StatusFailed.CanTransitionTo(StatusDeadLettered))
+	assert.True(t, StatusDeadLettered.CanTransitionTo(StatusPending))
+
+	// Illegal transitions
+	assert.False(t, StatusPending.CanTransitionTo(StatusProcessed))
+	assert.False(t, StatusProcessed.CanTransitionTo(StatusProcessing))
+	assert.False(t, StatusDeadLettered.CanTransitionTo(StatusProcessing))
+	assert.False(t, MessageStatus("unknown").CanTransitionTo(StatusPending))
+}
+
+func TestParseMessageStatus(t *testing.T) {
+	for _, status := range MessageStatuses {
+		parsed, err := ParseMessageStatus(string(status))
+		assert.NoError(t, err)
+		assert.Equal(t, status, parsed)
+	}
+
+	_, err := ParseMessageStatus("done")
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+}
@@ -0,0 +1,96 @@
+// Package natsbroker provides NATS JetStream implementations of the Kafka interfaces.
+package natsbroker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// keyHeader carries the key of a message, which NATS has no field for
+const keyHeader = "x-message-key"
+
+// streamClient is the part of jetstream.JetStream used by the adapter, so that tests can replace it
+type streamClient interface {
+	PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+	PublishMsgAsync(msg *nats.Msg, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error)
+	CreateOrUpdateStream(ctx context.Context, cfg jetstream.StreamConfig) (jetstream.Stream, error)
+	CreateOrUpdateConsumer(ctx context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error)
+}
+
+// Broker maps topics onto JetStream streams. Every topic is stored in its own stream
+// whose only subject is the topic name, and every consumer group is a durable pull
+// consumer of that stream. JetStream has no partitions, so all messages of a topic
+// are delivered from partition 0 and their offset is the stream sequence.
+type Broker struct {
+	js      streamClient
+	ackWait time.Duration
+	close   func()
+
+	// streams holds the topics whose stream is known to exist
+	mu      sync.Mutex
+	streams map[string]bool
+}
+
+// Connect connects to the NATS server at url. Messages that are not acknowledged within
+// ackWait are delivered again, so it must cover processing including its retries.
+func Connect(url string, ackWait time.Duration) (*Broker, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	return newBroker(js, ackWait, conn.Close), nil
+}
+
+// newBroker creates a broker on top of a JetStream client
+func newBroker(js streamClient, ackWait time.Duration, close func()) *Broker {
+	return &Broker{
+		js:      js,
+		ackWait: ackWait,
+		close:   close,
+		streams: make(map[string]bool),
+	}
+}
+
+// streamName returns the name of the stream holding a topic.
+// Stream and consumer names must not contain the subject separators.
+func streamName(topic string) string {
+	return strings.ToUpper(nameReplacer.Replace(topic))
+}
+
+// nameReplacer replaces the characters that stream and consumer names must not contain
+var nameReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "/", "_", "\\", "_")
+
+// ensureStream creates the stream of a topic unless it is known to exist
+func (b *Broker) ensureStream(ctx context.Context, topic string) (string, error) {
+	name := streamName(topic)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.streams[topic] {
+		return name, nil
+	}
+
+	_, err := b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     name,
+		Subjects: []string{topic},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create JetStream stream %s: %w", name, err)
+	}
+	b.streams[topic] = true
+	return name, nil
+}
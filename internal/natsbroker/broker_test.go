@@ -0,0 +1,302 @@
+package natsbroker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts an in-process NATS server with JetStream enabled
+func newTestServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create NATS server:", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+// connect connects a broker to the server, as a process would
+func connect(t *testing.T, srv *server.Server, ackWait time.Duration) *Broker {
+	t.Helper()
+
+	broker, err := Connect(srv.ClientURL(), ackWait)
+	if err != nil {
+		t.Fatal("Failed to connect to NATS:", err)
+	}
+	t.Cleanup(func() {
+		_ = broker.NewProducer().Close()
+	})
+	return broker
+}
+
+// newJetStream opens a JetStream client of its own, to look at streams and consumers
+// or to wrap in a faultyJetStream
+func newJetStream(t *testing.T, srv *server.Server) jetstream.JetStream {
+	t.Helper()
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal("Failed to connect to NATS:", err)
+	}
+	t.Cleanup(conn.Close)
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal("Failed to create JetStream context:", err)
+	}
+	return js
+}
+
+// faultyJetStream is a real JetStream client that fails the publishes and consumer setups it is told to
+type faultyJetStream struct {
+	jetstream.JetStream
+	failPublish string
+	consumerErr error
+}
+
+func (f *faultyJetStream) PublishMsgAsync(msg *nats.Msg, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	if string(msg.Data) == f.failPublish {
+		return nil, errors.New("stream full")
+	}
+	return f.JetStream.PublishMsgAsync(msg, opts...)
+}
+
+func (f *faultyJetStream) CreateOrUpdateConsumer(ctx context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	if f.consumerErr != nil {
+		return nil, f.consumerErr
+	}
+	return f.JetStream.CreateOrUpdateConsumer(ctx, stream, cfg)
+}
+
+// fetch reads the next message or fails the test if none arrives in time
+func fetch(t *testing.T, consumer *Consumer) interfaces.KafkaDelivery {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	delivery, err := consumer.FetchMessage(ctx, "")
+	if err != nil {
+		t.Fatal("Failed to fetch message:", err)
+	}
+	return delivery
+}
+
+// batch builds a batch of unkeyed messages with the given values
+func batch(values ...string) []*model.KafkaMessage {
+	messages := make([]*model.KafkaMessage, len(values))
+	for i, value := range values {
+		messages[i] = &model.KafkaMessage{Value: []byte(value)}
+	}
+	return messages
+}
+
+func TestBrokerSendAndFetch(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+	broker := connect(t, srv, time.Minute)
+	producer := broker.NewProducer()
+
+	assert.NoError(t, producer.SendMessage(ctx, "messages.dlq", []byte("first")))
+	assert.NoError(t, producer.SendMessageWithHeaders(ctx, "messages.dlq", []byte("second"), map[string]string{"x-attempts": "3"}))
+	assert.NoError(t, producer.SendMessages(ctx, "messages.dlq", batch("third", "fourth")))
+	assert.NoError(t, producer.SendMessageWithKey(ctx, "messages.dlq", []byte("7"), []byte("fifth"), map[string]string{"x-correlation-id": "abc"}))
+
+	// The topic is stored in a stream of its own
+	js := newJetStream(t, srv)
+	stream, err := js.Stream(ctx, "MESSAGES_DLQ")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"messages.dlq"}, stream.CachedInfo().Config.Subjects)
+		assert.Equal(t, uint64(5), stream.CachedInfo().State.Msgs)
+	}
+
+	consumer := broker.NewConsumer("messages.dlq", "message-dlq-replayer")
+	delivery := fetch(t, consumer)
+
+	// The consumer group is a durable consumer with explicit acknowledgements
+	info, err := js.Consumer(ctx, "MESSAGES_DLQ", "message-dlq-replayer")
+	if assert.NoError(t, err) {
+		cfg := info.CachedInfo().Config
+		assert.Equal(t, jetstream.AckExplicitPolicy, cfg.AckPolicy)
+		assert.Equal(t, jetstream.DeliverAllPolicy, cfg.DeliverPolicy)
+		assert.Equal(t, time.Minute, cfg.AckWait)
+		assert.Equal(t, "messages.dlq", cfg.FilterSubject)
+	}
+
+	message := delivery.Message()
+	assert.Equal(t, "messages.dlq", message.Topic)
+	assert.Equal(t, 0, message.Partition)
+	assert.Equal(t, int64(1), message.Offset)
+	assert.Equal(t, []byte("first"), message.Value)
+	assert.Nil(t, message.Key)
+	assert.Nil(t, message.Headers)
+	assert.WithinDuration(t, time.Now(), message.Time, time.Minute)
+
+	delivery = fetch(t, consumer)
+	assert.Equal(t, int64(2), delivery.Message().Offset)
+	assert.Equal(t, map[string]string{"x-attempts": "3"}, delivery.Message().Headers)
+	for _, expected := range []string{"third", "fourth"} {
+		assert.Equal(t, []byte(expected), fetch(t, consumer).Message().Value)
+	}
+
+	// The key travels in a header of its own
+	delivery = fetch(t, consumer)
+	assert.Equal(t, []byte("7"), delivery.Message().Key)
+	assert.Equal(t, map[string]string{"x-correlation-id": "abc"}, delivery.Message().Headers)
+
+	// Fetching stops at the deadline of the context
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = consumer.FetchMessage(timeoutCtx, "messages.dlq")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBrokerCommitAndNack(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+	broker := connect(t, srv, time.Minute)
+	assert.NoError(t, broker.NewProducer().SendMessages(ctx, "messages", batch("first", "second", "third")))
+
+	consumer := broker.NewConsumer("messages", "message-processor-group")
+	first := fetch(t, consumer)
+	second := fetch(t, consumer)
+
+	// A nacked message is delivered again without waiting for the ack wait
+	assert.NoError(t, consumer.Commit(ctx, first))
+	assert.NoError(t, second.Nack(ctx))
+	var offsets []int64
+	for i := 0; i < 2; i++ {
+		delivery := fetch(t, consumer)
+		offsets = append(offsets, delivery.Message().Offset)
+		assert.NoError(t, delivery.Commit(ctx))
+	}
+	assert.ElementsMatch(t, []int64{2, 3}, offsets)
+
+	info, err := newJetStream(t, srv).Consumer(ctx, "MESSAGES", "message-processor-group")
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(3), info.CachedInfo().AckFloor.Stream)
+		assert.Equal(t, 0, info.CachedInfo().NumAckPending)
+	}
+
+	// Another process of the group resumes after the acknowledged messages
+	assert.NoError(t, broker.NewProducer().SendMessage(ctx, "messages", []byte("fourth")))
+	resumed := connect(t, srv, time.Minute).NewConsumer("messages", "message-processor-group")
+	assert.Equal(t, []byte("fourth"), fetch(t, resumed).Message().Value)
+	assert.NoError(t, consumer.Close())
+}
+
+func TestBrokerRedeliversUnacknowledged(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+	broker := connect(t, srv, 200*time.Millisecond)
+	assert.NoError(t, broker.NewProducer().SendMessage(ctx, "messages", []byte("first")))
+
+	// A message that is neither committed nor nacked comes back once the ack wait expires
+	consumer := broker.NewConsumer("messages", "message-processor-group")
+	delivery := fetch(t, consumer)
+	redelivered := fetch(t, consumer)
+	assert.Equal(t, delivery.Message().Offset, redelivered.Message().Offset)
+	assert.Equal(t, []byte("first"), redelivered.Message().Value)
+}
+
+func TestBrokerConsumerGroups(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+	broker := connect(t, srv, time.Minute)
+	assert.NoError(t, broker.NewProducer().SendMessages(ctx, "messages", batch("first", "second")))
+
+	// Every group reads every message, while the members of a group share them
+	other := broker.NewConsumer("messages", "audit")
+	first := broker.NewConsumer("messages", "processor")
+	second := connect(t, srv, time.Minute).NewConsumer("messages", "processor")
+
+	assert.Equal(t, []byte("first"), fetch(t, other).Message().Value)
+	assert.Equal(t, []byte("second"), fetch(t, other).Message().Value)
+
+	values := []string{
+		string(fetch(t, first).Message().Value),
+		string(fetch(t, second).Message().Value),
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, values)
+}
+
+func TestBrokerErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("PartialBatchFailure", func(t *testing.T) {
+		srv := newTestServer(t)
+		js := &faultyJetStream{JetStream: newJetStream(t, srv), failPublish: "second"}
+
+		err := newBroker(js, time.Minute, nil).NewProducer().SendMessages(ctx, "messages", batch("first", "second"))
+		var batchErr model.BatchSendError
+		if assert.True(t, errors.As(err, &batchErr)) {
+			assert.NoError(t, batchErr[0])
+			assert.Error(t, batchErr[1])
+		}
+
+		stream, err := js.Stream(ctx, "MESSAGES")
+		if assert.NoError(t, err) {
+			assert.Equal(t, uint64(1), stream.CachedInfo().State.Msgs)
+		}
+	})
+
+	t.Run("PublishFailure", func(t *testing.T) {
+		srv := newTestServer(t)
+		producer := connect(t, srv, time.Minute).NewProducer()
+		assert.NoError(t, producer.SendMessage(ctx, "messages", []byte("first")))
+		srv.Shutdown()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		assert.Error(t, producer.SendMessage(timeoutCtx, "messages", []byte("second")))
+		err := producer.SendMessages(timeoutCtx, "messages", batch("third", "fourth"))
+		assert.Error(t, err)
+		assert.False(t, errors.As(err, new(model.BatchSendError)))
+	})
+
+	t.Run("ConsumerSetupFailure", func(t *testing.T) {
+		srv := newTestServer(t)
+		js := &faultyJetStream{JetStream: newJetStream(t, srv), consumerErr: errors.New("consumer limit reached")}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := newBroker(js, time.Minute, nil).NewConsumer("messages", "group").FetchMessage(timeoutCtx, "messages")
+		assert.ErrorIs(t, err, js.consumerErr)
+	})
+
+	t.Run("CloseClosesConnection", func(t *testing.T) {
+		srv := newTestServer(t)
+		producer := connect(t, srv, time.Minute).NewProducer()
+		assert.NoError(t, producer.Close())
+		assert.ErrorIs(t, producer.SendMessage(ctx, "messages", []byte("first")), nats.ErrConnectionClosed)
+	})
+}
+
+func TestStreamName(t *testing.T) {
+	assert.Equal(t, "MESSAGES", streamName("messages"))
+	assert.Equal(t, "MESSAGES_DLQ", streamName("messages.dlq"))
+	assert.Equal(t, "CHAT_EVENTS__", streamName("chat.events.>"))
+}
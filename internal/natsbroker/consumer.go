@@ -0,0 +1,184 @@
+package natsbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// maxFetchWait bounds a single pull request, so that FetchMessage notices a cancelled context
+	maxFetchWait = time.Second
+
+	// setupRetryDelay is how long FetchMessage waits before reporting that the consumer
+	// could not be created, so that callers retrying right away do not spin
+	setupRetryDelay = time.Second
+)
+
+// Consumer implements the interfaces.KafkaConsumer interface for NATS JetStream.
+// Its consumer group is a durable pull consumer with explicit acknowledgements: a commit
+// acknowledges the message and a nack asks for it to be delivered again right away.
+type Consumer struct {
+	broker  *Broker
+	topic   string
+	groupID string
+
+	// consumer is created on the first fetch, since creating it needs the server
+	consumer jetstream.Consumer
+}
+
+// NewConsumer creates a consumer that reads the topic as a member of the consumer group
+func (b *Broker) NewConsumer(topic, groupID string) *Consumer {
+	return &Consumer{
+		broker:  b,
+		topic:   topic,
+		groupID: groupID,
+	}
+}
+
+// Ensure Consumer implements interfaces.KafkaConsumer
+var _ interfaces.KafkaConsumer = (*Consumer)(nil)
+
+// FetchMessage waits for the next message of the group without acknowledging it
+func (c *Consumer) FetchMessage(ctx context.Context, _ string) (interfaces.KafkaDelivery, error) {
+	if c.consumer == nil {
+		if err := c.setup(ctx); err != nil {
+			select {
+			case <-time.After(setupRetryDelay):
+			case <-ctx.Done():
+			}
+			return nil, err
+		}
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to read message from NATS: %w", ctx.Err())
+		}
+		wait := maxFetchWait
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			wait = time.Until(deadline)
+		}
+		if wait <= 0 {
+			// The deadline passed before the context noticed
+			return nil, fmt.Errorf("failed to read message from NATS: %w", context.DeadlineExceeded)
+		}
+
+		msg, err := c.consumer.Next(jetstream.FetchMaxWait(wait))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message from NATS: %w", err)
+		}
+
+		message, err := c.toMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &delivery{msg: msg, message: message}, nil
+	}
+}
+
+// setup creates the stream of the topic and the durable consumer of the group
+func (c *Consumer) setup(ctx context.Context) error {
+	stream, err := c.broker.ensureStream(ctx, c.topic)
+	if err != nil {
+		return err
+	}
+
+	consumer, err := c.broker.js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       nameReplacer.Replace(c.groupID),
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.broker.ackWait,
+		FilterSubject: c.topic,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream consumer %s: %w", c.groupID, err)
+	}
+	c.consumer = consumer
+	return nil
+}
+
+// toMessage converts a JetStream message into a model.KafkaMessage
+func (c *Consumer) toMessage(msg jetstream.Msg) (*model.KafkaMessage, error) {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JetStream message metadata: %w", err)
+	}
+
+	var key []byte
+	var headers map[string]string
+	for name := range msg.Headers() {
+		if name == keyHeader {
+			key = []byte(msg.Headers().Get(name))
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string, len(msg.Headers()))
+		}
+		headers[name] = msg.Headers().Get(name)
+	}
+
+	return &model.KafkaMessage{
+		Topic:   c.topic,
+		Offset:  int64(metadata.Sequence.Stream),
+		Key:     key,
+		Value:   msg.Data(),
+		Headers: headers,
+		Time:    metadata.Timestamp,
+	}, nil
+}
+
+// Commit acknowledges several deliveries and waits for the server to confirm each
+func (c *Consumer) Commit(ctx context.Context, deliveries ...interfaces.KafkaDelivery) error {
+	for _, d := range deliveries {
+		if err := d.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close leaves the consumer group; the durable consumer keeps its acknowledged position
+func (c *Consumer) Close() error {
+	return nil
+}
+
+// delivery implements interfaces.KafkaDelivery for a message fetched by Consumer
+type delivery struct {
+	msg     jetstream.Msg
+	message *model.KafkaMessage
+}
+
+// Ensure delivery implements interfaces.KafkaDelivery
+var _ interfaces.KafkaDelivery = (*delivery)(nil)
+
+// Message returns the fetched message
+func (d *delivery) Message() *model.KafkaMessage {
+	return d.message
+}
+
+// Commit acknowledges the message and waits for the server to confirm it
+func (d *delivery) Commit(ctx context.Context) error {
+	if err := d.msg.DoubleAck(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge NATS message: %w", err)
+	}
+	return nil
+}
+
+// Nack asks the server to deliver the message again
+func (d *delivery) Nack(_ context.Context) error {
+	if err := d.msg.Nak(); err != nil {
+		return fmt.Errorf("failed to nack NATS message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package natsbroker
+
+import (
+	"context"
+	"fmt"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Producer implements the interfaces.KafkaProducer interface for NATS JetStream
+type Producer struct {
+	broker *Broker
+}
+
+// NewProducer creates a producer that publishes to the streams of the broker
+func (b *Broker) NewProducer() *Producer {
+	return &Producer{broker: b}
+}
+
+// Ensure Producer implements interfaces.KafkaProducer
+var _ interfaces.KafkaProducer = (*Producer)(nil)
+
+// SendMessage publishes a message and waits until the stream has stored it
+func (p *Producer) SendMessage(ctx context.Context, topic string, message []byte) error {
+	return p.SendMessageWithHeaders(ctx, topic, message, nil)
+}
+
+// SendMessages publishes a batch of messages without waiting between them and then
+// waits until the stream has stored all of them
+func (p *Producer) SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	if _, err := p.broker.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+
+	errs := make(model.BatchSendError, len(messages))
+	futures := make([]jetstream.PubAckFuture, len(messages))
+	for i, message := range messages {
+		future, err := p.broker.js.PublishMsgAsync(newMsg(topic, message.Key, message.Value, message.Headers))
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to publish message to NATS: %w", err)
+			continue
+		}
+		futures[i] = future
+	}
+
+	failed := 0
+	for i, future := range futures {
+		if future != nil {
+			select {
+			case <-future.Ok():
+			case err := <-future.Err():
+				errs[i] = fmt.Errorf("failed to publish message to NATS: %w", err)
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("failed to publish message to NATS: %w", ctx.Err())
+			}
+		}
+		if errs[i] != nil {
+			failed++
+		}
+	}
+
+	switch failed {
+	case 0:
+		return nil
+	case len(messages):
+		return fmt.Errorf("failed to publish messages to NATS: %w", errs[0])
+	default:
+		return errs
+	}
+}
+
+// SendMessageWithHeaders publishes a message with the given headers and waits until the stream has stored it
+func (p *Producer) SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, headers)
+}
+
+// SendMessageWithKey publishes a message with the given key and headers and waits until the
+// stream has stored it. A stream keeps all its messages in order, so the key is only carried along.
+func (p *Producer) SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) error {
+	if _, err := p.broker.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+
+	if _, err := p.broker.js.PublishMsg(ctx, newMsg(topic, key, message, headers)); err != nil {
+		return fmt.Errorf("failed to publish message to NATS: %w", err)
+	}
+	return nil
+}
+
+// Close closes the NATS connection, which the consumers share, so they must be closed first
+func (p *Producer) Close() error {
+	if p.broker.close != nil {
+		p.broker.close()
+	}
+	return nil
+}
+
+// newMsg builds the NATS message published to the subject of a topic
+func newMsg(topic string, key, message []byte, headers map[string]string) *nats.Msg {
+	msg := nats.NewMsg(topic)
+	msg.Data = message
+	for name, value := range headers {
+		msg.Header.Set(name, value)
+	}
+	if len(key) > 0 {
+		msg.Header.Set(keyHeader, string(key))
+	}
+	return msg
+}
@@ -0,0 +1,168 @@
+// Package outbox provides the relay that publishes outbox events to Kafka.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+	"httpchat/internal/model"
+	"httpchat/internal/retry"
+
+	"go.uber.org/zap"
+)
+
+// A claimed batch stays hidden from other relays for leaseBase plus leasePerEvent for
+// every event in it. Publishing is cut off at half the lease, so the batch is always
+// published and marked before another relay can claim it again.
+const (
+	leaseBase     = 10 * time.Second
+	leasePerEvent = 50 * time.Millisecond
+)
+
+// leaseFor returns the lease for a batch of n events
+func leaseFor(n int) time.Duration {
+	return leaseBase + time.Duration(n)*leasePerEvent
+}
+
+// Relay periodically publishes pending outbox events to Kafka and marks them as sent.
+// A failed publish is retried once the backoff of the retry policy expires.
+// Delivery is at-least-once: an event may be published again if the relay crashes
+// between publishing it and marking it as sent.
+type Relay struct {
+	repo         interfaces.OutboxRepository
+	producer     interfaces.KafkaProducer
+	topic        string
+	batchSize    int
+	pollInterval time.Duration
+	retryPolicy  retry.Policy
+	logger       *logger.Logger
+}
+
+// NewRelay creates a new Relay instance
+func NewRelay(
+	repo interfaces.OutboxRepository,
+	producer interfaces.KafkaProducer,
+	topic string,
+	batchSize int,
+	pollInterval time.Duration,
+	retryPolicy retry.Policy,
+	logger *logger.Logger,
+) *Relay {
+	return &Relay{
+		repo:         repo,
+		producer:     producer,
+		topic:        topic,
+		batchSize:    batchSize,
+		pollInterval: pollInterval,
+		retryPolicy:  retryPolicy,
+		logger:       logger,
+	}
+}
+
+// Run publishes outbox events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep draining while full batches come back, then wait for the next tick
+		for {
+			published, err := r.RelayPending(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.logger.Error("Error relaying outbox events", zap.Error(err))
+				}
+				break
+			}
+			if published < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes a single batch of pending events and returns how many were claimed.
+// The batch is sent to Kafka in one write; events that fail are retried individually.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	lease := leaseFor(r.batchSize)
+	events, err := r.repo.ClaimOutboxEvents(ctx, r.batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	messages := make([]*model.KafkaMessage, len(events))
+	for i, event := range events {
+		messages[i] = r.eventMessage(event)
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, lease/2)
+	sendErr := r.producer.SendMessages(publishCtx, r.topic, messages)
+	cancel()
+
+	for i, event := range events {
+		if err := eventError(sendErr, i); err != nil {
+			r.logger.Warn("Failed to publish outbox event, will retry",
+				zap.Int64("outbox_id", event.ID),
+				zap.Int64("message_id", event.MessageID),
+				zap.Int("attempt", event.Attempts+1),
+				zap.Error(err))
+
+			// The event stays hidden until its backoff expires, which grows with every failed attempt
+			retryAfter := r.retryPolicy.Backoff(event.Attempts + 1)
+			if markErr := r.repo.MarkOutboxEventFailed(ctx, event.ID, err.Error(), retryAfter); markErr != nil {
+				r.logger.Error("Failed to record outbox publish failure", zap.Int64("outbox_id", event.ID), zap.Error(markErr))
+			}
+			continue
+		}
+
+		if err := r.repo.MarkOutboxEventSent(ctx, event.ID); err != nil {
+			// The event will be published again once its lease expires
+			r.logger.Error("Failed to mark outbox event as sent", zap.Int64("outbox_id", event.ID), zap.Error(err))
+			continue
+		}
+
+		r.logger.Info("Published outbox event", zap.Int64("outbox_id", event.ID), zap.Int64("message_id", event.MessageID))
+	}
+
+	return len(events), nil
+}
+
+// eventMessage builds the Kafka message of an outbox event. The message ID is the key, so
+// that the events of a message stay in order.
+func (r *Relay) eventMessage(event *model.OutboxEvent) *model.KafkaMessage {
+	message := &model.KafkaMessage{
+		Key:   model.MessageEventKey(event.MessageID),
+		Value: event.Payload,
+	}
+
+	envelope, err := model.DecodeEvent(event.Payload)
+	if err != nil {
+		// Published as-is, so that the processor dead-letters it
+		r.logger.Warn("Outbox event cannot be decoded", zap.Int64("outbox_id", event.ID), zap.Error(err))
+		return message
+	}
+	message.Headers = envelope.Headers()
+	return message
+}
+
+// eventError returns the error of the i-th event of a batch send
+func eventError(sendErr error, i int) error {
+	var batchErr model.BatchSendError
+	if errors.As(sendErr, &batchErr) {
+		return batchErr[i]
+	}
+	return sendErr
+}
@@ -0,0 +1,233 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/kafka/kafkatest"
+	"httpchat/internal/logger"
+	"httpchat/internal/model"
+	"httpchat/internal/retry"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockOutboxRepository implements interfaces.OutboxRepository for testing
+type mockOutboxRepository struct {
+	mu      sync.Mutex
+	events  []*model.OutboxEvent
+	sent    []int64
+	failed  map[int64]string
+	delays  map[int64]time.Duration
+	claimed int
+	lease   time.Duration
+}
+
+func newMockOutboxRepository(events ...*model.OutboxEvent) *mockOutboxRepository {
+	return &mockOutboxRepository{
+		events: events,
+		failed: make(map[int64]string),
+		delays: make(map[int64]time.Duration),
+	}
+}
+
+func (m *mockOutboxRepository) ClaimOutboxEvents(_ context.Context, limit int, lease time.Duration) ([]*model.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lease = lease
+	remaining := m.events[m.claimed:]
+	if len(remaining) > limit {
+		remaining = remaining[:limit]
+	}
+	m.claimed += len(remaining)
+	return remaining, nil
+}
+
+func (m *mockOutboxRepository) MarkOutboxEventSent(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, id)
+	return nil
+}
+
+func (m *mockOutboxRepository) MarkOutboxEventFailed(_ context.Context, id int64, reason string, retryAfter time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed[id] = reason
+	m.delays[id] = retryAfter
+	return nil
+}
+
+func (m *mockOutboxRepository) sentCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+// Ensure mockOutboxRepository implements interfaces.OutboxRepository
+var _ interfaces.OutboxRepository = (*mockOutboxRepository)(nil)
+
+// testPolicy backs off from one second up to a minute
+var testPolicy = retry.Policy{InitialInterval: time.Second, MaxInterval: time.Minute, Multiplier: 2}
+
+func TestRelayPending(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// Test that events are published in order and marked as sent
+	t.Run("PublishesAndMarksSent", func(t *testing.T) {
+		repo := newMockOutboxRepository(
+			&model.OutboxEvent{ID: 1, MessageID: 10, Payload: []byte("first")},
+			&model.OutboxEvent{ID: 2, MessageID: 11, Payload: []byte("second")},
+		)
+		producer := &kafkatest.Producer{}
+
+		relay := NewRelay(repo, producer, "test-topic", 10, time.Second, testPolicy, testLogger)
+
+		published, err := relay.RelayPending(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, published)
+		if sent := producer.Sent(); assert.Len(t, sent, 2) {
+			assert.Equal(t, []byte("first"), sent[0].Value)
+			assert.Equal(t, []byte("second"), sent[1].Value)
+		}
+		assert.Equal(t, []int64{1, 2}, repo.sent)
+		assert.Empty(t, repo.failed)
+
+		// The batch goes out in a single write
+		assert.Equal(t, 1, producer.Batches())
+	})
+
+	// Test that events are keyed by their message and carry the headers of their envelope
+	t.Run("SetsKeyAndHeaders", func(t *testing.T) {
+		envelope, err := model.NewMessageCreatedEvent(&model.Message{ID: 10, Content: "hello"}, time.Now())
+		assert.NoError(t, err)
+		payload, err := envelope.Encode()
+		assert.NoError(t, err)
+		repo := newMockOutboxRepository(
+			&model.OutboxEvent{ID: 1, MessageID: 10, Payload: payload},
+			&model.OutboxEvent{ID: 2, MessageID: 11, Payload: []byte("not an event")},
+		)
+		producer := &kafkatest.Producer{}
+
+		relay := NewRelay(repo, producer, "test-topic", 10, time.Second, testPolicy, testLogger)
+
+		_, err = relay.RelayPending(context.Background())
+		assert.NoError(t, err)
+		if sent := producer.Sent(); assert.Len(t, sent, 2) {
+			assert.Equal(t, []byte("10"), sent[0].Key)
+			assert.Equal(t, map[string]string{
+				model.HeaderContentType:   model.EventContentType,
+				model.HeaderCorrelationID: envelope.EventID,
+			}, sent[0].Headers)
+
+			// An event that cannot be decoded is still published, without headers
+			assert.Equal(t, []byte("11"), sent[1].Key)
+			assert.Nil(t, sent[1].Headers)
+		}
+		assert.Equal(t, []int64{1, 2}, repo.sent)
+	})
+
+	// Test that a batch that fails as a whole is retried event by event
+	t.Run("RecordsBatchFailure", func(t *testing.T) {
+		repo := newMockOutboxRepository(
+			&model.OutboxEvent{ID: 1, MessageID: 10, Payload: []byte("first")},
+			&model.OutboxEvent{ID: 2, MessageID: 11, Payload: []byte("second")},
+		)
+		producer := &kafkatest.Producer{Err: errors.New("kafka unavailable")}
+
+		relay := NewRelay(repo, producer, "test-topic", 10, time.Second, testPolicy, testLogger)
+
+		_, err := relay.RelayPending(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, repo.sent)
+		assert.Contains(t, repo.failed[1], "kafka unavailable")
+		assert.Contains(t, repo.failed[2], "kafka unavailable")
+	})
+
+	// Test that the lease grows with the batch size
+	t.Run("SizesLeaseFromBatch", func(t *testing.T) {
+		small := newMockOutboxRepository()
+		_, err := NewRelay(small, &kafkatest.Producer{}, "test-topic", 10, time.Second, testPolicy, testLogger).RelayPending(context.Background())
+		assert.NoError(t, err)
+
+		large := newMockOutboxRepository()
+		_, err = NewRelay(large, &kafkatest.Producer{}, "test-topic", 1000, time.Second, testPolicy, testLogger).RelayPending(context.Background())
+		assert.NoError(t, err)
+
+		assert.Equal(t, leaseFor(10), small.lease)
+		assert.Equal(t, leaseFor(1000), large.lease)
+		assert.Greater(t, large.lease, small.lease)
+	})
+
+	// Test that a failed publish is recorded and does not block the rest of the batch
+	t.Run("RecordsFailures", func(t *testing.T) {
+		repo := newMockOutboxRepository(
+			&model.OutboxEvent{ID: 1, MessageID: 10, Payload: []byte("broken"), Attempts: 2},
+			&model.OutboxEvent{ID: 2, MessageID: 11, Payload: []byte("second")},
+		)
+		producer := &kafkatest.Producer{FailOn: "broken"}
+
+		relay := NewRelay(repo, producer, "test-topic", 10, time.Second, testPolicy, testLogger)
+
+		_, err := relay.RelayPending(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2}, repo.sent)
+		assert.Contains(t, repo.failed[1], "kafka write error")
+
+		// The third failure waits at most four times the initial interval
+		assert.LessOrEqual(t, repo.delays[1], 4*time.Second)
+	})
+
+	// Test that only one batch is claimed per call
+	t.Run("RespectsBatchSize", func(t *testing.T) {
+		repo := newMockOutboxRepository(
+			&model.OutboxEvent{ID: 1, Payload: []byte("1")},
+			&model.OutboxEvent{ID: 2, Payload: []byte("2")},
+			&model.OutboxEvent{ID: 3, Payload: []byte("3")},
+		)
+		producer := &kafkatest.Producer{}
+
+		relay := NewRelay(repo, producer, "test-topic", 2, time.Second, testPolicy, testLogger)
+
+		published, err := relay.RelayPending(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, published)
+		assert.Len(t, producer.Sent(), 2)
+	})
+}
+
+func TestRelayRun(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	repo := newMockOutboxRepository(
+		&model.OutboxEvent{ID: 1, Payload: []byte("1")},
+		&model.OutboxEvent{ID: 2, Payload: []byte("2")},
+		&model.OutboxEvent{ID: 3, Payload: []byte("3")},
+	)
+	producer := &kafkatest.Producer{}
+
+	relay := NewRelay(repo, producer, "test-topic", 2, 10*time.Millisecond, testPolicy, testLogger)
+
+	// Run drains all full batches immediately and stops when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return repo.sentCount() == 3
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Relay did not stop after context cancellation")
+	}
+}
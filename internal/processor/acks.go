@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"context"
+	"sync"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// partitionKey identifies a partition of a topic
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// pendingAck is a fetched delivery waiting to be committed or nacked
+type pendingAck struct {
+	delivery interfaces.KafkaDelivery
+	settled  bool
+	commit   bool
+}
+
+// partitionQueue holds the unflushed deliveries of a partition in fetch order
+type partitionQueue struct {
+	acks []*pendingAck
+
+	// flushing is set while a goroutine flushes the head of the queue
+	flushing bool
+}
+
+// ackTracker settles deliveries in the order they were fetched from each partition.
+// Workers finish events out of order, but committing a later offset would also commit
+// every earlier one, so a delivery is only committed or nacked once all deliveries
+// fetched before it from the same partition have been settled.
+//
+// Commits happen outside the lock. While one goroutine flushes a partition, deliveries
+// settled by other workers are left for it and committed with its next batch.
+type ackTracker struct {
+	mu       sync.Mutex
+	pending  map[partitionKey]*partitionQueue
+	consumer interfaces.KafkaConsumer
+	logger   *logger.Logger
+}
+
+// newAckTracker creates a new ackTracker instance
+func newAckTracker(consumer interfaces.KafkaConsumer, logger *logger.Logger) *ackTracker {
+	return &ackTracker{
+		pending:  make(map[partitionKey]*partitionQueue),
+		consumer: consumer,
+		logger:   logger,
+	}
+}
+
+// track registers a delivery; it must be called in fetch order
+func (t *ackTracker) track(delivery interfaces.KafkaDelivery) *pendingAck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ack := &pendingAck{delivery: delivery}
+	key := keyOf(delivery)
+	queue, ok := t.pending[key]
+	if !ok {
+		queue = &partitionQueue{}
+		t.pending[key] = queue
+	}
+	queue.acks = append(queue.acks, ack)
+	return ack
+}
+
+// settle records the outcome of a delivery and flushes every settled delivery at the
+// head of its partition, unless another goroutine is already flushing it
+func (t *ackTracker) settle(ctx context.Context, ack *pendingAck, commit bool) {
+	t.mu.Lock()
+	ack.settled = true
+	ack.commit = commit
+
+	key := keyOf(ack.delivery)
+	queue := t.pending[key]
+	if queue.flushing {
+		t.mu.Unlock()
+		return
+	}
+	queue.flushing = true
+
+	for {
+		n := 0
+		for n < len(queue.acks) && queue.acks[n].settled {
+			n++
+		}
+		if n == 0 {
+			break
+		}
+		head := queue.acks[:n]
+		queue.acks = queue.acks[n:]
+
+		t.mu.Unlock()
+		t.flush(ctx, head)
+		t.mu.Lock()
+	}
+
+	queue.flushing = false
+	if len(queue.acks) == 0 {
+		delete(t.pending, key)
+	}
+	t.mu.Unlock()
+}
+
+// flush commits or nacks settled deliveries in order. Consecutive commits go out in one request.
+func (t *ackTracker) flush(ctx context.Context, acks []*pendingAck) {
+	var commits []interfaces.KafkaDelivery
+	for _, ack := range acks {
+		if ack.commit {
+			commits = append(commits, ack.delivery)
+			continue
+		}
+		t.commit(ctx, commits)
+		commits = nil
+
+		if err := ack.delivery.Nack(ctx); err != nil {
+			t.logger.Error("Failed to nack Kafka message", zap.Int64("offset", ack.delivery.Message().Offset), zap.Error(err))
+		}
+	}
+	t.commit(ctx, commits)
+}
+
+// commit commits a batch of deliveries of the same partition
+func (t *ackTracker) commit(ctx context.Context, deliveries []interfaces.KafkaDelivery) {
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := t.consumer.Commit(ctx, deliveries...); err != nil {
+		// The events are delivered again, which the message status transitions make harmless
+		t.logger.Error("Failed to commit Kafka messages",
+			zap.Int64("first_offset", deliveries[0].Message().Offset),
+			zap.Int64("last_offset", deliveries[len(deliveries)-1].Message().Offset),
+			zap.Error(err))
+	}
+}
+
+// keyOf returns the partition a delivery was fetched from
+func keyOf(delivery interfaces.KafkaDelivery) partitionKey {
+	message := delivery.Message()
+	return partitionKey{topic: message.Topic, partition: message.Partition}
+}
@@ -0,0 +1,377 @@
+// Package processor provides the worker pool that processes message events from Kafka.
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"httpchat/internal/dlq"
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+	"httpchat/internal/model"
+	"httpchat/internal/requestid"
+	"httpchat/internal/retry"
+	"httpchat/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Processor fetches message events from Kafka and processes them on a pool of workers.
+// Events are hashed to workers by message ID, so events sharing a key are processed in
+// the order they were fetched. A failed event is retried as the retry policy allows
+// without blocking its worker; once the policy gives up it is sent to the dead-letter
+// topic, unless the error is not retryable, in which case the event is skipped.
+// An offset is only committed once its event was processed, skipped or dead-lettered;
+// a failed dead-letter publish is retried like processing until it succeeds or the
+// processor shuts down.
+type Processor struct {
+	service      interfaces.MessageService
+	consumer     interfaces.KafkaConsumer
+	deadLetters  *dlq.Publisher
+	topic        string
+	workers      int
+	retryPolicy  retry.Policy
+	drainTimeout time.Duration
+	metrics      Metrics
+	logger       *logger.Logger
+
+	acks *ackTracker
+
+	// The state of the fetch loop, reported by Check
+	stateMu      sync.Mutex
+	fetching     bool
+	failingSince time.Time
+}
+
+// fetchFailureGrace is how long fetches may keep failing before Check reports the
+// processor as not ready, which rides out a broker restart or a rebalance
+const fetchFailureGrace = 30 * time.Second
+
+// Metrics records the attempts to process events
+type Metrics interface {
+	// ObserveProcessing records an attempt to process an event and its outcome
+	ObserveProcessing(outcome string, duration time.Duration)
+	// ObserveRetry records a failed attempt that will be retried
+	ObserveRetry()
+}
+
+// Outcomes of an attempt to process an event
+const (
+	outcomeProcessed = "processed"
+	outcomeSkipped   = "skipped"
+	outcomeFailed    = "failed"
+)
+
+// nopMetrics is used when the processor is created without metrics
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveProcessing(string, time.Duration) {}
+func (nopMetrics) ObserveRetry()                           {}
+
+// New creates a new Processor instance
+func New(
+	service interfaces.MessageService,
+	consumer interfaces.KafkaConsumer,
+	deadLetters *dlq.Publisher,
+	topic string,
+	workers int,
+	retryPolicy retry.Policy,
+	drainTimeout time.Duration,
+	metrics Metrics,
+	logger *logger.Logger,
+) *Processor {
+	if workers < 1 {
+		workers = 1
+	}
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+	return &Processor{
+		service:      service,
+		consumer:     consumer,
+		deadLetters:  deadLetters,
+		topic:        topic,
+		workers:      workers,
+		retryPolicy:  retryPolicy,
+		drainTimeout: drainTimeout,
+		metrics:      metrics,
+		logger:       logger,
+		acks:         newAckTracker(consumer, logger),
+	}
+}
+
+// Run processes events until ctx is cancelled. Events already handed to a worker are
+// then given up to the drain timeout to finish; whatever is left is nacked so that it
+// is delivered again.
+func (p *Processor) Run(ctx context.Context) {
+	// Workers keep running after ctx is cancelled so that they can drain
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	stopping := make(chan struct{})
+	workers := make([]*worker, p.workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		workers[i] = newWorker(p)
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.run(workCtx, stopping)
+		}(workers[i])
+	}
+
+	p.setFetching(true)
+	p.fetch(ctx, workCtx, workers)
+	p.setFetching(false)
+
+	p.logger.Info("Kafka message processor shutting down")
+
+	close(stopping)
+	for _, w := range workers {
+		close(w.jobs)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(p.drainTimeout):
+		p.logger.Warn("Kafka message processor did not drain in time, remaining events will be delivered again",
+			zap.Duration("drain_timeout", p.drainTimeout))
+		cancelWork()
+		<-drained
+	}
+}
+
+// fetch reads events and hands them to the workers until ctx is cancelled
+func (p *Processor) fetch(ctx, workCtx context.Context, workers []*worker) {
+	for {
+		delivery, err := p.consumer.FetchMessage(ctx, p.topic)
+		p.recordFetch(err)
+		if err != nil {
+			// Check if context was cancelled
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("Error reading message from Kafka", zap.Error(err))
+			continue
+		}
+		ack := p.acks.track(delivery)
+
+		j := &job{ack: ack}
+		log := p.logger.FromContext(eventContext(ctx, delivery.Message()))
+
+		// Decode the message from the event envelope of any supported version
+		message, err := decodeMessage(delivery.Message().Value)
+		if err != nil {
+			log.Error("Error decoding message", zap.Error(err))
+
+			// An event that cannot be decoded will never succeed, so it is dead-lettered right away.
+			// Such events share key 0, which keeps their dead-letter retries in fetch order.
+			j.message = model.Message{}
+			j.attempts = 1
+			j.deadLetter = fmt.Errorf("failed to decode message: %w", err)
+		} else {
+			j.message = *message
+			log.Info("Processing Kafka message", zap.Int64("id", j.message.ID))
+		}
+
+		w := workers[uint64(j.message.ID)%uint64(len(workers))]
+		select {
+		case w.jobs <- j:
+		case <-ctx.Done():
+			p.acks.settle(workCtx, ack, false)
+			return
+		}
+	}
+}
+
+// setFetching records whether the fetch loop is running
+func (p *Processor) setFetching(fetching bool) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.fetching = fetching
+	p.failingSince = time.Time{}
+}
+
+// recordFetch records the outcome of a fetch
+func (p *Processor) recordFetch(err error) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if err == nil {
+		p.failingSince = time.Time{}
+	} else if p.failingSince.IsZero() {
+		p.failingSince = time.Now()
+	}
+}
+
+// Check reports whether the processor is fetching events. It fails before Run starts,
+// after it stops fetching, and once fetches have failed for longer than fetchFailureGrace.
+func (p *Processor) Check(context.Context) error {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if !p.fetching {
+		return errors.New("processor is not fetching events")
+	}
+	if !p.failingSince.IsZero() && time.Since(p.failingSince) > fetchFailureGrace {
+		return fmt.Errorf("fetching events has failed since %s", p.failingSince.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// decodeMessage decodes the message carried by an event
+func decodeMessage(value []byte) (*model.Message, error) {
+	envelope, err := model.DecodeEvent(value)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Message()
+}
+
+// attempt processes an event once and reports whether it is finished. An event that is
+// not finished must be attempted again after the returned delay.
+func (p *Processor) attempt(ctx context.Context, j *job) (bool, time.Duration) {
+	if ctx.Err() != nil {
+		// The drain timeout expired
+		return false, 0
+	}
+
+	ctx = eventContext(ctx, j.ack.delivery.Message())
+	log := p.logger.FromContext(ctx)
+
+	ctx, span := p.startProcessSpan(ctx, j)
+	defer span.End()
+
+	if j.deadLetter != nil {
+		return p.attemptDeadLetter(ctx, j)
+	}
+	if j.attempts == 0 {
+		j.firstAttempt = time.Now()
+	}
+
+	start := time.Now()
+	processErr := p.service.ProcessMessage(ctx, j.message.ID)
+	if processErr == nil {
+		span.SetAttributes(attribute.String("httpchat.outcome", outcomeProcessed))
+		p.metrics.ObserveProcessing(outcomeProcessed, time.Since(start))
+		log.Info("Successfully processed Kafka message", zap.Int64("id", j.message.ID))
+		p.acks.settle(ctx, j.ack, true)
+		return true, 0
+	}
+
+	span.RecordError(processErr)
+
+	// Errors such as a missing or dead-lettered message cannot be fixed by retrying
+	if !p.retryPolicy.IsRetryable(processErr) {
+		span.SetAttributes(attribute.String("httpchat.outcome", outcomeSkipped))
+		p.metrics.ObserveProcessing(outcomeSkipped, time.Since(start))
+		log.Warn("Skipping message that cannot be processed", zap.Int64("id", j.message.ID), zap.Error(processErr))
+		p.acks.settle(ctx, j.ack, true)
+		return true, 0
+	}
+
+	if ctx.Err() != nil {
+		// Interrupted by the drain timeout, which does not count as an attempt
+		return false, 0
+	}
+	j.attempts++
+	span.SetAttributes(attribute.String("httpchat.outcome", outcomeFailed))
+	span.SetStatus(codes.Error, processErr.Error())
+	p.metrics.ObserveProcessing(outcomeFailed, time.Since(start))
+
+	// Record the failed attempt; this is best effort since the database may be the cause
+	if err := p.service.FailMessage(ctx, j.message.ID, processErr.Error()); err != nil {
+		log.Warn("Failed to record failed processing attempt", zap.Int64("id", j.message.ID), zap.Error(err))
+	}
+
+	// Retry for other errors (including database connection errors)
+	if delay, ok := p.retryPolicy.Next(j.attempts, time.Since(j.firstAttempt), processErr); ok {
+		p.metrics.ObserveRetry()
+		log.Warn("Error processing message, retrying",
+			zap.Int64("id", j.message.ID),
+			zap.Int("attempt", j.attempts),
+			zap.Duration("retry_delay", delay),
+			zap.Error(processErr))
+		return false, delay
+	}
+
+	log.Error("Failed to process message after retries",
+		zap.Int64("id", j.message.ID),
+		zap.Int("attempts", j.attempts),
+		zap.Error(processErr))
+
+	j.deadLetter = processErr
+	return p.attemptDeadLetter(ctx, j)
+}
+
+// eventContext returns ctx carrying the correlation ID sent with an event as the request
+// ID, so that the logs of processing share the ID of the request that created the message
+func eventContext(ctx context.Context, message *model.KafkaMessage) context.Context {
+	if id := message.Headers[model.HeaderCorrelationID]; id != "" {
+		ctx = requestid.NewContext(ctx, id)
+		return logger.ContextWithFields(ctx, zap.String("request_id", id))
+	}
+	return ctx
+}
+
+// startProcessSpan starts the span of an attempt to process an event. It continues the
+// trace whose context was sent with the event, so that processing shows up in the trace
+// of the request that created the message.
+func (p *Processor) startProcessSpan(ctx context.Context, j *job) (context.Context, trace.Span) {
+	message := j.ack.delivery.Message()
+	return tracing.Tracer().Start(tracing.Extract(ctx, message.Headers), p.topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingDestinationName(p.topic),
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(message.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+			attribute.Int64("httpchat.message_id", j.message.ID),
+		),
+	)
+}
+
+// attemptDeadLetter publishes an event to the dead-letter topic. Without a copy in the
+// dead-letter topic the event must stay uncommitted, so a failed publish is retried after
+// the backoff of the retry policy; it never gives up, since the partition cannot move past
+// the event until it has been committed.
+func (p *Processor) attemptDeadLetter(ctx context.Context, j *job) (bool, time.Duration) {
+	log := p.logger.FromContext(ctx)
+	message := j.ack.delivery.Message()
+	if err := p.deadLetters.Publish(ctx, message, j.deadLetter, j.attempts); err != nil {
+		if ctx.Err() != nil {
+			// Interrupted by the drain timeout
+			return false, 0
+		}
+		j.deadLetterAttempts++
+		delay := p.retryPolicy.Backoff(j.deadLetterAttempts)
+		log.Error("Failed to publish message to dead-letter topic, retrying",
+			zap.Int64("offset", message.Offset),
+			zap.Int("attempt", j.deadLetterAttempts),
+			zap.Duration("retry_delay", delay),
+			zap.Error(err))
+		return false, delay
+	}
+
+	// Mark the message so it can be told apart from one that was never picked up.
+	// Events that could not be decoded have no message to mark.
+	if j.message.ID != 0 {
+		if err := p.service.DeadLetterMessage(ctx, j.message.ID, j.deadLetter.Error()); err != nil {
+			log.Error("Failed to dead-letter message", zap.Int64("id", j.message.ID), zap.Error(err))
+		}
+	}
+	p.acks.settle(ctx, j.ack, true)
+	return true, 0
+}
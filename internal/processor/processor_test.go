@@ -0,0 +1,602 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"httpchat/internal/dlq"
+	"httpchat/internal/interfaces"
+	"httpchat/internal/kafka/kafkatest"
+	"httpchat/internal/logger"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+	"httpchat/internal/requestid"
+	"httpchat/internal/retry"
+	"httpchat/internal/tracing/tracingtest"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// mockMessageService records the order in which messages are processed
+type mockMessageService struct {
+	mu           sync.Mutex
+	processed    []int64
+	deadLettered []int64
+	processFunc  func(ctx context.Context, id int64, call int) error
+	calls        map[int64]int
+}
+
+func newMockMessageService(processFunc func(ctx context.Context, id int64, call int) error) *mockMessageService {
+	return &mockMessageService{
+		processFunc: processFunc,
+		calls:       make(map[int64]int),
+	}
+}
+
+func (m *mockMessageService) CreateMessage(_ context.Context, _ string) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockMessageService) CreateMessageIdempotent(_ context.Context, _, _ string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (m *mockMessageService) ProcessMessage(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	m.calls[id]++
+	call := m.calls[id]
+	m.processed = append(m.processed, id)
+	m.mu.Unlock()
+
+	if m.processFunc != nil {
+		return m.processFunc(ctx, id, call)
+	}
+	return nil
+}
+
+func (m *mockMessageService) FailMessage(_ context.Context, _ int64, _ string) error {
+	return nil
+}
+
+func (m *mockMessageService) DeadLetterMessage(_ context.Context, id int64, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLettered = append(m.deadLettered, id)
+	return nil
+}
+
+func (m *mockMessageService) GetMessage(_ context.Context, _ int64) (*model.Message, error) {
+	return nil, nil
+}
+
+func (m *mockMessageService) ListMessages(_ context.Context, _ model.MessageFilter) (*model.MessagePage, error) {
+	return nil, nil
+}
+
+func (m *mockMessageService) GetStatistics(_ context.Context) (*model.Statistics, error) {
+	return nil, nil
+}
+
+func (m *mockMessageService) processOrder() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int64(nil), m.processed...)
+}
+
+// Ensure mockMessageService implements interfaces.MessageService
+var _ interfaces.MessageService = (*mockMessageService)(nil)
+
+// eventMessages builds the events of the messages with ids on a single partition
+func eventMessages(ids ...int64) []*model.KafkaMessage {
+	messages := make([]*model.KafkaMessage, len(ids))
+	for i, id := range ids {
+		envelope, _ := model.NewMessageCreatedEvent(&model.Message{ID: id}, time.Now())
+		payload, _ := envelope.Encode()
+		messages[i] = &model.KafkaMessage{
+			Topic:   "messages",
+			Offset:  int64(i),
+			Key:     model.MessageEventKey(id),
+			Value:   payload,
+			Headers: envelope.Headers(),
+		}
+	}
+	return messages
+}
+
+// testPolicy returns a retry policy that allows four attempts
+func testPolicy(interval time.Duration) retry.Policy {
+	return retry.Policy{
+		InitialInterval: interval,
+		Multiplier:      2,
+		MaxAttempts:     4,
+		Retryable:       retry.RepositoryRetryable,
+	}
+}
+
+// runProcessor runs the processor until all n events are settled and returns once it stopped
+func runProcessor(t *testing.T, p *Processor, consumer *kafkatest.Consumer, n int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		committed, nacked := consumer.Settled()
+		return len(committed)+len(nacked) == n
+	}, 2*time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestProcessorCommitsInFetchOrder(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// Odd IDs take longer, so events finish out of order
+	service := newMockMessageService(func(_ context.Context, id int64, _ int) error {
+		if id%2 == 1 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	})
+	consumer := kafkatest.NewConsumer(eventMessages(1, 2, 3, 4, 5, 6, 7, 8)...)
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 4, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+	runProcessor(t, p, consumer, 8)
+
+	committed, nacked := consumer.Settled()
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7}, committed)
+	assert.Empty(t, nacked)
+}
+
+func TestProcessorDecodesEventVersions(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	service := newMockMessageService(nil)
+	legacy, _ := json.Marshal(model.Message{ID: 2})
+	consumer := kafkatest.NewConsumer(append(eventMessages(1),
+		&model.KafkaMessage{Topic: "messages", Offset: 1, Value: legacy},
+		&model.KafkaMessage{Topic: "messages", Offset: 2, Value: []byte(`{"schema_version":2,"event_id":"e","event_type":"message.created","data":{"id":3}}`)},
+	)...)
+	producer := &kafkatest.Producer{}
+	p := New(service, consumer, dlq.NewPublisher(producer, "messages.dlq"), "messages", 2, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+	runProcessor(t, p, consumer, 3)
+
+	// Events from before the envelope are processed too, events of a newer version are dead-lettered
+	assert.ElementsMatch(t, []int64{1, 2}, service.processOrder())
+	if sent := producer.Sent(); assert.Len(t, sent, 1) {
+		assert.Contains(t, sent[0].Headers[dlq.HeaderError], model.ErrUnsupportedEventVersion.Error())
+	}
+	committed, _ := consumer.Settled()
+	assert.Equal(t, []int64{0, 1, 2}, committed)
+}
+
+func TestProcessorBatchesCommits(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// The first commit blocks until the other events have been processed
+	commitStarted := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	service := newMockMessageService(func(_ context.Context, id int64, _ int) error {
+		if id != 1 {
+			<-commitStarted
+		}
+		return nil
+	})
+	consumer := kafkatest.NewConsumer(eventMessages(1, 2, 3, 4)...)
+	consumer.BeforeCommit = func() {
+		once.Do(func() {
+			close(commitStarted)
+			<-release
+		})
+	}
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 4, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	// The other workers settle their events while the first commit is in flight
+	assert.Eventually(t, func() bool {
+		return len(service.processOrder()) == 4
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		committed, _ := consumer.Settled()
+		return len(committed) == 4
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, [][]int64{{0}, {1, 2, 3}}, consumer.Batches())
+}
+
+func TestProcessorRetriesInKeyOrder(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// The first attempt of message 1 fails
+	service := newMockMessageService(func(_ context.Context, id int64, call int) error {
+		if id == 1 && call == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	// The second event of message 1 must wait until the first one has been retried
+	consumer := kafkatest.NewConsumer(eventMessages(1, 1)...)
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+	runProcessor(t, p, consumer, 2)
+
+	assert.Equal(t, []int64{1, 1, 1}, service.processOrder())
+	committed, nacked := consumer.Settled()
+	assert.Equal(t, []int64{0, 1}, committed)
+	assert.Empty(t, nacked)
+}
+
+func TestProcessorRetryDoesNotBlockOtherKeys(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	service := newMockMessageService(func(_ context.Context, id int64, _ int) error {
+		if id == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	// A single worker owns both keys; message 1 waits for its retry while message 2 is processed
+	consumer := kafkatest.NewConsumer(eventMessages(1, 2, 1)...)
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Hour), time.Second, nil, testLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(service.processOrder()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// The second event of message 1 stays parked behind the first one
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, []int64{1, 2}, service.processOrder())
+
+	// Offset 1 is finished but cannot be committed before offset 0
+	committed, _ := consumer.Settled()
+	assert.Empty(t, committed)
+
+	cancel()
+	<-done
+}
+
+func TestProcessorDeadLettersAfterRetries(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	service := newMockMessageService(func(_ context.Context, _ int64, _ int) error {
+		return errors.New("database unavailable")
+	})
+	consumer := kafkatest.NewConsumer(eventMessages(7)...)
+	producer := &kafkatest.Producer{}
+	p := New(service, consumer, dlq.NewPublisher(producer, "messages.dlq"), "messages", 2, retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 3}, time.Second, nil, testLogger)
+
+	runProcessor(t, p, consumer, 1)
+
+	assert.Equal(t, []int64{7, 7, 7}, service.processOrder())
+	assert.Equal(t, []int64{7}, service.deadLettered)
+	if sent := producer.Sent(); assert.Len(t, sent, 1) {
+		assert.Equal(t, "3", sent[0].Headers[dlq.HeaderAttempts])
+	}
+	committed, _ := consumer.Settled()
+	assert.Equal(t, []int64{0}, committed)
+}
+
+// recordingMetrics records the outcomes reported by the processor
+type recordingMetrics struct {
+	mu       sync.Mutex
+	outcomes []string
+	retries  int
+}
+
+func (m *recordingMetrics) ObserveProcessing(outcome string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outcomes = append(m.outcomes, outcome)
+}
+
+func (m *recordingMetrics) ObserveRetry() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries++
+}
+
+func TestProcessorRecordsMetrics(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// Message 1 succeeds on its second attempt and message 2 no longer exists
+	service := newMockMessageService(func(_ context.Context, id int64, call int) error {
+		if id == 2 {
+			return repositoryerr.New(repositoryerr.ErrorCodeMessageNotFound, "ProcessMessage", repositoryerr.ErrMessageNotFound)
+		}
+		if call == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+	consumer := kafkatest.NewConsumer(eventMessages(1, 2)...)
+	metrics := &recordingMetrics{}
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Millisecond), time.Second, metrics, testLogger)
+
+	runProcessor(t, p, consumer, 2)
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	assert.ElementsMatch(t, []string{outcomeFailed, outcomeSkipped, outcomeProcessed}, metrics.outcomes)
+	assert.Equal(t, 1, metrics.retries)
+}
+
+func TestProcessorContinuesTrace(t *testing.T) {
+	testLogger, _ := logger.New()
+	exporter := tracingtest.Install(t)
+
+	// The service sees the span of the attempt, which its storage spans continue
+	var serviceSpans []trace.SpanContext
+	var mu sync.Mutex
+	service := newMockMessageService(func(ctx context.Context, _ int64, call int) error {
+		mu.Lock()
+		serviceSpans = append(serviceSpans, trace.SpanContextFromContext(ctx))
+		mu.Unlock()
+		if call == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	// Message 1 was sent from a traced request and message 2 carries no trace context
+	messages := eventMessages(1, 2)
+	messages[0].Headers["traceparent"] = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	consumer := kafkatest.NewConsumer(messages...)
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+	runProcessor(t, p, consumer, 2)
+
+	var traced, untraced []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		assert.Equal(t, "messages process", span.Name)
+		assert.Equal(t, trace.SpanKindConsumer, span.SpanKind)
+		if span.Parent.IsValid() {
+			traced = append(traced, span)
+		} else {
+			untraced = append(untraced, span)
+		}
+	}
+
+	// Every attempt of message 1 joins the trace of the request, and the failed one is marked
+	if assert.Len(t, traced, 2) {
+		for _, span := range traced {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+		}
+		assert.Equal(t, codes.Error, traced[0].Status.Code)
+		assert.Equal(t, codes.Unset, traced[1].Status.Code)
+	}
+	assert.Len(t, untraced, 2)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, serviceSpans, 4)
+	for _, spanContext := range serviceSpans {
+		assert.True(t, spanContext.IsValid())
+	}
+}
+
+func TestProcessorLogsCorrelationID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	// The service sees the request ID of the event, so that its logs carry it too
+	var serviceIDs []string
+	var mu sync.Mutex
+	service := newMockMessageService(func(ctx context.Context, _ int64, _ int) error {
+		mu.Lock()
+		serviceIDs = append(serviceIDs, requestid.FromContext(ctx))
+		mu.Unlock()
+		return nil
+	})
+
+	// Message 1 was created by a request and message 2 carries no correlation ID
+	messages := eventMessages(1, 2)
+	messages[0].Headers[model.HeaderCorrelationID] = "req-1"
+	delete(messages[1].Headers, model.HeaderCorrelationID)
+	consumer := kafkatest.NewConsumer(messages...)
+	p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Millisecond), time.Second, nil, &logger.Logger{Logger: zap.New(core)})
+
+	runProcessor(t, p, consumer, 2)
+
+	processing := logs.FilterMessage("Processing Kafka message").All()
+	if assert.Len(t, processing, 2) {
+		assert.Equal(t, "req-1", processing[0].ContextMap()["request_id"])
+		assert.NotContains(t, processing[1].ContextMap(), "request_id")
+	}
+	processed := logs.FilterMessage("Successfully processed Kafka message").FilterField(zap.String("request_id", "req-1"))
+	assert.Equal(t, 1, processed.Len())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"req-1", ""}, serviceIDs)
+}
+
+func TestProcessorCheck(t *testing.T) {
+	testLogger, _ := logger.New()
+	consumer := kafkatest.NewConsumer()
+	p := New(newMockMessageService(nil), consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+	// Not ready before the fetch loop runs
+	assert.Error(t, p.Check(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool { return p.Check(context.Background()) == nil }, time.Second, time.Millisecond)
+
+	// Failing fetches are tolerated for a while
+	p.recordFetch(errors.New("broker down"))
+	assert.NoError(t, p.Check(context.Background()))
+	p.stateMu.Lock()
+	p.failingSince = time.Now().Add(-fetchFailureGrace - time.Second)
+	p.stateMu.Unlock()
+	assert.Error(t, p.Check(context.Background()))
+	p.recordFetch(nil)
+	assert.NoError(t, p.Check(context.Background()))
+
+	// Not ready once it stops fetching
+	cancel()
+	<-done
+	assert.Error(t, p.Check(context.Background()))
+}
+
+func TestProcessorRetriesDeadLetterPublish(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// Test that the event is committed once the dead-letter topic accepts it
+	t.Run("CommitsAfterPublish", func(t *testing.T) {
+		service := newMockMessageService(func(_ context.Context, _ int64, _ int) error {
+			return errors.New("database unavailable")
+		})
+		consumer := kafkatest.NewConsumer(eventMessages(7, 8)...)
+		producer := &kafkatest.Producer{Failures: 2}
+		p := New(service, consumer, dlq.NewPublisher(producer, "messages.dlq"), "messages", 1, retry.Policy{InitialInterval: time.Millisecond, MaxAttempts: 1}, time.Second, nil, testLogger)
+
+		runProcessor(t, p, consumer, 2)
+
+		assert.ElementsMatch(t, []int64{7, 8}, service.deadLettered)
+		assert.Equal(t, 4, producer.Calls())
+		committed, nacked := consumer.Settled()
+		assert.Equal(t, []int64{0, 1}, committed)
+		assert.Empty(t, nacked)
+	})
+
+	// Test that an event that never reaches the dead-letter topic is nacked on shutdown
+	t.Run("NacksOnShutdown", func(t *testing.T) {
+		service := newMockMessageService(nil)
+		consumer := kafkatest.NewConsumer(&model.KafkaMessage{Topic: "messages", Value: []byte("not json")})
+		producer := &kafkatest.Producer{Failures: -1}
+		p := New(service, consumer, dlq.NewPublisher(producer, "messages.dlq"), "messages", 2, testPolicy(time.Millisecond), time.Second, nil, testLogger)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.Run(ctx)
+		}()
+
+		// The publish keeps being retried instead of giving up after MaxAttempts
+		assert.Eventually(t, func() bool {
+			return producer.Calls() > 5
+		}, 2*time.Second, 5*time.Millisecond)
+		committed, nacked := consumer.Settled()
+		assert.Empty(t, committed)
+		assert.Empty(t, nacked)
+
+		cancel()
+		<-done
+
+		committed, nacked = consumer.Settled()
+		assert.Empty(t, committed)
+		assert.Equal(t, []int64{0}, nacked)
+		assert.Empty(t, service.processOrder())
+	})
+}
+
+func TestProcessorShutdown(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// Test that events waiting for a retry are nacked instead of delaying shutdown
+	t.Run("NacksParkedEvents", func(t *testing.T) {
+		service := newMockMessageService(func(_ context.Context, id int64, _ int) error {
+			if id == 1 {
+				return errors.New("database unavailable")
+			}
+			return nil
+		})
+		consumer := kafkatest.NewConsumer(eventMessages(1, 2, 1)...)
+		p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Hour), time.Second, nil, testLogger)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.Run(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return len(service.processOrder()) == 2
+		}, time.Second, 5*time.Millisecond)
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("processor did not stop")
+		}
+
+		// Both events of message 1 are delivered again; the consumer holds back the
+		// commit of offset 1 because offset 0 was nacked first
+		committed, nacked := consumer.Settled()
+		assert.Equal(t, []int64{1}, committed)
+		assert.ElementsMatch(t, []int64{0, 2}, nacked)
+	})
+
+	// Test that an event stuck in processing is abandoned once the drain timeout expires
+	t.Run("BoundsDrain", func(t *testing.T) {
+		started := make(chan struct{})
+		service := newMockMessageService(func(ctx context.Context, _ int64, _ int) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		consumer := kafkatest.NewConsumer(eventMessages(1)...)
+		p := New(service, consumer, dlq.NewPublisher(&kafkatest.Producer{}, "messages.dlq"), "messages", 1, testPolicy(time.Millisecond), 50*time.Millisecond, nil, testLogger)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.Run(ctx)
+		}()
+
+		<-started
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("processor did not stop after the drain timeout")
+		}
+
+		committed, nacked := consumer.Settled()
+		assert.Empty(t, committed)
+		assert.Equal(t, []int64{0}, nacked)
+	})
+}
@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"httpchat/internal/model"
+)
+
+// workerQueueSize is how many events can wait in a worker's inbox before fetching blocks
+const workerQueueSize = 64
+
+// job is a fetched event on its way through a worker
+type job struct {
+	ack          *pendingAck
+	message      model.Message
+	attempts     int
+	firstAttempt time.Time
+
+	// deadLetter is the cause once the event is headed for the dead-letter topic
+	deadLetter         error
+	deadLetterAttempts int
+}
+
+// worker processes the events of the keys hashed to it, one event at a time.
+// An event waiting for a retry parks its key: later events with the same key queue
+// behind it, while events with other keys keep being processed.
+type worker struct {
+	processor *Processor
+	jobs      chan *job
+	retries   chan int64
+	stopped   chan struct{}
+
+	// parked maps a key to its event waiting for a retry followed by the events queued behind it
+	parked map[int64][]*job
+	timers map[int64]*time.Timer
+}
+
+// newWorker creates a new worker instance
+func newWorker(processor *Processor) *worker {
+	return &worker{
+		processor: processor,
+		jobs:      make(chan *job, workerQueueSize),
+		retries:   make(chan int64),
+		stopped:   make(chan struct{}),
+		parked:    make(map[int64][]*job),
+		timers:    make(map[int64]*time.Timer),
+	}
+}
+
+// run processes events until the inbox is closed and drained. Events that are still
+// parked at that point are nacked so that they are delivered again.
+func (w *worker) run(ctx context.Context, stopping <-chan struct{}) {
+	defer close(w.stopped)
+
+	for {
+		select {
+		case j, ok := <-w.jobs:
+			if !ok {
+				w.abandonParked(ctx)
+				return
+			}
+			if queue, ok := w.parked[j.message.ID]; ok {
+				w.parked[j.message.ID] = append(queue, j)
+				continue
+			}
+			w.process(ctx, []*job{j}, stopping)
+		case key := <-w.retries:
+			delete(w.timers, key)
+			queue := w.parked[key]
+			delete(w.parked, key)
+			w.process(ctx, queue, stopping)
+		case <-stopping:
+			// Parked events are not retried while shutting down
+			for key, timer := range w.timers {
+				timer.Stop()
+				delete(w.timers, key)
+			}
+			stopping = nil
+		}
+	}
+}
+
+// process attempts the queued events of a single key in order until one of them needs a retry,
+// which is then scheduled after the delay chosen by the retry policy
+func (w *worker) process(ctx context.Context, queue []*job, stopping <-chan struct{}) {
+	for i, j := range queue {
+		finished, retryAfter := w.processor.attempt(ctx, j)
+		if finished {
+			continue
+		}
+
+		key := j.message.ID
+		w.parked[key] = queue[i:]
+		if !isClosed(stopping) {
+			w.timers[key] = time.AfterFunc(retryAfter, func() {
+				select {
+				case w.retries <- key:
+				case <-w.stopped:
+				}
+			})
+		}
+		return
+	}
+}
+
+// abandonParked nacks every parked event
+func (w *worker) abandonParked(ctx context.Context) {
+	for key, queue := range w.parked {
+		for _, j := range queue {
+			w.processor.acks.settle(ctx, j.ack, false)
+		}
+		delete(w.parked, key)
+	}
+}
+
+// isClosed reports whether the stopping channel has been closed. A nil channel means
+// the worker has already seen it close.
+func isClosed(stopping <-chan struct{}) bool {
+	if stopping == nil {
+		return true
+	}
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,75 @@
+// Package redisbroker provides Redis Streams implementations of the Kafka interfaces.
+package redisbroker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Fields of a stream entry. Headers are stored next to the key and value with a prefix.
+const (
+	keyField     = "key"
+	valueField   = "value"
+	headerPrefix = "h:"
+)
+
+// pingTimeout bounds the connection check in Connect
+const pingTimeout = 5 * time.Second
+
+// Broker maps topics onto Redis streams. Every topic is a stream of the same name, and
+// every consumer group is a Redis consumer group of that stream. Redis has no partitions,
+// so all messages of a topic are delivered from partition 0.
+//
+// Entries that a consumer fetched but did not acknowledge stay pending. A consumer reads
+// its own pending entries again when it starts, and takes over the entries that other
+// members of its group left pending for longer than claimIdle, so claimIdle must cover
+// the processing of an entry including its retries.
+type Broker struct {
+	client       *redis.Client
+	consumerName string
+	claimIdle    time.Duration
+}
+
+// Connect connects to the Redis server at url. Consumers register in their groups as
+// consumerName, which must be stable across restarts and unique among the processes.
+func Connect(url, consumerName string, claimIdle time.Duration) (*Broker, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &Broker{
+		client:       client,
+		consumerName: consumerName,
+		claimIdle:    claimIdle,
+	}, nil
+}
+
+// entryOffset converts a stream entry ID of the form <milliseconds>-<sequence> into an
+// offset that orders like the ID
+func entryOffset(id string) int64 {
+	millis, sequence, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseInt(millis, 10, 64)
+	seq, _ := strconv.ParseInt(sequence, 10, 64)
+	return ms<<20 | seq
+}
+
+// entryTime returns the time a stream entry was added, which its ID records
+func entryTime(id string) time.Time {
+	millis, _, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseInt(millis, 10, 64)
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,166 @@
+package redisbroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBroker connects a broker to a fresh in-process Redis server
+func newTestBroker(t *testing.T, consumerName string, claimIdle time.Duration) (*Broker, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	return connect(t, server, consumerName, claimIdle), server
+}
+
+// connect connects another broker to the server, as a second process would
+func connect(t *testing.T, server *miniredis.Miniredis, consumerName string, claimIdle time.Duration) *Broker {
+	t.Helper()
+
+	broker, err := Connect("redis://"+server.Addr(), consumerName, claimIdle)
+	if err != nil {
+		t.Fatal("Failed to connect to Redis:", err)
+	}
+	t.Cleanup(func() {
+		_ = broker.NewProducer().Close()
+	})
+	return broker
+}
+
+// fetch reads the next message or fails the test if none arrives in time
+func fetch(t *testing.T, consumer *Consumer) interfaces.KafkaDelivery {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	delivery, err := consumer.FetchMessage(ctx, "")
+	if err != nil {
+		t.Fatal("Failed to fetch message:", err)
+	}
+	return delivery
+}
+
+// batch builds a batch of unkeyed messages with the given values
+func batch(values ...string) []*model.KafkaMessage {
+	messages := make([]*model.KafkaMessage, len(values))
+	for i, value := range values {
+		messages[i] = &model.KafkaMessage{Value: []byte(value)}
+	}
+	return messages
+}
+
+func TestBrokerSendAndFetch(t *testing.T) {
+	ctx := context.Background()
+	broker, _ := newTestBroker(t, "worker-1", time.Minute)
+	producer := broker.NewProducer()
+
+	// Entries added before the group exists are delivered to it
+	assert.NoError(t, producer.SendMessage(ctx, "messages", []byte("first")))
+	assert.NoError(t, producer.SendMessageWithHeaders(ctx, "messages", []byte("second"), map[string]string{"x-attempts": "3"}))
+	assert.NoError(t, producer.SendMessages(ctx, "messages", batch("third", "fourth")))
+	assert.NoError(t, producer.SendMessageWithKey(ctx, "messages", []byte("7"), []byte("fifth"), map[string]string{"x-correlation-id": "abc"}))
+
+	consumer := broker.NewConsumer("messages", "message-processor-group")
+	first := fetch(t, consumer).Message()
+	assert.Equal(t, "messages", first.Topic)
+	assert.Equal(t, 0, first.Partition)
+	assert.Equal(t, []byte("first"), first.Value)
+	assert.Nil(t, first.Headers)
+	assert.WithinDuration(t, time.Now(), first.Time, time.Minute)
+
+	second := fetch(t, consumer).Message()
+	assert.Equal(t, []byte("second"), second.Value)
+	assert.Equal(t, map[string]string{"x-attempts": "3"}, second.Headers)
+	assert.Greater(t, second.Offset, first.Offset)
+
+	assert.Equal(t, []byte("third"), fetch(t, consumer).Message().Value)
+	assert.Equal(t, []byte("fourth"), fetch(t, consumer).Message().Value)
+
+	fifth := fetch(t, consumer).Message()
+	assert.Equal(t, []byte("7"), fifth.Key)
+	assert.Equal(t, map[string]string{"x-correlation-id": "abc"}, fifth.Headers)
+
+	// Fetching stops at the deadline of the context
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err := consumer.FetchMessage(timeoutCtx, "messages")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBrokerConsumerGroups(t *testing.T) {
+	ctx := context.Background()
+	broker, server := newTestBroker(t, "worker-1", time.Minute)
+	assert.NoError(t, broker.NewProducer().SendMessages(ctx, "messages", batch("first", "second")))
+
+	// Every group receives every entry
+	processors := broker.NewConsumer("messages", "processors")
+	auditors := broker.NewConsumer("messages", "auditors")
+	for _, consumer := range []*Consumer{processors, auditors} {
+		assert.Equal(t, []byte("first"), fetch(t, consumer).Message().Value)
+	}
+
+	// Members of a group share its entries
+	sibling := connect(t, server, "worker-2", time.Minute).NewConsumer("messages", "processors")
+	assert.Equal(t, []byte("second"), fetch(t, sibling).Message().Value)
+}
+
+func TestBrokerCommitAndRedelivery(t *testing.T) {
+	ctx := context.Background()
+	broker, server := newTestBroker(t, "worker-1", time.Minute)
+	assert.NoError(t, broker.NewProducer().SendMessages(ctx, "messages", batch("first", "second", "third")))
+
+	consumer := broker.NewConsumer("messages", "group")
+	first := fetch(t, consumer)
+	second := fetch(t, consumer)
+	assert.NoError(t, consumer.Commit(ctx, first))
+	assert.NoError(t, second.Nack(ctx))
+	assert.NoError(t, consumer.Close())
+
+	// Deliveries from another consumer are rejected
+	assert.Error(t, broker.NewConsumer("messages", "group").Commit(ctx, second))
+
+	// After a restart the consumer first reads the entries it left pending
+	restarted := broker.NewConsumer("messages", "group")
+	redelivered := fetch(t, restarted)
+	assert.Equal(t, []byte("second"), redelivered.Message().Value)
+	assert.NoError(t, redelivered.Commit(ctx))
+	third := fetch(t, restarted)
+	assert.Equal(t, []byte("third"), third.Message().Value)
+
+	// Entries another consumer left pending are claimed once they were idle long enough
+	other := connect(t, server, "worker-2", 50*time.Millisecond).NewConsumer("messages", "group")
+	time.Sleep(100 * time.Millisecond)
+	claimed := fetch(t, other)
+	assert.Equal(t, []byte("third"), claimed.Message().Value)
+	assert.NoError(t, claimed.Commit(ctx))
+
+	pending, err := broker.client.XPending(ctx, "messages", "group").Result()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), pending.Count)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	_, err := Connect("not a url", "worker-1", time.Minute)
+	assert.Error(t, err)
+
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+	_, err = Connect("redis://"+addr, "worker-1", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestEntryOffset(t *testing.T) {
+	assert.Less(t, entryOffset("1700000000000-0"), entryOffset("1700000000000-1"))
+	assert.Less(t, entryOffset("1700000000000-5"), entryOffset("1700000000001-0"))
+	assert.Equal(t, time.UnixMilli(1700000000000), entryTime("1700000000000-5"))
+}
@@ -0,0 +1,245 @@
+package redisbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// maxFetchWait bounds a single blocking read, so that FetchMessage notices a cancelled context
+	maxFetchWait = time.Second
+
+	// setupRetryDelay is how long FetchMessage waits before reporting that the consumer
+	// group could not be created, so that callers retrying right away do not spin
+	setupRetryDelay = time.Second
+)
+
+// Consumer implements the interfaces.KafkaConsumer interface for Redis Streams.
+// A commit acknowledges the entry. Redis cannot hand an entry back, so a nacked entry
+// stays pending and is delivered again once it is claimed or the consumer restarts.
+type Consumer struct {
+	broker  *Broker
+	topic   string
+	groupID string
+
+	// ready is set once the consumer group exists
+	ready bool
+	// pendingCursor is the last entry read again from the pending entries of an earlier run
+	pendingCursor string
+	pendingDone   bool
+	// claimCursor is where the scan for entries left pending by other consumers resumes
+	claimCursor string
+	lastClaim   time.Time
+}
+
+// NewConsumer creates a consumer that reads the topic as a member of the consumer group
+func (b *Broker) NewConsumer(topic, groupID string) *Consumer {
+	return &Consumer{
+		broker:        b,
+		topic:         topic,
+		groupID:       groupID,
+		pendingCursor: "0",
+		claimCursor:   "0-0",
+	}
+}
+
+// Ensure Consumer implements interfaces.KafkaConsumer
+var _ interfaces.KafkaConsumer = (*Consumer)(nil)
+
+// FetchMessage waits for the next entry of the group without acknowledging it.
+// Pending entries of an earlier run come first, then entries claimed from other
+// consumers, then new entries.
+func (c *Consumer) FetchMessage(ctx context.Context, _ string) (interfaces.KafkaDelivery, error) {
+	if !c.ready {
+		if err := c.setup(ctx); err != nil {
+			select {
+			case <-time.After(setupRetryDelay):
+			case <-ctx.Done():
+			}
+			return nil, err
+		}
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to read message from Redis: %w", ctx.Err())
+		}
+
+		entry, err := c.next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to read message from Redis: %w", ctx.Err())
+			}
+			return nil, fmt.Errorf("failed to read message from Redis: %w", err)
+		}
+		if entry != nil {
+			return &delivery{consumer: c, id: entry.ID, message: c.toMessage(entry)}, nil
+		}
+	}
+}
+
+// next returns the next entry to deliver, or nil if none arrived within maxFetchWait
+func (c *Consumer) next(ctx context.Context) (*redis.XMessage, error) {
+	if !c.pendingDone {
+		entries, err := c.read(ctx, c.pendingCursor, -1)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			c.pendingDone = true
+			return nil, nil
+		}
+		c.pendingCursor = entries[0].ID
+		return &entries[0], nil
+	}
+
+	if time.Since(c.lastClaim) >= c.broker.claimIdle {
+		entries, cursor, err := c.broker.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.topic,
+			Group:    c.groupID,
+			Consumer: c.broker.consumerName,
+			MinIdle:  c.broker.claimIdle,
+			Start:    c.claimCursor,
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		c.claimCursor = cursor
+		if cursor == "0-0" {
+			// The scan is complete; the next one starts after another claimIdle
+			c.lastClaim = time.Now()
+		}
+		if len(entries) > 0 {
+			return &entries[0], nil
+		}
+	}
+
+	wait := maxFetchWait
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		wait = time.Until(deadline)
+	}
+	if wait < time.Millisecond {
+		// A block of zero would wait forever
+		wait = time.Millisecond
+	}
+	entries, err := c.read(ctx, ">", wait)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// read reads one entry of the group after id; block < 0 does not wait for new entries
+func (c *Consumer) read(ctx context.Context, id string, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := c.broker.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.groupID,
+		Consumer: c.broker.consumerName,
+		Streams:  []string{c.topic, id},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	return streams[0].Messages, nil
+}
+
+// setup creates the consumer group, which starts at the oldest entry of the stream
+func (c *Consumer) setup(ctx context.Context) error {
+	err := c.broker.client.XGroupCreateMkStream(ctx, c.topic, c.groupID, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create Redis consumer group %s: %w", c.groupID, err)
+	}
+	c.ready = true
+	return nil
+}
+
+// toMessage converts a stream entry into a model.KafkaMessage
+func (c *Consumer) toMessage(entry *redis.XMessage) *model.KafkaMessage {
+	message := &model.KafkaMessage{
+		Topic:  c.topic,
+		Offset: entryOffset(entry.ID),
+		Time:   entryTime(entry.ID),
+	}
+	for field, value := range entry.Values {
+		text, _ := value.(string)
+		switch {
+		case field == valueField:
+			message.Value = []byte(text)
+		case field == keyField:
+			message.Key = []byte(text)
+		case strings.HasPrefix(field, headerPrefix):
+			if message.Headers == nil {
+				message.Headers = make(map[string]string)
+			}
+			message.Headers[strings.TrimPrefix(field, headerPrefix)] = text
+		}
+	}
+	return message
+}
+
+// Commit acknowledges several deliveries in a single request
+func (c *Consumer) Commit(ctx context.Context, deliveries ...interfaces.KafkaDelivery) error {
+	ids := make([]string, 0, len(deliveries))
+	for _, d := range deliveries {
+		fetched, ok := d.(*delivery)
+		if !ok || fetched.consumer != c {
+			return fmt.Errorf("delivery was not fetched by this consumer")
+		}
+		ids = append(ids, fetched.id)
+	}
+	return c.ack(ctx, ids...)
+}
+
+// ack acknowledges entries so that they are no longer pending
+func (c *Consumer) ack(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := c.broker.client.XAck(ctx, c.topic, c.groupID, ids...).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge Redis stream entries: %w", err)
+	}
+	return nil
+}
+
+// Close leaves the consumer group; entries it did not acknowledge stay pending
+func (c *Consumer) Close() error {
+	return nil
+}
+
+// delivery implements interfaces.KafkaDelivery for an entry fetched by Consumer
+type delivery struct {
+	consumer *Consumer
+	id       string
+	message  *model.KafkaMessage
+}
+
+// Ensure delivery implements interfaces.KafkaDelivery
+var _ interfaces.KafkaDelivery = (*delivery)(nil)
+
+// Message returns the fetched message
+func (d *delivery) Message() *model.KafkaMessage {
+	return d.message
+}
+
+// Commit acknowledges the entry
+func (d *delivery) Commit(ctx context.Context) error {
+	return d.consumer.ack(ctx, d.id)
+}
+
+// Nack leaves the entry pending, so that it is delivered again once it is claimed
+func (d *delivery) Nack(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,96 @@
+package redisbroker
+
+import (
+	"context"
+	"fmt"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Producer implements the interfaces.KafkaProducer interface for Redis Streams
+type Producer struct {
+	broker *Broker
+}
+
+// NewProducer creates a producer that adds entries to the streams of the broker
+func (b *Broker) NewProducer() *Producer {
+	return &Producer{broker: b}
+}
+
+// Ensure Producer implements interfaces.KafkaProducer
+var _ interfaces.KafkaProducer = (*Producer)(nil)
+
+// SendMessage adds a message to the stream of the topic
+func (p *Producer) SendMessage(ctx context.Context, topic string, message []byte) error {
+	return p.SendMessageWithHeaders(ctx, topic, message, nil)
+}
+
+// SendMessages adds a batch of messages to the stream of the topic in a single round trip
+func (p *Producer) SendMessages(ctx context.Context, topic string, messages []*model.KafkaMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	pipe := p.broker.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(messages))
+	for i, message := range messages {
+		cmds[i] = pipe.XAdd(ctx, addArgs(topic, message.Key, message.Value, message.Headers))
+	}
+	if _, err := pipe.Exec(ctx); err == nil {
+		return nil
+	}
+
+	errs := make(model.BatchSendError, len(messages))
+	failed := 0
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			errs[i] = fmt.Errorf("failed to add message to Redis stream: %w", err)
+			failed++
+		}
+	}
+	if failed == len(messages) {
+		return fmt.Errorf("failed to add messages to Redis stream: %w", cmds[0].Err())
+	}
+	return errs
+}
+
+// SendMessageWithHeaders adds a message with the given headers to the stream of the topic
+func (p *Producer) SendMessageWithHeaders(ctx context.Context, topic string, message []byte, headers map[string]string) error {
+	return p.SendMessageWithKey(ctx, topic, nil, message, headers)
+}
+
+// SendMessageWithKey adds a message with the given key and headers to the stream of the topic.
+// A stream keeps all its entries in order, so the key is only carried along.
+func (p *Producer) SendMessageWithKey(ctx context.Context, topic string, key, message []byte, headers map[string]string) error {
+	if err := p.broker.client.XAdd(ctx, addArgs(topic, key, message, headers)).Err(); err != nil {
+		return fmt.Errorf("failed to add message to Redis stream: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis client, which the consumers share, so they must be closed first
+func (p *Producer) Close() error {
+	if err := p.broker.client.Close(); err != nil {
+		return fmt.Errorf("failed to close Redis client: %w", err)
+	}
+	return nil
+}
+
+// addArgs builds the XADD arguments that store a message, its key and its headers in one entry
+func addArgs(topic string, key, message []byte, headers map[string]string) *redis.XAddArgs {
+	values := make([]any, 0, 4+2*len(headers))
+	values = append(values, valueField, message)
+	if len(key) > 0 {
+		values = append(values, keyField, key)
+	}
+	for name, value := range headers {
+		values = append(values, headerPrefix+name, value)
+	}
+	return &redis.XAddArgs{
+		Stream: topic,
+		Values: values,
+	}
+}
@@ -0,0 +1,404 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+)
+
+// MemoryMessageRepository keeps messages, outbox events and idempotency keys in memory.
+// It reports the same errors as PostgreSQLMessageRepository, which makes it suitable for
+// tests and for running the service locally without a database. Data is lost on restart.
+type MemoryMessageRepository struct {
+	mu              sync.Mutex
+	messages        map[int64]*model.Message
+	lastMessageID   int64
+	outbox          map[int64]*memoryOutboxEvent
+	lastOutboxID    int64
+	idempotencyKeys map[string]memoryIdempotencyKey
+}
+
+// memoryOutboxEvent is an outbox event with the lease that hides it from other relays
+type memoryOutboxEvent struct {
+	event       model.OutboxEvent
+	lockedUntil time.Time
+	lastError   string
+}
+
+// memoryIdempotencyKey is a claimed idempotency key with the message it created
+type memoryIdempotencyKey struct {
+	fingerprint string
+	messageID   int64
+	createdAt   time.Time
+}
+
+// Ensure MemoryMessageRepository implements the repository interfaces
+var (
+	_ interfaces.MessageRepository        = (*MemoryMessageRepository)(nil)
+	_ interfaces.OutboxRepository         = (*MemoryMessageRepository)(nil)
+	_ interfaces.IdempotencyKeyRepository = (*MemoryMessageRepository)(nil)
+)
+
+// NewMemoryMessageRepository creates an empty MemoryMessageRepository
+func NewMemoryMessageRepository() *MemoryMessageRepository {
+	return &MemoryMessageRepository{
+		messages:        make(map[int64]*model.Message),
+		outbox:          make(map[int64]*memoryOutboxEvent),
+		idempotencyKeys: make(map[string]memoryIdempotencyKey),
+	}
+}
+
+// memoryNow returns the current time without the monotonic reading, so that stored
+// timestamps compare the same way as timestamps decoded from a cursor
+func memoryNow() time.Time {
+	return time.Now().Round(0)
+}
+
+// contextError reports a cancelled context the way a database driver would
+func contextError(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return repositoryerr.New("", op, err)
+	}
+	return nil
+}
+
+// CreateMessage stores a new message together with its outbox event
+func (r *MemoryMessageRepository) CreateMessage(ctx context.Context, content string) (*model.Message, error) {
+	if err := contextError(ctx, "CreateMessage"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, err := r.insertMessage(ctx, "CreateMessage", content)
+	if err != nil {
+		return nil, err
+	}
+	return copyMessage(message), nil
+}
+
+// CreateMessageIdempotent creates a message unless the idempotency key was already used.
+// It follows the semantics of PostgreSQLMessageRepository.CreateMessageIdempotent.
+func (r *MemoryMessageRepository) CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (*model.Message, bool, error) {
+	if err := contextError(ctx, "CreateMessageIdempotent"); err != nil {
+		return nil, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The key was used before and has not expired: replay the original message if the request matches
+	now := memoryNow()
+	if stored, ok := r.idempotencyKeys[key]; ok && !stored.createdAt.Before(now.Add(-keyTTL)) {
+		message, ok := r.messages[stored.messageID]
+		if !ok {
+			// The key exists but its message was deleted
+			return nil, false, repositoryerr.New(
+				repositoryerr.ErrorCodeMessageNotFound,
+				"CreateMessageIdempotent",
+				repositoryerr.ErrMessageNotFound,
+			)
+		}
+		if stored.fingerprint != fingerprint {
+			return nil, false, repositoryerr.New(
+				repositoryerr.ErrorCodeIdempotencyKeyMismatch,
+				"CreateMessageIdempotent",
+				fmt.Errorf("idempotency key %q: %w", key, repositoryerr.ErrIdempotencyKeyMismatch),
+			)
+		}
+		return copyMessage(message), true, nil
+	}
+
+	message, err := r.insertMessage(ctx, "CreateMessageIdempotent", content)
+	if err != nil {
+		return nil, false, err
+	}
+	r.idempotencyKeys[key] = memoryIdempotencyKey{fingerprint: fingerprint, messageID: message.ID, createdAt: now}
+
+	return copyMessage(message), false, nil
+}
+
+// insertMessage stores a message and its outbox event; the caller must hold r.mu
+func (r *MemoryMessageRepository) insertMessage(ctx context.Context, op string, content string) (*model.Message, error) {
+	now := memoryNow()
+	message := &model.Message{
+		ID:        r.lastMessageID + 1,
+		Content:   content,
+		Status:    model.StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Nothing is stored when the event cannot be recorded, as with a rolled back transaction
+	payload, err := outboxPayload(ctx, op, message, now)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lastMessageID = message.ID
+	r.messages[message.ID] = message
+
+	r.lastOutboxID++
+	r.outbox[r.lastOutboxID] = &memoryOutboxEvent{
+		event: model.OutboxEvent{
+			ID:        r.lastOutboxID,
+			MessageID: message.ID,
+			Payload:   payload,
+			CreatedAt: now,
+		},
+	}
+
+	return message, nil
+}
+
+// GetMessageByID returns a copy of the message with the given ID
+func (r *MemoryMessageRepository) GetMessageByID(ctx context.Context, id int64) (*model.Message, error) {
+	if err := contextError(ctx, "GetMessageByID"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeMessageNotFound,
+			"GetMessageByID",
+			repositoryerr.ErrMessageNotFound,
+		)
+	}
+	return copyMessage(message), nil
+}
+
+// UpdateMessageStatus moves a message to a new lifecycle state.
+// It follows the semantics of PostgreSQLMessageRepository.UpdateMessageStatus.
+func (r *MemoryMessageRepository) UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) error {
+	if !status.Valid() {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeInvalidInput,
+			"UpdateMessageStatus",
+			fmt.Errorf("%w: %q", model.ErrInvalidStatus, status),
+		)
+	}
+	if err := contextError(ctx, "UpdateMessageStatus"); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[id]
+	if !ok {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeMessageNotFound,
+			"UpdateMessageStatus",
+			repositoryerr.ErrMessageNotFound,
+		)
+	}
+
+	if !message.Status.CanTransitionTo(status) {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeInvalidStatusTransition,
+			"UpdateMessageStatus",
+			fmt.Errorf("cannot move message %d from %s to %s: %w", id, message.Status, status, repositoryerr.ErrInvalidStatusTransition),
+		)
+	}
+
+	now := memoryNow()
+	message.Status = status
+	if status == model.StatusProcessing {
+		message.Attempts++
+	}
+	if lastError != "" {
+		message.LastError = lastError
+	}
+	if status == model.StatusProcessed {
+		message.ProcessedAt = &now
+	}
+	message.UpdatedAt = now
+
+	return nil
+}
+
+// ListMessages returns a single keyset page of messages ordered by (created_at, id)
+func (r *MemoryMessageRepository) ListMessages(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error) {
+	if err := contextError(ctx, "ListMessages"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ascending := filter.Order == model.SortOrderAsc
+
+	// after reports whether message comes after the cursor in the listing order
+	after := func(message *model.Message, cursor *model.MessageCursor) bool {
+		if !message.CreatedAt.Equal(cursor.CreatedAt) {
+			return message.CreatedAt.After(cursor.CreatedAt) == ascending
+		}
+		if message.ID == cursor.ID {
+			return false
+		}
+		return (message.ID > cursor.ID) == ascending
+	}
+
+	var matched []*model.Message
+	for _, message := range r.messages {
+		if filter.Status != nil && message.Status != *filter.Status {
+			continue
+		}
+		if filter.CreatedFrom != nil && message.CreatedAt.Before(*filter.CreatedFrom) {
+			continue
+		}
+		if filter.CreatedTo != nil && !message.CreatedAt.Before(*filter.CreatedTo) {
+			continue
+		}
+		if filter.After != nil && !after(message, filter.After) {
+			continue
+		}
+		matched = append(matched, message)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return after(matched[j], &model.MessageCursor{CreatedAt: matched[i].CreatedAt, ID: matched[i].ID})
+	})
+
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+
+	messages := make([]*model.Message, 0, len(matched))
+	for _, message := range matched {
+		messages = append(messages, copyMessage(message))
+	}
+	return messages, nil
+}
+
+// GetStatistics counts the stored messages per lifecycle state
+func (r *MemoryMessageRepository) GetStatistics(ctx context.Context) (*model.Statistics, error) {
+	if err := contextError(ctx, "GetStatistics"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stats model.Statistics
+	for _, message := range r.messages {
+		stats.TotalMessages++
+		switch message.Status {
+		case model.StatusPending:
+			stats.PendingMessages++
+		case model.StatusProcessing:
+			stats.ProcessingMessages++
+		case model.StatusProcessed:
+			stats.ProcessedMessages++
+		case model.StatusFailed:
+			stats.FailedMessages++
+		case model.StatusDeadLettered:
+			stats.DeadLetteredMessages++
+		}
+	}
+	return &stats, nil
+}
+
+// ClaimOutboxEvents leases up to limit unsent events in creation order
+func (r *MemoryMessageRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxEvent, error) {
+	if err := contextError(ctx, "ClaimOutboxEvents"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := memoryNow()
+	var claimable []*memoryOutboxEvent
+	for _, stored := range r.outbox {
+		if stored.lockedUntil.Before(now) {
+			claimable = append(claimable, stored)
+		}
+	}
+	sort.Slice(claimable, func(i, j int) bool {
+		return claimable[i].event.ID < claimable[j].event.ID
+	})
+	if len(claimable) > limit {
+		claimable = claimable[:limit]
+	}
+
+	events := make([]*model.OutboxEvent, 0, len(claimable))
+	for _, stored := range claimable {
+		stored.lockedUntil = now.Add(lease)
+		event := stored.event
+		event.Payload = append([]byte(nil), stored.event.Payload...)
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// MarkOutboxEventSent removes a published event from the outbox
+func (r *MemoryMessageRepository) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	if err := contextError(ctx, "MarkOutboxEventSent"); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.outbox, id)
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed publish attempt and hides the event until retryAfter elapses
+func (r *MemoryMessageRepository) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	if err := contextError(ctx, "MarkOutboxEventFailed"); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.outbox[id]; ok {
+		stored.event.Attempts++
+		stored.lastError = reason
+		stored.lockedUntil = memoryNow().Add(retryAfter)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes idempotency keys older than keyTTL
+func (r *MemoryMessageRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, keyTTL time.Duration) (int64, error) {
+	if err := contextError(ctx, "DeleteExpiredIdempotencyKeys"); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := memoryNow().Add(-keyTTL)
+	var deleted int64
+	for key, stored := range r.idempotencyKeys {
+		if stored.createdAt.Before(cutoff) {
+			delete(r.idempotencyKeys, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// copyMessage returns a copy that callers may modify without affecting the stored message
+func copyMessage(message *model.Message) *model.Message {
+	copied := *message
+	if message.ProcessedAt != nil {
+		processedAt := *message.ProcessedAt
+		copied.ProcessedAt = &processedAt
+	}
+	return &copied
+}
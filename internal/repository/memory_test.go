@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"httpchat/internal/model"
+	"httpchat/internal/repository/repositorytest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMessageRepository_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repository {
+		return NewMemoryMessageRepository()
+	})
+}
+
+func TestMemoryMessageRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReturnsCopies", func(t *testing.T) {
+		repo := NewMemoryMessageRepository()
+
+		message, err := repo.CreateMessage(ctx, "Test message")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), message.ID)
+		assert.Equal(t, model.StatusPending, message.Status)
+
+		retrieved, err := repo.GetMessageByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, message, retrieved)
+
+		// Returned messages are copies that do not change the stored one
+		retrieved.Status = model.StatusProcessed
+		stored, err := repo.GetMessageByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StatusPending, stored.Status)
+	})
+
+	t.Run("CancelledContext", func(t *testing.T) {
+		repo := NewMemoryMessageRepository()
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := repo.CreateMessage(cancelled, "Test message")
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
@@ -4,14 +4,21 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"httpchat/internal/interfaces"
+	"httpchat/internal/migration"
 	"httpchat/internal/model"
 	"httpchat/internal/repositoryerr"
+	"httpchat/internal/retry"
+	"httpchat/internal/tracing"
 
 	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PostgreSQLMessageRepository implements interfaces.MessageRepository for PostgreSQL
@@ -19,8 +26,19 @@ type PostgreSQLMessageRepository struct {
 	db *sql.DB
 }
 
-// NewPostgreSQLMessageRepository creates a new PostgreSQLMessageRepository
-func NewPostgreSQLMessageRepository(databaseURL string) (interfaces.MessageRepository, error) {
+// startupRetryPolicy bounds how long the repository waits for the database to accept connections
+var startupRetryPolicy = retry.Policy{
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     5 * time.Second,
+	Multiplier:      2,
+	MaxElapsedTime:  30 * time.Second,
+}
+
+// NewPostgreSQLMessageRepository creates a new PostgreSQLMessageRepository.
+// With autoMigrate the pending schema migrations are applied first; without it the
+// schema must already be at the latest version. A schema migrated by a newer release
+// is refused either way.
+func NewPostgreSQLMessageRepository(databaseURL string, autoMigrate bool) (*PostgreSQLMessageRepository, error) {
 	// Open database connection
 	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
@@ -35,23 +53,25 @@ func NewPostgreSQLMessageRepository(databaseURL string) (interfaces.MessageRepos
 	db.SetMaxIdleConns(25)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
-		return nil, &repositoryerr.RepositoryError{
-			Op:  "NewPostgreSQLMessageRepository",
-			Err: fmt.Errorf("failed to ping database: %w", err),
-		}
+	// Test connection; the database may still be starting, so the ping is retried for a while
+	err = startupRetryPolicy.Do(context.Background(), func(ctx context.Context) error {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		return db.PingContext(pingCtx)
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeDatabaseConnection,
+			"NewPostgreSQLMessageRepository",
+			fmt.Errorf("failed to ping database: %w", err),
+		)
 	}
 
-	// Create messages table if it doesn't exist
-	if err := createMessagesTable(db); err != nil {
-		return nil, &repositoryerr.RepositoryError{
-			Op:  "NewPostgreSQLMessageRepository",
-			Err: fmt.Errorf("failed to create messages table: %w", err),
-		}
+	// Bring the schema up to date, or make sure someone else did
+	if err := prepareSchema(db, autoMigrate); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
 
 	// Return repository implementation
@@ -63,68 +83,156 @@ func NewPostgreSQLMessageRepository(databaseURL string) (interfaces.MessageRepos
 // Ensure PostgreSQLMessageRepository implements interfaces.MessageRepository
 var _ interfaces.MessageRepository = (*PostgreSQLMessageRepository)(nil)
 
-// createMessagesTable creates the messages table if it doesn't exist
-func createMessagesTable(db *sql.DB) error {
-	// Create the messages table with all required fields
-	query := `
-	CREATE TABLE IF NOT EXISTS messages (
-		id SERIAL PRIMARY KEY,
-		content TEXT NOT NULL,
-		processed BOOLEAN NOT NULL DEFAULT FALSE,
-		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
-	)`
-
-	_, err := db.Exec(query)
-	if err != nil {
-		return repositoryerr.New(
-			"", // No specific code
-			"createMessagesTable",
-			fmt.Errorf("failed to create messages table: %w", err),
-		)
+// messageColumns is the column list scanned by messageScanTargets
+const messageColumns = `id, content, status, attempts, COALESCE(last_error, ''), processed_at, created_at, updated_at`
+
+// messageScanTargets returns the scan destinations for messageColumns
+func messageScanTargets(message *model.Message) []any {
+	return []any{
+		&message.ID,
+		&message.Content,
+		&message.Status,
+		&message.Attempts,
+		&message.LastError,
+		&message.ProcessedAt,
+		&message.CreatedAt,
+		&message.UpdatedAt,
 	}
+}
+
+// statisticsQuery counts messages per lifecycle state; it is shared by the SQL backends
+const statisticsQuery = `
+	SELECT
+		COUNT(*) as total_messages,
+		COUNT(CASE WHEN status = 'pending' THEN 1 END) as pending_messages,
+		COUNT(CASE WHEN status = 'processing' THEN 1 END) as processing_messages,
+		COUNT(CASE WHEN status = 'processed' THEN 1 END) as processed_messages,
+		COUNT(CASE WHEN status = 'failed' THEN 1 END) as failed_messages,
+		COUNT(CASE WHEN status = 'dead_lettered' THEN 1 END) as dead_lettered_messages
+	FROM messages`
 
-	// Create indexes for better query performance
-	indexes := []string{
-		`CREATE INDEX IF NOT EXISTS idx_messages_processed ON messages(processed)`,
-		`CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at)`,
+// statisticsScanTargets returns the scan destinations for statisticsQuery
+func statisticsScanTargets(stats *model.Statistics) []any {
+	return []any{
+		&stats.TotalMessages,
+		&stats.PendingMessages,
+		&stats.ProcessingMessages,
+		&stats.ProcessedMessages,
+		&stats.FailedMessages,
+		&stats.DeadLetteredMessages,
 	}
+}
 
-	// Create each index
-	for _, idxQuery := range indexes {
-		_, err = db.Exec(idxQuery)
-		if err != nil {
-			return repositoryerr.New(
-				"", // No specific code
-				"createMessagesTable",
-				fmt.Errorf("failed to create index: %w", err),
-			)
+// prepareSchema migrates the schema if allowed and checks that it is at the latest version
+func prepareSchema(db *sql.DB, autoMigrate bool) error {
+	migrator, err := migration.New(db)
+	if err != nil {
+		return repositoryerr.New("", "NewPostgreSQLMessageRepository", err)
+	}
+
+	ctx := context.Background()
+	if autoMigrate {
+		if _, err := migrator.Up(ctx); err != nil {
+			return schemaError(err)
 		}
 	}
+	if err := migrator.Check(ctx); err != nil {
+		return schemaError(err)
+	}
+	return nil
+}
+
+// schemaError wraps a migration error, giving version mismatches their own code
+func schemaError(err error) error {
+	if errors.Is(err, migration.ErrUnknownVersion) || errors.Is(err, migration.ErrPendingMigrations) {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeSchemaVersion,
+			"NewPostgreSQLMessageRepository",
+			fmt.Errorf("%w: %w", repositoryerr.ErrSchemaVersion, err),
+		)
+	}
+	return repositoryerr.New(
+		"", // No specific code
+		"NewPostgreSQLMessageRepository",
+		fmt.Errorf("failed to migrate database schema: %w", err),
+	)
+}
+
+// Close closes the connections to the database
+func (r *PostgreSQLMessageRepository) Close() error {
+	return r.db.Close()
+}
 
+// Ping checks that the database accepts connections
+func (r *PostgreSQLMessageRepository) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeDatabaseConnection,
+			"Ping",
+			fmt.Errorf("failed to ping database: %w", err),
+		)
+	}
 	return nil
 }
 
+// startSpan starts the span of a repository operation, which covers all of its queries
+func startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "postgresql."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(op)),
+	)
+}
+
 // CreateMessage creates a new message in the database
-func (r *PostgreSQLMessageRepository) CreateMessage(ctx context.Context, content string) (*model.Message, error) {
+func (r *PostgreSQLMessageRepository) CreateMessage(ctx context.Context, content string) (_ *model.Message, err error) {
+	ctx, span := startSpan(ctx, "CreateMessage")
+	defer func() { tracing.End(span, err) }()
+
+	// The message and its outbox event are written atomically, so an event is
+	// published if and only if the message was stored
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessage",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	message, err := insertMessage(ctx, tx, "CreateMessage", content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessage",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+
+	return message, nil
+}
+
+// insertMessage inserts a message and its outbox event inside tx
+func insertMessage(ctx context.Context, tx *sql.Tx, op string, content string) (*model.Message, error) {
 	// SQL query to insert a new message and return the created record
 	query := `
 	INSERT INTO messages (content, created_at, updated_at)
 	VALUES ($1, $2, $3)
-	RETURNING id, content, processed, created_at, updated_at`
+	RETURNING ` + messageColumns
 
 	var message model.Message
 	now := time.Now()
-	
+
 	// Execute the query and scan the result into our message struct
-	err := r.db.QueryRowContext(ctx, query, content, now, now).Scan(
-		&message.ID,
-		&message.Content,
-		&message.Processed,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-	)
-	
+	err := tx.QueryRowContext(ctx, query, content, now, now).Scan(messageScanTargets(&message)...)
+
 	if err != nil {
 		// Handle specific PostgreSQL error codes for better error reporting
 		if pqErr, ok := err.(*pq.Error); ok {
@@ -132,57 +240,59 @@ func (r *PostgreSQLMessageRepository) CreateMessage(ctx context.Context, content
 			case "23505": // unique_violation
 				return nil, repositoryerr.New(
 					repositoryerr.ErrorCodeDuplicateEntry,
-					"CreateMessage",
+					op,
 					fmt.Errorf("duplicate message entry: %w", err),
 				)
 			case "23502": // not_null_violation
 				return nil, repositoryerr.New(
 					repositoryerr.ErrorCodeInvalidInput,
-					"CreateMessage",
+					op,
 					fmt.Errorf("missing required field: %w", err),
 				)
 			case "23503": // foreign_key_violation
 				return nil, repositoryerr.New(
 					repositoryerr.ErrorCodeInvalidInput,
-					"CreateMessage",
+					op,
 					fmt.Errorf("foreign key violation: %w", err),
 				)
 			case "25P02": // in_failed_sql_transaction
 				return nil, repositoryerr.New(
 					repositoryerr.ErrorCodeTransactionFailed,
-					"CreateMessage",
+					op,
 					fmt.Errorf("transaction failed: %w", err),
 				)
 			}
 		}
 		return nil, repositoryerr.New(
 			"", // No specific code
-			"CreateMessage",
+			op,
 			fmt.Errorf("failed to insert message: %w", err),
 		)
 	}
 
+	// Record the event for the outbox relay in the same transaction
+	if err := insertOutboxEvent(ctx, tx, op, &message, now); err != nil {
+		return nil, err
+	}
+
 	return &message, nil
 }
 
 // GetMessageByID retrieves a message by ID from the database
-func (r *PostgreSQLMessageRepository) GetMessageByID(ctx context.Context, id int64) (*model.Message, error) {
+func (r *PostgreSQLMessageRepository) GetMessageByID(ctx context.Context, id int64) (_ *model.Message, err error) {
+	ctx, span := startSpan(ctx, "GetMessageByID")
+	defer func() { tracing.End(span, err) }()
+
 	// SQL query to get a message by its ID
 	query := `
-	SELECT id, content, processed, created_at, updated_at
+	SELECT ` + messageColumns + `
 	FROM messages
 	WHERE id = $1`
 
 	var message model.Message
 	
 	// Execute the query and scan the result into our message struct
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&message.ID,
-		&message.Content,
-		&message.Processed,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-	)
+	err = r.db.QueryRowContext(ctx, query, id).Scan(messageScanTargets(&message)...)
 	
 	if err != nil {
 		// Handle case when no message is found
@@ -222,19 +332,48 @@ func (r *PostgreSQLMessageRepository) GetMessageByID(ctx context.Context, id int
 	return &message, nil
 }
 
-// UpdateMessageStatus updates a message's status in the database
-func (r *PostgreSQLMessageRepository) UpdateMessageStatus(ctx context.Context, id int64, processed bool) error {
-	// SQL query to update the processed status of a message
-	query := `
-	UPDATE messages
-	SET processed = $1, updated_at = $2
-	WHERE id = $3`
+// UpdateMessageStatus moves a message to a new lifecycle state.
+// The transition is checked against the current state under a row lock, so concurrent
+// updates cannot skip a state. Entering StatusProcessing counts an attempt, and
+// lastError is recorded when it is not empty.
+func (r *PostgreSQLMessageRepository) UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) (err error) {
+	ctx, span := startSpan(ctx, "UpdateMessageStatus")
+	defer func() { tracing.End(span, err) }()
 
-	now := time.Now()
-	
-	// Execute the update query
-	result, err := r.db.ExecContext(ctx, query, processed, now, id)
+	if !status.Valid() {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeInvalidInput,
+			"UpdateMessageStatus",
+			fmt.Errorf("%w: %q", model.ErrInvalidStatus, status),
+		)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"UpdateMessageStatus",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	// Lock the row so the transition check and the update see the same state
+	var current model.MessageStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM messages WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if err != nil {
+		// If no row was found, the message doesn't exist
+		if err == sql.ErrNoRows {
+			return repositoryerr.New(
+				repositoryerr.ErrorCodeMessageNotFound,
+				"UpdateMessageStatus",
+				repositoryerr.ErrMessageNotFound,
+			)
+		}
+
 		// Handle specific PostgreSQL error codes
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code {
@@ -256,42 +395,102 @@ func (r *PostgreSQLMessageRepository) UpdateMessageStatus(ctx context.Context, i
 		return repositoryerr.New(
 			"", // No specific code
 			"UpdateMessageStatus",
-			fmt.Errorf("failed to update message: %w", err),
+			fmt.Errorf("failed to load message status: %w", err),
 		)
 	}
 
-	// Check how many rows were affected to ensure the message existed
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if !current.CanTransitionTo(status) {
 		return repositoryerr.New(
-			repositoryerr.ErrorCodeSerializationFailed,
+			repositoryerr.ErrorCodeInvalidStatusTransition,
 			"UpdateMessageStatus",
-			fmt.Errorf("failed to get rows affected: %w", err),
+			fmt.Errorf("cannot move message %d from %s to %s: %w", id, current, status, repositoryerr.ErrInvalidStatusTransition),
 		)
 	}
 
-	// If no rows were affected, the message didn't exist
-	if rowsAffected == 0 {
+	// SQL query to apply the transition and its bookkeeping
+	query := `
+	UPDATE messages
+	SET status = $1,
+		attempts = attempts + CASE WHEN $1 = 'processing' THEN 1 ELSE 0 END,
+		last_error = COALESCE(NULLIF($2, ''), last_error),
+		processed_at = CASE WHEN $1 = 'processed' THEN $3 ELSE processed_at END,
+		updated_at = $3
+	WHERE id = $4`
+
+	now := time.Now()
+
+	// Execute the update query
+	if _, err := tx.ExecContext(ctx, query, string(status), lastError, now, id); err != nil {
 		return repositoryerr.New(
-			repositoryerr.ErrorCodeMessageNotFound,
+			"", // No specific code
 			"UpdateMessageStatus",
-			repositoryerr.ErrMessageNotFound,
+			fmt.Errorf("failed to update message: %w", err),
+		)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"UpdateMessageStatus",
+			fmt.Errorf("failed to commit transaction: %w", err),
 		)
 	}
 
 	return nil
 }
 
-// GetAllMessages retrieves all messages from the database
-func (r *PostgreSQLMessageRepository) GetAllMessages(ctx context.Context) ([]*model.Message, error) {
-	// SQL query to get all messages ordered by creation time
+// ListMessages retrieves a single keyset page of messages from the database
+func (r *PostgreSQLMessageRepository) ListMessages(ctx context.Context, filter model.MessageFilter) (_ []*model.Message, err error) {
+	ctx, span := startSpan(ctx, "ListMessages")
+	defer func() { tracing.End(span, err) }()
+
+	// Build the WHERE clause from the filter, numbering placeholders as we go
+	var conditions []string
+	var args []any
+	addCondition := func(format string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	if filter.Status != nil {
+		addCondition("status = $%d", string(*filter.Status))
+	}
+	if filter.CreatedFrom != nil {
+		addCondition("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		addCondition("created_at < $%d", *filter.CreatedTo)
+	}
+
+	// Keyset pagination: continue strictly after the (created_at, id) of the cursor
+	direction := "DESC"
+	comparison := "<"
+	if filter.Order == model.SortOrderAsc {
+		direction = "ASC"
+		comparison = ">"
+	}
+	if filter.After != nil {
+		addCondition("(created_at, id) "+comparison+" ($%d, $%d)", filter.After.CreatedAt, filter.After.ID)
+	}
+
 	query := `
-	SELECT id, content, processed, created_at, updated_at
-	FROM messages
-	ORDER BY created_at DESC`
+	SELECT ` + messageColumns + `
+	FROM messages`
+	if len(conditions) > 0 {
+		query += `
+	WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(`
+	ORDER BY created_at %s, id %s
+	LIMIT $%d`, direction, direction, len(args))
 
 	// Execute the query
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		// Handle specific PostgreSQL error codes
 		if pqErr, ok := err.(*pq.Error); ok {
@@ -299,7 +498,7 @@ func (r *PostgreSQLMessageRepository) GetAllMessages(ctx context.Context) ([]*mo
 			case "25P02": // in_failed_sql_transaction
 				return nil, repositoryerr.New(
 					repositoryerr.ErrorCodeTransactionFailed,
-					"GetAllMessages",
+					"ListMessages",
 					fmt.Errorf("transaction failed: %w", err),
 				)
 			}
@@ -307,31 +506,25 @@ func (r *PostgreSQLMessageRepository) GetAllMessages(ctx context.Context) ([]*mo
 
 		return nil, repositoryerr.New(
 			"", // No specific code
-			"GetAllMessages",
+			"ListMessages",
 			fmt.Errorf("failed to query messages: %w", err),
 		)
 	}
-	
+
 	// Ensure rows are closed when function returns
 	defer func() {
 		_ = rows.Close()
 	}()
 
 	// Process each row and build our messages slice
-	var messages []*model.Message
+	messages := make([]*model.Message, 0, filter.Limit)
 	for rows.Next() {
 		var message model.Message
-		err := rows.Scan(
-			&message.ID,
-			&message.Content,
-			&message.Processed,
-			&message.CreatedAt,
-			&message.UpdatedAt,
-		)
+		err := rows.Scan(messageScanTargets(&message)...)
 		if err != nil {
 			return nil, repositoryerr.New(
 				repositoryerr.ErrorCodeSerializationFailed,
-				"GetAllMessages",
+				"ListMessages",
 				fmt.Errorf("failed to scan message: %w", err),
 			)
 		}
@@ -342,7 +535,7 @@ func (r *PostgreSQLMessageRepository) GetAllMessages(ctx context.Context) ([]*mo
 	if err := rows.Err(); err != nil {
 		return nil, repositoryerr.New(
 			repositoryerr.ErrorCodeSerializationFailed,
-			"GetAllMessages",
+			"ListMessages",
 			fmt.Errorf("error iterating rows: %w", err),
 		)
 	}
@@ -351,23 +544,14 @@ func (r *PostgreSQLMessageRepository) GetAllMessages(ctx context.Context) ([]*mo
 }
 
 // GetStatistics retrieves message statistics from the database
-func (r *PostgreSQLMessageRepository) GetStatistics(ctx context.Context) (*model.Statistics, error) {
-	// SQL query to get message statistics using COUNT with CASE conditions
-	query := `
-	SELECT 
-		COUNT(*) as total_messages,
-		COUNT(CASE WHEN processed = TRUE THEN 1 END) as processed_messages,
-		COUNT(CASE WHEN processed = FALSE THEN 1 END) as unprocessed_messages
-	FROM messages`
+func (r *PostgreSQLMessageRepository) GetStatistics(ctx context.Context) (_ *model.Statistics, err error) {
+	ctx, span := startSpan(ctx, "GetStatistics")
+	defer func() { tracing.End(span, err) }()
 
 	var stats model.Statistics
 	
 	// Execute the query and scan results into our statistics struct
-	err := r.db.QueryRowContext(ctx, query).Scan(
-		&stats.TotalMessages,
-		&stats.ProcessedMessages,
-		&stats.UnprocessedMessages,
-	)
+	err = r.db.QueryRowContext(ctx, statisticsQuery).Scan(statisticsScanTargets(&stats)...)
 	
 	if err != nil {
 		// Handle specific PostgreSQL error codes
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+	"httpchat/internal/tracing"
+)
+
+// Ensure PostgreSQLMessageRepository implements interfaces.IdempotencyKeyRepository
+var _ interfaces.IdempotencyKeyRepository = (*PostgreSQLMessageRepository)(nil)
+
+// CreateMessageIdempotent creates a message unless the idempotency key was already used.
+// On a retry with the same fingerprint the originally created message is returned with
+// replayed set to true. A retry with a different fingerprint fails with ErrorCodeIdempotencyKeyMismatch.
+// A key older than keyTTL has expired and is claimed again as if it had never been used.
+func (r *PostgreSQLMessageRepository) CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (_ *model.Message, _ bool, err error) {
+	ctx, span := startSpan(ctx, "CreateMessageIdempotent")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	// Claim the key, taking over an expired one. A concurrent request holding the same
+	// key blocks here until it commits (we then see its row) or rolls back (we then own the key).
+	claimQuery := `
+	INSERT INTO idempotency_keys (key, fingerprint, created_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (key) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint, message_id = NULL, created_at = EXCLUDED.created_at
+	WHERE idempotency_keys.created_at < $4`
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, claimQuery, key, fingerprint, now, now.Add(-keyTTL))
+	if err != nil {
+		return nil, false, repositoryerr.New(
+			"", // No specific code
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to claim idempotency key: %w", err),
+		)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to get rows affected: %w", err),
+		)
+	}
+
+	// The key was used before: replay the original message if the request matches
+	if claimed == 0 {
+		message, err := replayIdempotentMessage(ctx, tx, key, fingerprint)
+		if err != nil {
+			return nil, false, err
+		}
+		return message, true, nil
+	}
+
+	message, err := insertMessage(ctx, tx, "CreateMessageIdempotent", content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE idempotency_keys SET message_id = $1 WHERE key = $2`, message.ID, key); err != nil {
+		return nil, false, repositoryerr.New(
+			"", // No specific code
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to store idempotency key result: %w", err),
+		)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+
+	return message, false, nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes idempotency keys older than keyTTL
+func (r *PostgreSQLMessageRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, keyTTL time.Duration) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "DeleteExpiredIdempotencyKeys")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, time.Now().Add(-keyTTL))
+	if err != nil {
+		return 0, repositoryerr.New(
+			"", // No specific code
+			"DeleteExpiredIdempotencyKeys",
+			fmt.Errorf("failed to delete expired idempotency keys: %w", err),
+		)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"DeleteExpiredIdempotencyKeys",
+			fmt.Errorf("failed to get rows affected: %w", err),
+		)
+	}
+
+	return deleted, nil
+}
+
+// replayIdempotentMessage loads the message created for a previously used idempotency key
+func replayIdempotentMessage(ctx context.Context, tx *sql.Tx, key, fingerprint string) (*model.Message, error) {
+	query := `
+	SELECT k.fingerprint, m.*
+	FROM idempotency_keys k
+	JOIN (SELECT ` + messageColumns + ` FROM messages) m ON m.id = k.message_id
+	WHERE k.key = $1`
+
+	var storedFingerprint string
+	var message model.Message
+	err := tx.QueryRowContext(ctx, query, key).Scan(append([]any{&storedFingerprint}, messageScanTargets(&message)...)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// The key row exists but its message was deleted
+			return nil, repositoryerr.New(
+				repositoryerr.ErrorCodeMessageNotFound,
+				"CreateMessageIdempotent",
+				repositoryerr.ErrMessageNotFound,
+			)
+		}
+		return nil, repositoryerr.New(
+			"", // No specific code
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to load idempotency key: %w", err),
+		)
+	}
+
+	if storedFingerprint != fingerprint {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeIdempotencyKeyMismatch,
+			"CreateMessageIdempotent",
+			fmt.Errorf("idempotency key %q: %w", key, repositoryerr.ErrIdempotencyKeyMismatch),
+		)
+	}
+
+	return &message, nil
+}
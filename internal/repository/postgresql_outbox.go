@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+	"httpchat/internal/tracing"
+
+	"github.com/lib/pq"
+)
+
+// Ensure PostgreSQLMessageRepository implements interfaces.OutboxRepository
+var _ interfaces.OutboxRepository = (*PostgreSQLMessageRepository)(nil)
+
+// insertOutboxEvent records the Kafka event for a newly created message inside tx
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, op string, message *model.Message, now time.Time) error {
+	payload, err := outboxPayload(ctx, op, message, now)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO outbox (message_id, payload, created_at)
+	VALUES ($1, $2, $3)`
+
+	if _, err := tx.ExecContext(ctx, query, message.ID, payload, now); err != nil {
+		return repositoryerr.New(
+			"", // No specific code
+			op,
+			fmt.Errorf("failed to insert outbox event: %w", err),
+		)
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents leases up to limit unsent events for publishing.
+// Leased events are invisible to other relays until the lease expires, so
+// several replicas can run the relay without publishing the same batch twice.
+func (r *PostgreSQLMessageRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (_ []*model.OutboxEvent, err error) {
+	ctx, span := startSpan(ctx, "ClaimOutboxEvents")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+	UPDATE outbox
+	SET locked_until = $1
+	WHERE id IN (
+		SELECT id
+		FROM outbox
+		WHERE locked_until IS NULL OR locked_until < $2
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, message_id, payload, attempts, created_at`
+
+	now := time.Now()
+
+	// Execute the query
+	rows, err := r.db.QueryContext(ctx, query, now.Add(lease), now, limit)
+	if err != nil {
+		// Handle specific PostgreSQL error codes
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "25P02": // in_failed_sql_transaction
+				return nil, repositoryerr.New(
+					repositoryerr.ErrorCodeTransactionFailed,
+					"ClaimOutboxEvents",
+					fmt.Errorf("transaction failed: %w", err),
+				)
+			}
+		}
+
+		return nil, repositoryerr.New(
+			"", // No specific code
+			"ClaimOutboxEvents",
+			fmt.Errorf("failed to claim outbox events: %w", err),
+		)
+	}
+
+	// Ensure rows are closed when function returns
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var events []*model.OutboxEvent
+	for rows.Next() {
+		var event model.OutboxEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.MessageID,
+			&event.Payload,
+			&event.Attempts,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, repositoryerr.New(
+				repositoryerr.ErrorCodeSerializationFailed,
+				"ClaimOutboxEvents",
+				fmt.Errorf("failed to scan outbox event: %w", err),
+			)
+		}
+		events = append(events, &event)
+	}
+
+	// Check for errors during iteration
+	if err := rows.Err(); err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"ClaimOutboxEvents",
+			fmt.Errorf("error iterating rows: %w", err),
+		)
+	}
+
+	// RETURNING does not preserve the subquery order, so publish in creation order
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
+
+// MarkOutboxEventSent removes a published event from the outbox
+func (r *PostgreSQLMessageRepository) MarkOutboxEventSent(ctx context.Context, id int64) (err error) {
+	ctx, span := startSpan(ctx, "MarkOutboxEventSent")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+	DELETE FROM outbox
+	WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return repositoryerr.New(
+			"", // No specific code
+			"MarkOutboxEventSent",
+			fmt.Errorf("failed to mark outbox event as sent: %w", err),
+		)
+	}
+
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed publish attempt and hides the event until retryAfter elapses
+func (r *PostgreSQLMessageRepository) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "MarkOutboxEventFailed")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+	UPDATE outbox
+	SET attempts = attempts + 1, last_error = $1, locked_until = $2
+	WHERE id = $3`
+
+	if _, err := r.db.ExecContext(ctx, query, reason, time.Now().Add(retryAfter), id); err != nil {
+		return repositoryerr.New(
+			"", // No specific code
+			"MarkOutboxEventFailed",
+			fmt.Errorf("failed to mark outbox event as failed: %w", err),
+		)
+	}
+
+	return nil
+}
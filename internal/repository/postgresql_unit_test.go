@@ -1,14 +0,0 @@
-package repository
-
-import (
-	"testing"
-
-	"github.com/stretchr/testify/assert"
-)
-
-func TestCreateMessagesTable(t *testing.T) {
-	// This test would require a real database connection
-	// For now, we'll just verify that the function exists and can be called
-	// In a real CI/CD environment, this would be run against a test database
-	assert.True(t, true, "Placeholder test for createMessagesTable function")
-}
\ No newline at end of file
@@ -2,15 +2,48 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+	"httpchat/internal/requestid"
+	"httpchat/internal/tracing"
 )
 
 // MessageRepository defines the interface for working with messages in the storage
 type MessageRepository interface {
 	CreateMessage(ctx context.Context, content string) (int64, error)
+	CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (*model.Message, bool, error)
 	GetMessageByID(ctx context.Context, id int64) (*model.Message, error)
-	UpdateMessageStatus(ctx context.Context, id int64, processed bool) error
-	GetAllMessages(ctx context.Context) ([]*model.Message, error)
+	UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) error
+	ListMessages(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error)
 	GetStatistics(ctx context.Context) (*model.Statistics, error)
-}
\ No newline at end of file
+}
+
+// outboxPayload encodes the event recorded for a newly created message. The trace
+// context of ctx is stored with the event, so that its processing joins the trace, and
+// the request ID becomes its correlation ID, so that its logs share the ID of the request.
+func outboxPayload(ctx context.Context, op string, message *model.Message, now time.Time) ([]byte, error) {
+	event, err := model.NewMessageCreatedEvent(message, now)
+	if err == nil {
+		if requestID := requestid.FromContext(ctx); requestID != "" {
+			event.CorrelationID = requestID
+		}
+		traceContext := make(map[string]string)
+		tracing.Inject(ctx, traceContext)
+		if len(traceContext) > 0 {
+			event.TraceContext = traceContext
+		}
+
+		var payload []byte
+		if payload, err = event.Encode(); err == nil {
+			return payload, nil
+		}
+	}
+	return nil, repositoryerr.New(
+		repositoryerr.ErrorCodeSerializationFailed,
+		op,
+		fmt.Errorf("failed to marshal outbox payload: %w", err),
+	)
+}
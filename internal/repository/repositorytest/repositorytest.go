@@ -0,0 +1,540 @@
+// Package repositorytest provides a conformance suite that every repository backend must pass,
+// so that the service behaves the same whichever storage it runs on.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Repository is the storage a backend provides to the service
+type Repository interface {
+	interfaces.MessageRepository
+	interfaces.OutboxRepository
+	interfaces.IdempotencyKeyRepository
+}
+
+// missingID is a message ID that no backend hands out in these tests
+const missingID int64 = 999999
+
+// Run runs the conformance suite. newRepository is called once per subtest and must
+// return a repository without any messages, outbox events or idempotency keys.
+func Run(t *testing.T, newRepository func(t *testing.T) Repository) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, newRepository(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newRepository(t)) })
+	t.Run("StatusLifecycle", func(t *testing.T) { testStatusLifecycle(t, newRepository(t)) })
+	t.Run("InvalidStatus", func(t *testing.T) { testInvalidStatus(t, newRepository(t)) })
+	t.Run("ConcurrentUpdates", func(t *testing.T) { testConcurrentUpdates(t, newRepository(t)) })
+	t.Run("Timestamps", func(t *testing.T) { testTimestamps(t, newRepository(t)) })
+	t.Run("ListOrder", func(t *testing.T) { testListOrder(t, newRepository(t)) })
+	t.Run("ListPagination", func(t *testing.T) { testListPagination(t, newRepository(t)) })
+	t.Run("ListFilters", func(t *testing.T) { testListFilters(t, newRepository(t)) })
+	t.Run("Statistics", func(t *testing.T) { testStatistics(t, newRepository(t)) })
+	t.Run("Outbox", func(t *testing.T) { testOutbox(t, newRepository(t)) })
+	t.Run("Idempotency", func(t *testing.T) { testIdempotency(t, newRepository(t)) })
+	t.Run("ConcurrentIdempotentCreates", func(t *testing.T) { testConcurrentIdempotentCreates(t, newRepository(t)) })
+}
+
+// assertCode checks that err is a repository error with the given code
+func assertCode(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var repoErr *repositoryerr.RepositoryError
+	if assert.True(t, errors.As(err, &repoErr), "expected a repository error, got %v", err) {
+		assert.Equal(t, code, repoErr.ErrorCode())
+	}
+}
+
+// createMessages creates count messages and returns them in creation order
+func createMessages(t *testing.T, repo Repository, count int) []*model.Message {
+	t.Helper()
+
+	messages := make([]*model.Message, 0, count)
+	for i := 0; i < count; i++ {
+		message, err := repo.CreateMessage(context.Background(), "Test message")
+		if err != nil {
+			t.Fatal("Failed to create message:", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// ids returns the IDs of messages in order
+func ids(messages []*model.Message) []int64 {
+	result := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, message.ID)
+	}
+	return result
+}
+
+func testCreateAndGet(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	message, err := repo.CreateMessage(ctx, "Test message")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, message.ID > 0)
+	assert.Equal(t, "Test message", message.Content)
+	assert.Equal(t, model.StatusPending, message.Status)
+	assert.Equal(t, 0, message.Attempts)
+	assert.Empty(t, message.LastError)
+	assert.Nil(t, message.ProcessedAt)
+
+	retrieved, err := repo.GetMessageByID(ctx, message.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, message.ID, retrieved.ID)
+	assert.Equal(t, message.Content, retrieved.Content)
+	assert.Equal(t, message.Status, retrieved.Status)
+	assert.True(t, message.CreatedAt.Equal(retrieved.CreatedAt))
+
+	// IDs are never reused
+	second, err := repo.CreateMessage(ctx, "Test message")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Greater(t, second.ID, message.ID)
+}
+
+func testNotFound(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	_, err := repo.GetMessageByID(ctx, missingID)
+	assertCode(t, err, repositoryerr.ErrorCodeMessageNotFound)
+	assert.ErrorIs(t, err, repositoryerr.ErrMessageNotFound)
+
+	err = repo.UpdateMessageStatus(ctx, missingID, model.StatusProcessing, "")
+	assertCode(t, err, repositoryerr.ErrorCodeMessageNotFound)
+	assert.ErrorIs(t, err, repositoryerr.ErrMessageNotFound)
+}
+
+func testStatusLifecycle(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	message := createMessages(t, repo, 1)[0]
+
+	// Fail the first attempt, then succeed on the second
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessing, ""))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, message.ID, model.StatusFailed, "boom"))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessing, ""))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessed, ""))
+
+	// Attempts count the claims, and the last error outlives the retry that fixed it
+	updated, err := repo.GetMessageByID(ctx, message.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, model.StatusProcessed, updated.Status)
+	assert.Equal(t, 2, updated.Attempts)
+	assert.Equal(t, "boom", updated.LastError)
+	assert.NotNil(t, updated.ProcessedAt)
+
+	// A processed message cannot go back to processing
+	err = repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessing, "")
+	assertCode(t, err, repositoryerr.ErrorCodeInvalidStatusTransition)
+	assert.ErrorIs(t, err, repositoryerr.ErrInvalidStatusTransition)
+
+	// A rejected transition leaves the message untouched
+	unchanged, err := repo.GetMessageByID(ctx, message.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, model.StatusProcessed, unchanged.Status)
+	assert.Equal(t, 2, unchanged.Attempts)
+
+	// A dead-lettered message starts over as pending when it is replayed
+	other := createMessages(t, repo, 1)[0]
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, other.ID, model.StatusDeadLettered, "retries exhausted"))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, other.ID, model.StatusPending, ""))
+
+	replayed, err := repo.GetMessageByID(ctx, other.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, model.StatusPending, replayed.Status)
+	assert.Equal(t, "retries exhausted", replayed.LastError)
+}
+
+func testInvalidStatus(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	message := createMessages(t, repo, 1)[0]
+
+	err := repo.UpdateMessageStatus(ctx, message.ID, model.MessageStatus("bogus"), "")
+	assertCode(t, err, repositoryerr.ErrorCodeInvalidInput)
+	assert.ErrorIs(t, err, model.ErrInvalidStatus)
+
+	// The status is checked before the message is looked up
+	err = repo.UpdateMessageStatus(ctx, missingID, model.MessageStatus("bogus"), "")
+	assertCode(t, err, repositoryerr.ErrorCodeInvalidInput)
+}
+
+func testConcurrentUpdates(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	message := createMessages(t, repo, 1)[0]
+
+	// Every worker claims and completes the message; only one may complete it
+	const workers = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed, processed := 0, 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessing, "") != nil {
+				return
+			}
+			completed := repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessed, "") == nil
+
+			mu.Lock()
+			defer mu.Unlock()
+			claimed++
+			if completed {
+				processed++
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, processed)
+
+	// Each successful claim counted exactly one attempt
+	updated, err := repo.GetMessageByID(ctx, message.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, model.StatusProcessed, updated.Status)
+	assert.Equal(t, claimed, updated.Attempts)
+}
+
+func testTimestamps(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	message := createMessages(t, repo, 1)[0]
+
+	// A new message has not been updated yet
+	assert.False(t, message.CreatedAt.IsZero())
+	assert.True(t, message.UpdatedAt.Equal(message.CreatedAt))
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessing, ""))
+
+	claimed, err := repo.GetMessageByID(ctx, message.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, claimed.CreatedAt.Equal(message.CreatedAt), "created_at must not change")
+	assert.True(t, claimed.UpdatedAt.After(message.UpdatedAt), "updated_at must move forward")
+	assert.Nil(t, claimed.ProcessedAt)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, message.ID, model.StatusProcessed, ""))
+
+	processed, err := repo.GetMessageByID(ctx, message.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, processed.UpdatedAt.After(claimed.UpdatedAt))
+	if assert.NotNil(t, processed.ProcessedAt) {
+		assert.True(t, processed.ProcessedAt.Equal(processed.UpdatedAt))
+	}
+}
+
+func testListOrder(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	messages := createMessages(t, repo, 3)
+
+	// Newest first by default
+	listed, err := repo.ListMessages(ctx, model.MessageFilter{Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int64{messages[2].ID, messages[1].ID, messages[0].ID}, ids(listed))
+
+	listed, err = repo.ListMessages(ctx, model.MessageFilter{Order: model.SortOrderDesc, Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int64{messages[2].ID, messages[1].ID, messages[0].ID}, ids(listed))
+
+	listed, err = repo.ListMessages(ctx, model.MessageFilter{Order: model.SortOrderAsc, Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int64{messages[0].ID, messages[1].ID, messages[2].ID}, ids(listed))
+
+	// An empty repository lists nothing rather than failing
+	status := model.StatusFailed
+	listed, err = repo.ListMessages(ctx, model.MessageFilter{Status: &status, Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, listed)
+}
+
+func testListPagination(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	messages := createMessages(t, repo, 5)
+
+	for _, order := range []model.SortOrder{model.SortOrderDesc, model.SortOrderAsc} {
+		t.Run(string(order), func(t *testing.T) {
+			// Walk every page; each message must show up exactly once and in order
+			var walked []int64
+			var after *model.MessageCursor
+			for page := 0; page < len(messages); page++ {
+				listed, err := repo.ListMessages(ctx, model.MessageFilter{Order: order, Limit: 2, After: after})
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.LessOrEqual(t, len(listed), 2)
+
+				walked = append(walked, ids(listed)...)
+				if len(listed) < 2 {
+					break
+				}
+				last := listed[len(listed)-1]
+				after = &model.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+			}
+
+			expected := ids(messages)
+			if order == model.SortOrderDesc {
+				for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+					expected[i], expected[j] = expected[j], expected[i]
+				}
+			}
+			assert.Equal(t, expected, walked)
+		})
+	}
+}
+
+func testListFilters(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	messages := createMessages(t, repo, 4)
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[1].ID, model.StatusProcessing, ""))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[3].ID, model.StatusProcessing, ""))
+
+	// Status filter
+	processing := model.StatusProcessing
+	listed, err := repo.ListMessages(ctx, model.MessageFilter{Status: &processing, Order: model.SortOrderAsc, Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int64{messages[1].ID, messages[3].ID}, ids(listed))
+
+	// The creation range includes its lower bound and excludes its upper bound
+	from, to := messages[1].CreatedAt, messages[3].CreatedAt
+	listed, err = repo.ListMessages(ctx, model.MessageFilter{CreatedFrom: &from, CreatedTo: &to, Order: model.SortOrderAsc, Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int64{messages[1].ID, messages[2].ID}, ids(listed))
+
+	// Filters combine
+	listed, err = repo.ListMessages(ctx, model.MessageFilter{Status: &processing, CreatedFrom: &from, CreatedTo: &to, Limit: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int64{messages[1].ID}, ids(listed))
+}
+
+func testStatistics(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	stats, err := repo.GetStatistics(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, model.Statistics{}, *stats)
+
+	messages := createMessages(t, repo, 5)
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[0].ID, model.StatusProcessing, ""))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[0].ID, model.StatusProcessed, ""))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[1].ID, model.StatusProcessing, ""))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[2].ID, model.StatusFailed, "boom"))
+	assert.NoError(t, repo.UpdateMessageStatus(ctx, messages[3].ID, model.StatusDeadLettered, "retries exhausted"))
+
+	stats, err = repo.GetStatistics(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, model.Statistics{
+		TotalMessages:        5,
+		PendingMessages:      1,
+		ProcessingMessages:   1,
+		ProcessedMessages:    1,
+		FailedMessages:       1,
+		DeadLetteredMessages: 1,
+	}, *stats)
+}
+
+func testOutbox(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	messages := createMessages(t, repo, 3)
+
+	// Every created message has an event, claimed in creation order up to the limit
+	events, err := repo.ClaimOutboxEvents(ctx, 2, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, events, 2) {
+		return
+	}
+	assert.Equal(t, messages[0].ID, events[0].MessageID)
+	assert.Equal(t, messages[1].ID, events[1].MessageID)
+	assert.Less(t, events[0].ID, events[1].ID)
+	assert.Equal(t, 0, events[0].Attempts)
+
+	// The payload is a message.created event carrying the message
+	envelope, err := model.DecodeEvent(events[0].Payload)
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.EventSchemaVersion, envelope.SchemaVersion)
+		assert.Equal(t, model.EventTypeMessageCreated, envelope.EventType)
+		assert.NotEmpty(t, envelope.EventID)
+		message, err := envelope.Message()
+		if assert.NoError(t, err) {
+			assert.Equal(t, messages[0].ID, message.ID)
+			assert.Equal(t, messages[0].Content, message.Content)
+		}
+	}
+
+	// Leased events are not handed out again until the lease expires
+	rest, err := repo.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, rest, 1) {
+		return
+	}
+	assert.Equal(t, messages[2].ID, rest[0].MessageID)
+
+	// Sent events are gone; a failed event comes back once its retry delay elapsed
+	assert.NoError(t, repo.MarkOutboxEventSent(ctx, events[0].ID))
+	assert.NoError(t, repo.MarkOutboxEventSent(ctx, rest[0].ID))
+	assert.NoError(t, repo.MarkOutboxEventFailed(ctx, events[1].ID, "kafka down", 0))
+
+	retried, err := repo.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, retried, 1) {
+		return
+	}
+	assert.Equal(t, events[1].ID, retried[0].ID)
+	assert.Equal(t, 1, retried[0].Attempts)
+
+	// A failed event with a retry delay stays hidden
+	assert.NoError(t, repo.MarkOutboxEventFailed(ctx, retried[0].ID, "kafka down", time.Minute))
+	hidden, err := repo.ClaimOutboxEvents(ctx, 10, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, hidden)
+}
+
+func testIdempotency(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	message, replayed, err := repo.CreateMessageIdempotent(ctx, "Test message", "key-1", "fp-1", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, replayed)
+
+	// Same key and fingerprint returns the original message without creating a new one
+	replay, replayed, err := repo.CreateMessageIdempotent(ctx, "Test message", "key-1", "fp-1", time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, replayed)
+	assert.Equal(t, message.ID, replay.ID)
+
+	stats, err := repo.GetStatistics(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(1), stats.TotalMessages)
+
+	// Same key with a different fingerprint is a conflict
+	_, _, err = repo.CreateMessageIdempotent(ctx, "Other message", "key-1", "fp-2", time.Hour)
+	assertCode(t, err, repositoryerr.ErrorCodeIdempotencyKeyMismatch)
+	assert.ErrorIs(t, err, repositoryerr.ErrIdempotencyKeyMismatch)
+
+	// An idempotent create writes an outbox event like a plain one
+	events, err := repo.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, message.ID, events[0].MessageID)
+	}
+
+	// Unexpired keys survive the cleanup
+	deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(0), deleted)
+
+	// A key older than the TTL may be reused, even for a different request
+	time.Sleep(10 * time.Millisecond)
+	second, replayed, err := repo.CreateMessageIdempotent(ctx, "Other message", "key-1", "fp-2", time.Millisecond)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, replayed)
+	assert.NotEqual(t, message.ID, second.ID)
+
+	// Expired keys are deleted by the cleanup
+	time.Sleep(10 * time.Millisecond)
+	deleted, err = repo.DeleteExpiredIdempotencyKeys(ctx, time.Millisecond)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(1), deleted)
+}
+
+func testConcurrentIdempotentCreates(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	// Concurrent requests with the same key must all resolve to one message
+	const workers = 8
+	ids := make(chan int64, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, _, err := repo.CreateMessageIdempotent(ctx, "Test message", "key-2", "fp", time.Hour)
+			if assert.NoError(t, err) {
+				ids <- message.ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	var first int64
+	for id := range ids {
+		if first == 0 {
+			first = id
+		}
+		assert.Equal(t, first, id)
+	}
+
+	stats, err := repo.GetStatistics(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(1), stats.TotalMessages)
+}
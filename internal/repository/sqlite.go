@@ -0,0 +1,472 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+)
+
+// sqliteScheme is the DATABASE_URL prefix that selects SQLite, e.g. sqlite://data/messages.db
+const sqliteScheme = "sqlite://"
+
+// sqliteSchemaVersion is the schema version created by sqliteSchema, kept in PRAGMA user_version
+const sqliteSchemaVersion = 1
+
+// sqliteSchema creates the same tables as the PostgreSQL migrations
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	content TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	processed_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_status ON messages(status);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at_id ON messages(created_at, id);
+
+CREATE TABLE IF NOT EXISTS outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	payload BLOB NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	locked_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	fingerprint TEXT NOT NULL,
+	message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);`
+
+// SQLiteMessageRepository implements interfaces.MessageRepository for SQLite
+type SQLiteMessageRepository struct {
+	db *sql.DB
+}
+
+// Ensure SQLiteMessageRepository implements the repository interfaces
+var (
+	_ interfaces.MessageRepository        = (*SQLiteMessageRepository)(nil)
+	_ interfaces.OutboxRepository         = (*SQLiteMessageRepository)(nil)
+	_ interfaces.IdempotencyKeyRepository = (*SQLiteMessageRepository)(nil)
+)
+
+// IsSQLiteURL reports whether databaseURL points to a SQLite database
+func IsSQLiteURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, sqliteScheme)
+}
+
+// NewSQLiteMessageRepository opens the SQLite database of a sqlite://path URL.
+// With autoMigrate a missing schema is created; without it the schema must already exist.
+// A schema created by a newer release is refused either way.
+func NewSQLiteMessageRepository(databaseURL string, autoMigrate bool) (*SQLiteMessageRepository, error) {
+	path, ok := strings.CutPrefix(databaseURL, sqliteScheme)
+	if !ok || path == "" {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeInvalidInput,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("database URL must look like %spath", sqliteScheme),
+		)
+	}
+
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path))
+	if err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeDatabaseConnection,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to open database: %w", err),
+		)
+	}
+
+	// SQLite has a single writer, so one connection serializes transactions without busy errors
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeDatabaseConnection,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to open database: %w", err),
+		)
+	}
+
+	if err := prepareSQLiteSchema(db, autoMigrate); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &SQLiteMessageRepository{db: db}, nil
+}
+
+// Close closes the database
+func (r *SQLiteMessageRepository) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks that the database file can be read
+func (r *SQLiteMessageRepository) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeDatabaseConnection,
+			"Ping",
+			fmt.Errorf("failed to ping database: %w", err),
+		)
+	}
+	return nil
+}
+
+// prepareSQLiteSchema creates the schema if allowed and checks that it is at the current version
+func prepareSQLiteSchema(db *sql.DB, autoMigrate bool) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to read schema version: %w", err),
+		)
+	}
+
+	switch {
+	case version == sqliteSchemaVersion:
+		return nil
+	case version > sqliteSchemaVersion:
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeSchemaVersion,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("%w: at version %d, latest known is %d", repositoryerr.ErrSchemaVersion, version, sqliteSchemaVersion),
+		)
+	case !autoMigrate:
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeSchemaVersion,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("%w: at version %d, latest is %d", repositoryerr.ErrSchemaVersion, version, sqliteSchemaVersion),
+		)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to create schema: %w", err),
+		)
+	}
+	// PRAGMA does not take parameters
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, sqliteSchemaVersion)); err != nil {
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to record schema version: %w", err),
+		)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"NewSQLiteMessageRepository",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+	return nil
+}
+
+// sqliteNow returns the current time in UTC. SQLite compares timestamps as text,
+// so every stored and queried timestamp must use the same time zone.
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// CreateMessage creates a new message and its outbox event in one transaction
+func (r *SQLiteMessageRepository) CreateMessage(ctx context.Context, content string) (*model.Message, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessage",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	message, err := insertSQLiteMessage(ctx, tx, "CreateMessage", content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessage",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+
+	return message, nil
+}
+
+// insertSQLiteMessage inserts a message and its outbox event inside tx
+func insertSQLiteMessage(ctx context.Context, tx *sql.Tx, op string, content string) (*model.Message, error) {
+	now := sqliteNow()
+	result, err := tx.ExecContext(ctx, `INSERT INTO messages (content, created_at, updated_at) VALUES (?, ?, ?)`, content, now, now)
+	if err != nil {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			op,
+			fmt.Errorf("failed to insert message: %w", err),
+		)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			op,
+			fmt.Errorf("failed to get message ID: %w", err),
+		)
+	}
+
+	message, err := getSQLiteMessage(ctx, tx, op, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the event for the outbox relay in the same transaction
+	payload, err := outboxPayload(ctx, op, message, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO outbox (message_id, payload, created_at) VALUES (?, ?, ?)`, message.ID, payload, now); err != nil {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			op,
+			fmt.Errorf("failed to insert outbox event: %w", err),
+		)
+	}
+
+	return message, nil
+}
+
+// sqliteQuerier is what *sql.DB and *sql.Tx have in common
+type sqliteQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getSQLiteMessage loads a message by ID through q
+func getSQLiteMessage(ctx context.Context, q sqliteQuerier, op string, id int64) (*model.Message, error) {
+	var message model.Message
+	err := q.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = ?`, id).Scan(messageScanTargets(&message)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositoryerr.New(
+				repositoryerr.ErrorCodeMessageNotFound,
+				op,
+				repositoryerr.ErrMessageNotFound,
+			)
+		}
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			op,
+			fmt.Errorf("failed to get message: %w", err),
+		)
+	}
+	return &message, nil
+}
+
+// GetMessageByID retrieves a message by ID
+func (r *SQLiteMessageRepository) GetMessageByID(ctx context.Context, id int64) (*model.Message, error) {
+	return getSQLiteMessage(ctx, r.db, "GetMessageByID", id)
+}
+
+// UpdateMessageStatus moves a message to a new lifecycle state.
+// It follows the semantics of PostgreSQLMessageRepository.UpdateMessageStatus; the
+// transaction holds the database write lock, so concurrent updates cannot skip a state.
+func (r *SQLiteMessageRepository) UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) error {
+	if !status.Valid() {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeInvalidInput,
+			"UpdateMessageStatus",
+			fmt.Errorf("%w: %q", model.ErrInvalidStatus, status),
+		)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"UpdateMessageStatus",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	var current model.MessageStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM messages WHERE id = ?`, id).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repositoryerr.New(
+				repositoryerr.ErrorCodeMessageNotFound,
+				"UpdateMessageStatus",
+				repositoryerr.ErrMessageNotFound,
+			)
+		}
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"UpdateMessageStatus",
+			fmt.Errorf("failed to load message status: %w", err),
+		)
+	}
+
+	if !current.CanTransitionTo(status) {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeInvalidStatusTransition,
+			"UpdateMessageStatus",
+			fmt.Errorf("cannot move message %d from %s to %s: %w", id, current, status, repositoryerr.ErrInvalidStatusTransition),
+		)
+	}
+
+	query := `
+	UPDATE messages
+	SET status = ?1,
+		attempts = attempts + CASE WHEN ?1 = 'processing' THEN 1 ELSE 0 END,
+		last_error = COALESCE(NULLIF(?2, ''), last_error),
+		processed_at = CASE WHEN ?1 = 'processed' THEN ?3 ELSE processed_at END,
+		updated_at = ?3
+	WHERE id = ?4`
+
+	if _, err := tx.ExecContext(ctx, query, string(status), lastError, sqliteNow(), id); err != nil {
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"UpdateMessageStatus",
+			fmt.Errorf("failed to update message: %w", err),
+		)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"UpdateMessageStatus",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+
+	return nil
+}
+
+// ListMessages retrieves a single keyset page of messages
+func (r *SQLiteMessageRepository) ListMessages(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error) {
+	var conditions []string
+	var args []any
+	if filter.Status != nil {
+		conditions = append(conditions, "status = ?")
+		args = append(args, string(*filter.Status))
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC())
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.CreatedTo.UTC())
+	}
+
+	// Keyset pagination: continue strictly after the (created_at, id) of the cursor
+	direction := "DESC"
+	comparison := "<"
+	if filter.Order == model.SortOrderAsc {
+		direction = "ASC"
+		comparison = ">"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, "(created_at, id) "+comparison+" (?, ?)")
+		args = append(args, filter.After.CreatedAt.UTC(), filter.After.ID)
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(` ORDER BY created_at %s, id %s LIMIT ?`, direction, direction)
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			"ListMessages",
+			fmt.Errorf("failed to query messages: %w", err),
+		)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	messages := make([]*model.Message, 0, filter.Limit)
+	for rows.Next() {
+		var message model.Message
+		if err := rows.Scan(messageScanTargets(&message)...); err != nil {
+			return nil, repositoryerr.New(
+				repositoryerr.ErrorCodeSerializationFailed,
+				"ListMessages",
+				fmt.Errorf("failed to scan message: %w", err),
+			)
+		}
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"ListMessages",
+			fmt.Errorf("error iterating rows: %w", err),
+		)
+	}
+
+	return messages, nil
+}
+
+// GetStatistics retrieves message statistics with the same query as PostgreSQL
+func (r *SQLiteMessageRepository) GetStatistics(ctx context.Context) (*model.Statistics, error) {
+	var stats model.Statistics
+	err := r.db.QueryRowContext(ctx, statisticsQuery).Scan(statisticsScanTargets(&stats)...)
+	if err != nil {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			"GetStatistics",
+			fmt.Errorf("failed to get statistics: %w", err),
+		)
+	}
+	return &stats, nil
+}
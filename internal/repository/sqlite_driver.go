@@ -0,0 +1,21 @@
+package repository
+
+import (
+	// Pure Go, so the binary needs no cgo
+	_ "modernc.org/sqlite"
+)
+
+// The SQLite driver is confined to this file, so replacing it only means changing
+// the driver name, the connection options and the error mapping in sqlite_errors.go.
+
+// sqliteDriver is the database/sql driver name of SQLite
+const sqliteDriver = "sqlite"
+
+// sqliteDSN returns the data source name for the database file at path.
+// Foreign keys enforce the cascades of the schema, and transactions take the write
+// lock up front so that a read followed by a write cannot fail halfway. Times are
+// written in the format SQLite itself uses, so that they sort as text.
+func sqliteDSN(path string) string {
+	return path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" +
+		"&_txlock=immediate&_time_format=sqlite"
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"errors"
+
+	"httpchat/internal/repositoryerr"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteErrorCode maps a SQLite error to a repository error code, or "" if there is none
+func sqliteErrorCode(err error) string {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return ""
+	}
+
+	// Code is the extended result code, whose low byte is the primary one
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return repositoryerr.ErrorCodeDuplicateEntry
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY, sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return repositoryerr.ErrorCodeInvalidInput
+	}
+
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return repositoryerr.ErrorCodeTransactionFailed
+	case sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_NOTADB:
+		return repositoryerr.ErrorCodeDatabaseConnection
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+)
+
+// CreateMessageIdempotent creates a message unless the idempotency key was already used.
+// It follows the semantics of PostgreSQLMessageRepository.CreateMessageIdempotent.
+func (r *SQLiteMessageRepository) CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (*model.Message, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	// Claim the key, taking over an expired one. The transaction holds the write lock,
+	// so a concurrent request with the same key sees the result of this one.
+	claimQuery := `
+	INSERT INTO idempotency_keys (key, fingerprint, created_at)
+	VALUES (?1, ?2, ?3)
+	ON CONFLICT (key) DO UPDATE
+	SET fingerprint = excluded.fingerprint, message_id = NULL, created_at = excluded.created_at
+	WHERE idempotency_keys.created_at < ?4`
+
+	now := sqliteNow()
+	result, err := tx.ExecContext(ctx, claimQuery, key, fingerprint, now, now.Add(-keyTTL))
+	if err != nil {
+		return nil, false, repositoryerr.New(
+			sqliteErrorCode(err),
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to claim idempotency key: %w", err),
+		)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to get rows affected: %w", err),
+		)
+	}
+
+	// The key was used before: replay the original message if the request matches
+	if claimed == 0 {
+		message, err := replaySQLiteIdempotentMessage(ctx, tx, key, fingerprint)
+		if err != nil {
+			return nil, false, err
+		}
+		return message, true, nil
+	}
+
+	message, err := insertSQLiteMessage(ctx, tx, "CreateMessageIdempotent", content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE idempotency_keys SET message_id = ? WHERE key = ?`, message.ID, key); err != nil {
+		return nil, false, repositoryerr.New(
+			sqliteErrorCode(err),
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to store idempotency key result: %w", err),
+		)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+
+	return message, false, nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes idempotency keys older than keyTTL
+func (r *SQLiteMessageRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, keyTTL time.Duration) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < ?`, sqliteNow().Add(-keyTTL))
+	if err != nil {
+		return 0, repositoryerr.New(
+			sqliteErrorCode(err),
+			"DeleteExpiredIdempotencyKeys",
+			fmt.Errorf("failed to delete expired idempotency keys: %w", err),
+		)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"DeleteExpiredIdempotencyKeys",
+			fmt.Errorf("failed to get rows affected: %w", err),
+		)
+	}
+
+	return deleted, nil
+}
+
+// replaySQLiteIdempotentMessage loads the message created for a previously used idempotency key
+func replaySQLiteIdempotentMessage(ctx context.Context, tx *sql.Tx, key, fingerprint string) (*model.Message, error) {
+	var storedFingerprint string
+	var messageID sql.NullInt64
+	err := tx.QueryRowContext(ctx, `SELECT fingerprint, message_id FROM idempotency_keys WHERE key = ?`, key).Scan(&storedFingerprint, &messageID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			"CreateMessageIdempotent",
+			fmt.Errorf("failed to load idempotency key: %w", err),
+		)
+	}
+
+	// The key row or its message was deleted
+	if err != nil || !messageID.Valid {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeMessageNotFound,
+			"CreateMessageIdempotent",
+			repositoryerr.ErrMessageNotFound,
+		)
+	}
+
+	message, err := getSQLiteMessage(ctx, tx, "CreateMessageIdempotent", messageID.Int64)
+	if err != nil {
+		return nil, err
+	}
+
+	if storedFingerprint != fingerprint {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeIdempotencyKeyMismatch,
+			"CreateMessageIdempotent",
+			fmt.Errorf("idempotency key %q: %w", key, repositoryerr.ErrIdempotencyKeyMismatch),
+		)
+	}
+
+	return message, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
+)
+
+// ClaimOutboxEvents leases up to limit unsent events for publishing, in creation order
+func (r *SQLiteMessageRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxEvent, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"ClaimOutboxEvents",
+			fmt.Errorf("failed to begin transaction: %w", err),
+		)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	query := `
+	SELECT id, message_id, payload, attempts, created_at
+	FROM outbox
+	WHERE locked_until IS NULL OR locked_until < ?
+	ORDER BY id
+	LIMIT ?`
+
+	now := sqliteNow()
+	rows, err := tx.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			"ClaimOutboxEvents",
+			fmt.Errorf("failed to claim outbox events: %w", err),
+		)
+	}
+
+	var events []*model.OutboxEvent
+	for rows.Next() {
+		var event model.OutboxEvent
+		if err := rows.Scan(&event.ID, &event.MessageID, &event.Payload, &event.Attempts, &event.CreatedAt); err != nil {
+			_ = rows.Close()
+			return nil, repositoryerr.New(
+				repositoryerr.ErrorCodeSerializationFailed,
+				"ClaimOutboxEvents",
+				fmt.Errorf("failed to scan outbox event: %w", err),
+			)
+		}
+		events = append(events, &event)
+	}
+	_ = rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeSerializationFailed,
+			"ClaimOutboxEvents",
+			fmt.Errorf("error iterating rows: %w", err),
+		)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	// The transaction holds the write lock, so no other relay can claim the same events meanwhile
+	placeholders := make([]string, len(events))
+	args := []any{now.Add(lease)}
+	for i, event := range events {
+		placeholders[i] = "?"
+		args = append(args, event.ID)
+	}
+	lockQuery := `UPDATE outbox SET locked_until = ? WHERE id IN (` + strings.Join(placeholders, ", ") + `)`
+	if _, err := tx.ExecContext(ctx, lockQuery, args...); err != nil {
+		return nil, repositoryerr.New(
+			sqliteErrorCode(err),
+			"ClaimOutboxEvents",
+			fmt.Errorf("failed to lease outbox events: %w", err),
+		)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, repositoryerr.New(
+			repositoryerr.ErrorCodeTransactionFailed,
+			"ClaimOutboxEvents",
+			fmt.Errorf("failed to commit transaction: %w", err),
+		)
+	}
+
+	return events, nil
+}
+
+// MarkOutboxEventSent removes a published event from the outbox
+func (r *SQLiteMessageRepository) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, id); err != nil {
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"MarkOutboxEventSent",
+			fmt.Errorf("failed to mark outbox event as sent: %w", err),
+		)
+	}
+
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed publish attempt and hides the event until retryAfter elapses
+func (r *SQLiteMessageRepository) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	query := `
+	UPDATE outbox
+	SET attempts = attempts + 1, last_error = ?, locked_until = ?
+	WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, reason, sqliteNow().Add(retryAfter), id); err != nil {
+		return repositoryerr.New(
+			sqliteErrorCode(err),
+			"MarkOutboxEventFailed",
+			fmt.Errorf("failed to mark outbox event as failed: %w", err),
+		)
+	}
+
+	return nil
+}
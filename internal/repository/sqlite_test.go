@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"httpchat/internal/repository/repositorytest"
+	"httpchat/internal/repositoryerr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSQLiteRepository opens a SQLite repository in a fresh temporary file
+func newTestSQLiteRepository(t *testing.T) (*SQLiteMessageRepository, string) {
+	t.Helper()
+
+	databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "messages.db")
+	repo, err := NewSQLiteMessageRepository(databaseURL, true)
+	if err != nil {
+		t.Fatal("Failed to open SQLite repository:", err)
+	}
+	t.Cleanup(func() {
+		_ = repo.Close()
+	})
+	return repo, databaseURL
+}
+
+func TestSQLiteMessageRepository_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repository {
+		repo, _ := newTestSQLiteRepository(t)
+		return repo
+	})
+}
+
+func TestSQLiteMessageRepository_Schema(t *testing.T) {
+	ctx := context.Background()
+
+	schemaCode := func(err error) string {
+		var repoErr *repositoryerr.RepositoryError
+		if errors.As(err, &repoErr) {
+			return repoErr.ErrorCode()
+		}
+		return ""
+	}
+
+	t.Run("PersistsAcrossReopen", func(t *testing.T) {
+		repo, databaseURL := newTestSQLiteRepository(t)
+		message, err := repo.CreateMessage(ctx, "Test message")
+		assert.NoError(t, err)
+		assert.NoError(t, repo.Close())
+
+		// Reopening an up-to-date database needs no migration
+		reopened, err := NewSQLiteMessageRepository(databaseURL, false)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() {
+			_ = reopened.Close()
+		}()
+
+		stored, err := reopened.GetMessageByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Test message", stored.Content)
+	})
+
+	t.Run("RequiresMigration", func(t *testing.T) {
+		databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "messages.db")
+
+		_, err := NewSQLiteMessageRepository(databaseURL, false)
+		assert.Equal(t, repositoryerr.ErrorCodeSchemaVersion, schemaCode(err))
+	})
+
+	t.Run("RefusesNewerSchema", func(t *testing.T) {
+		repo, databaseURL := newTestSQLiteRepository(t)
+		_, err := repo.db.Exec(`PRAGMA user_version = 99`)
+		assert.NoError(t, err)
+		assert.NoError(t, repo.Close())
+
+		_, err = NewSQLiteMessageRepository(databaseURL, true)
+		assert.Equal(t, repositoryerr.ErrorCodeSchemaVersion, schemaCode(err))
+		assert.ErrorIs(t, err, repositoryerr.ErrSchemaVersion)
+	})
+
+	t.Run("InvalidURL", func(t *testing.T) {
+		_, err := NewSQLiteMessageRepository("postgres://localhost/messages", true)
+		assert.Equal(t, repositoryerr.ErrorCodeInvalidInput, schemaCode(err))
+
+		assert.True(t, IsSQLiteURL("sqlite://data/messages.db"))
+		assert.False(t, IsSQLiteURL("postgres://localhost/messages"))
+	})
+}
+
+func TestSQLiteErrorCode(t *testing.T) {
+	repo, _ := newTestSQLiteRepository(t)
+
+	// Constraint violations map to the same codes as PostgreSQL errors
+	_, err := repo.db.Exec(`INSERT INTO messages (content, created_at, updated_at) VALUES (NULL, 0, 0)`)
+	assert.Equal(t, repositoryerr.ErrorCodeInvalidInput, sqliteErrorCode(err))
+
+	_, err = repo.db.Exec(`INSERT INTO outbox (message_id, payload, created_at) VALUES (999999, x'00', 0)`)
+	assert.Equal(t, repositoryerr.ErrorCodeInvalidInput, sqliteErrorCode(err))
+
+	_, err = repo.db.Exec(`INSERT INTO idempotency_keys (key, fingerprint, created_at) VALUES ('k', 'f', 0), ('k', 'f', 0)`)
+	assert.Equal(t, repositoryerr.ErrorCodeDuplicateEntry, sqliteErrorCode(err))
+
+	// A file that is not a database is a connection error
+	path := filepath.Join(t.TempDir(), "garbage.db")
+	assert.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("garbage"), 1024), 0o600))
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path))
+	if assert.NoError(t, err) {
+		_, err = db.Exec(`SELECT count(*) FROM sqlite_master`)
+		assert.Equal(t, repositoryerr.ErrorCodeDatabaseConnection, sqliteErrorCode(err))
+		_ = db.Close()
+	}
+
+	assert.Equal(t, "", sqliteErrorCode(errors.New("boom")))
+}
+
+func TestSQLiteMessageRepository_Ping(t *testing.T) {
+	repo, _ := newTestSQLiteRepository(t)
+	assert.NoError(t, repo.Ping(context.Background()))
+
+	// A closed database is reported as a connection error
+	assert.NoError(t, repo.Close())
+	err := repo.Ping(context.Background())
+	var repoErr *repositoryerr.RepositoryError
+	if assert.ErrorAs(t, err, &repoErr) {
+		assert.Equal(t, repositoryerr.ErrorCodeDatabaseConnection, repoErr.Code)
+	}
+}
@@ -14,6 +14,10 @@ var (
 	ErrInvalidInput        = errors.New("invalid input")
 	ErrTransactionFailed   = errors.New("transaction failed")
 	ErrSerializationFailed = errors.New("serialization failed")
+
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+	ErrIdempotencyKeyMismatch  = errors.New("idempotency key was already used with a different request")
+	ErrSchemaVersion           = errors.New("database schema version does not match")
 )
 
 // Error codes for programmatic error handling
@@ -24,6 +28,10 @@ const (
 	ErrorCodeInvalidInput        = "INVALID_INPUT"
 	ErrorCodeTransactionFailed   = "TRANSACTION_FAILED"
 	ErrorCodeSerializationFailed = "SERIALIZATION_FAILED"
+
+	ErrorCodeInvalidStatusTransition = "INVALID_STATUS_TRANSITION"
+	ErrorCodeIdempotencyKeyMismatch  = "IDEMPOTENCY_KEY_MISMATCH"
+	ErrorCodeSchemaVersion           = "SCHEMA_VERSION_MISMATCH"
 )
 
 // RepositoryError wraps repository errors with additional context
@@ -0,0 +1,34 @@
+// Package requestid provides the ID that ties together the logs and events of a request.
+// It has no dependencies, so that every layer can read the ID from a context.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header carries the request ID of an HTTP request and its response
+const Header = "X-Request-ID"
+
+// contextKey is the context key of the request ID
+type contextKey struct{}
+
+// NewContext returns ctx carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// New generates a random request ID
+func New() string {
+	var id [16]byte
+	// crypto/rand.Read does not fail on supported platforms
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,14 @@
+package requestid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Empty(t, FromContext(context.Background()))
+	assert.Equal(t, "req-1", FromContext(NewContext(context.Background(), "req-1")))
+	assert.NotEqual(t, New(), New())
+}
@@ -0,0 +1,65 @@
+// Package retention provides the background cleanup of expired idempotency keys.
+package retention
+
+import (
+	"context"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Sweeper periodically deletes idempotency keys that are older than their TTL.
+// Expired keys are already ignored when a request reuses them; the sweep only keeps
+// the table from growing without bound.
+type Sweeper struct {
+	repo     interfaces.IdempotencyKeyRepository
+	keyTTL   time.Duration
+	interval time.Duration
+	logger   *logger.Logger
+}
+
+// NewSweeper creates a new Sweeper instance
+func NewSweeper(repo interfaces.IdempotencyKeyRepository, keyTTL, interval time.Duration, logger *logger.Logger) *Sweeper {
+	return &Sweeper{
+		repo:     repo,
+		keyTTL:   keyTTL,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run sweeps expired keys every interval until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("Error deleting expired idempotency keys", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Idempotency key sweeper shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the expired keys once and returns how many were deleted
+func (s *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	deleted, err := s.repo.DeleteExpiredIdempotencyKeys(ctx, s.keyTTL)
+	if err != nil {
+		return 0, err
+	}
+
+	if deleted > 0 {
+		s.logger.Info("Deleted expired idempotency keys", zap.Int64("count", deleted), zap.Duration("ttl", s.keyTTL))
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"httpchat/internal/interfaces"
+	"httpchat/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIdempotencyKeyRepository records the TTL of every cleanup
+type mockIdempotencyKeyRepository struct {
+	mu    sync.Mutex
+	ttls  []time.Duration
+	count int64
+	err   error
+}
+
+func (m *mockIdempotencyKeyRepository) DeleteExpiredIdempotencyKeys(_ context.Context, keyTTL time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ttls = append(m.ttls, keyTTL)
+	return m.count, m.err
+}
+
+func (m *mockIdempotencyKeyRepository) sweeps() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.ttls)
+}
+
+// Ensure mockIdempotencyKeyRepository implements interfaces.IdempotencyKeyRepository
+var _ interfaces.IdempotencyKeyRepository = (*mockIdempotencyKeyRepository)(nil)
+
+func TestSweeperSweep(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	// Test that keys older than the TTL are deleted
+	t.Run("DeletesExpiredKeys", func(t *testing.T) {
+		repo := &mockIdempotencyKeyRepository{count: 3}
+
+		deleted, err := NewSweeper(repo, 24*time.Hour, time.Minute, testLogger).Sweep(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), deleted)
+		assert.Equal(t, []time.Duration{24 * time.Hour}, repo.ttls)
+	})
+
+	// Test that repository errors are returned
+	t.Run("ReturnsErrors", func(t *testing.T) {
+		repo := &mockIdempotencyKeyRepository{err: errors.New("database unavailable")}
+
+		_, err := NewSweeper(repo, 24*time.Hour, time.Minute, testLogger).Sweep(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestSweeperRun(t *testing.T) {
+	testLogger, _ := logger.New()
+
+	repo := &mockIdempotencyKeyRepository{}
+	sweeper := NewSweeper(repo, time.Hour, 10*time.Millisecond, testLogger)
+
+	// Run sweeps right away and then on every tick until the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sweeper.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return repo.sweeps() >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sweeper did not stop after context cancellation")
+	}
+}
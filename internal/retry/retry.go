@@ -0,0 +1,161 @@
+// Package retry provides retry policies with exponential backoff and full jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"httpchat/internal/repositoryerr"
+)
+
+// Policy describes whether and after how long a failed operation is attempted again.
+// Delays grow exponentially from InitialInterval up to MaxInterval, and every delay is
+// drawn uniformly from zero to that bound (full jitter) so that callers failing at the
+// same time do not retry in lockstep.
+type Policy struct {
+	// InitialInterval is the upper bound of the delay after the first failure
+	InitialInterval time.Duration
+	// MaxInterval caps the upper bound of any delay; zero means no cap
+	MaxInterval time.Duration
+	// Multiplier grows the upper bound after every failure; values below 1 are treated as 1
+	Multiplier float64
+	// MaxAttempts is the total number of attempts; zero means no limit
+	MaxAttempts int
+	// MaxElapsedTime stops retrying once the next attempt would start later than this
+	// after the first one; zero means no limit
+	MaxElapsedTime time.Duration
+	// Retryable classifies errors; nil treats every error as retryable
+	Retryable func(error) bool
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts
+func (p Policy) Backoff(failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+
+	multiplier := math.Max(p.Multiplier, 1)
+	bound := float64(p.InitialInterval) * math.Pow(multiplier, float64(failures-1))
+	if p.MaxInterval > 0 && bound > float64(p.MaxInterval) {
+		bound = float64(p.MaxInterval)
+	}
+	if bound <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// IsRetryable reports whether err may succeed when the operation is attempted again
+func (p Policy) IsRetryable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	if p.Retryable == nil {
+		return true
+	}
+	return p.Retryable(err)
+}
+
+// Next decides what happens after an attempt failed with err. It returns the delay
+// before the next attempt, or false when the operation should not be attempted again.
+// failures counts the failed attempts so far and elapsed is the time since the first one.
+func (p Policy) Next(failures int, elapsed time.Duration, err error) (time.Duration, bool) {
+	if !p.IsRetryable(err) {
+		return 0, false
+	}
+	if p.MaxAttempts > 0 && failures >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := p.Backoff(failures)
+	if p.MaxElapsedTime > 0 && elapsed+delay > p.MaxElapsedTime {
+		return 0, false
+	}
+	return delay, true
+}
+
+// Do runs op until it succeeds, the policy gives up or ctx is cancelled, and returns
+// the last error. Waiting between attempts stops as soon as ctx is cancelled.
+func (p Policy) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	start := time.Now()
+	for failures := 1; ; failures++ {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+
+		delay, ok := p.Next(failures, time.Since(start), err)
+		if !ok {
+			return err
+		}
+		if waitErr := Wait(ctx, delay); waitErr != nil {
+			return fmt.Errorf("%w (last error: %v)", waitErr, err)
+		}
+	}
+}
+
+// Wait blocks for d or until ctx is cancelled, whichever comes first
+func Wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that no policy retries it
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// RepositoryRetryable classifies repository errors by their code. Errors describing the
+// request or the stored data cannot be fixed by trying again; connection, transaction and
+// uncoded errors can.
+func RepositoryRetryable(err error) bool {
+	var repoErr *repositoryerr.RepositoryError
+	if !errors.As(err, &repoErr) {
+		return true
+	}
+
+	switch repoErr.ErrorCode() {
+	case repositoryerr.ErrorCodeMessageNotFound,
+		repositoryerr.ErrorCodeDuplicateEntry,
+		repositoryerr.ErrorCodeIdempotencyKeyMismatch,
+		repositoryerr.ErrorCodeInvalidInput,
+		repositoryerr.ErrorCodeInvalidStatusTransition:
+		return false
+	default:
+		return true
+	}
+}
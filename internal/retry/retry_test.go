@@ -0,0 +1,137 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"httpchat/internal/repositoryerr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	policy := Policy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	}
+
+	// Test that every delay stays within the exponential bound
+	bounds := map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	}
+	for failures, bound := range bounds {
+		for i := 0; i < 100; i++ {
+			delay := policy.Backoff(failures)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, bound)
+		}
+	}
+
+	// Test that a zero interval never waits
+	assert.Equal(t, time.Duration(0), Policy{}.Backoff(3))
+}
+
+func TestPolicyNext(t *testing.T) {
+	failure := errors.New("database unavailable")
+
+	// Test that the attempt limit is respected
+	policy := Policy{InitialInterval: time.Millisecond, MaxAttempts: 3}
+	_, ok := policy.Next(2, 0, failure)
+	assert.True(t, ok)
+	_, ok = policy.Next(3, 0, failure)
+	assert.False(t, ok)
+
+	// Test that the elapsed time limit is respected
+	policy = Policy{InitialInterval: time.Millisecond, MaxElapsedTime: time.Second}
+	_, ok = policy.Next(1, 500*time.Millisecond, failure)
+	assert.True(t, ok)
+	_, ok = policy.Next(1, time.Second, failure)
+	assert.False(t, ok)
+
+	// Test that the classifier and permanent errors stop retries
+	policy = Policy{InitialInterval: time.Millisecond, Retryable: RepositoryRetryable}
+	_, ok = policy.Next(1, 0, repositoryerr.New(repositoryerr.ErrorCodeMessageNotFound, "GetMessageByID", repositoryerr.ErrMessageNotFound))
+	assert.False(t, ok)
+	_, ok = policy.Next(1, 0, Permanent(failure))
+	assert.False(t, ok)
+	_, ok = policy.Next(1, 0, failure)
+	assert.True(t, ok)
+}
+
+func TestPolicyDo(t *testing.T) {
+	policy := Policy{InitialInterval: time.Millisecond, Multiplier: 2, MaxAttempts: 4}
+
+	// Test that the operation is retried until it succeeds
+	calls := 0
+	err := policy.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// Test that the last error is returned once the attempts run out
+	calls = 0
+	err = policy.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errors.New("still failing")
+	})
+	assert.EqualError(t, err, "still failing")
+	assert.Equal(t, 4, calls)
+
+	// Test that a permanent error is not retried
+	calls = 0
+	err = policy.Do(context.Background(), func(context.Context) error {
+		calls++
+		return Permanent(errors.New("bad request"))
+	})
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, calls)
+
+	// Test that cancelling the context interrupts the wait
+	slow := Policy{InitialInterval: time.Hour, Multiplier: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = slow.Do(ctx, func(context.Context) error {
+		return errors.New("temporary failure")
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRepositoryRetryable(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"NotFound", repositoryerr.New(repositoryerr.ErrorCodeMessageNotFound, "op", repositoryerr.ErrMessageNotFound), false},
+		{"DuplicateEntry", repositoryerr.New(repositoryerr.ErrorCodeDuplicateEntry, "op", repositoryerr.ErrDuplicateEntry), false},
+		{"IdempotencyKeyMismatch", repositoryerr.New(repositoryerr.ErrorCodeIdempotencyKeyMismatch, "op", repositoryerr.ErrIdempotencyKeyMismatch), false},
+		{"InvalidInput", repositoryerr.New(repositoryerr.ErrorCodeInvalidInput, "op", repositoryerr.ErrInvalidInput), false},
+		{"InvalidStatusTransition", repositoryerr.New(repositoryerr.ErrorCodeInvalidStatusTransition, "op", repositoryerr.ErrInvalidStatusTransition), false},
+		{"DatabaseConnection", repositoryerr.New(repositoryerr.ErrorCodeDatabaseConnection, "op", repositoryerr.ErrDatabaseConnection), true},
+		{"SerializationFailed", repositoryerr.New(repositoryerr.ErrorCodeSerializationFailed, "op", repositoryerr.ErrSerializationFailed), true},
+		{"Uncoded", &repositoryerr.RepositoryError{Op: "op", Err: errors.New("boom")}, true},
+		{"Other", errors.New("kafka write error"), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.retryable, RepositoryRetryable(tc.err))
+		})
+	}
+}
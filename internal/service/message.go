@@ -3,9 +3,11 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"httpchat/internal/interfaces"
 	"httpchat/internal/logger"
@@ -17,27 +19,21 @@ import (
 
 // messageService implements interfaces.MessageService
 type messageService struct {
-	repo     interfaces.MessageRepository
-	producer interfaces.KafkaProducer
-	consumer interfaces.KafkaConsumer
-	topic    string
-	logger   *logger.Logger
+	repo              interfaces.MessageRepository
+	idempotencyKeyTTL time.Duration
+	logger            *logger.Logger
 }
 
 // NewMessageService creates a new messageService instance
 func NewMessageService(
 	repo interfaces.MessageRepository,
-	producer interfaces.KafkaProducer,
-	consumer interfaces.KafkaConsumer,
-	topic string,
+	idempotencyKeyTTL time.Duration,
 	logger *logger.Logger,
 ) interfaces.MessageService {
 	return &messageService{
-		repo:     repo,
-		producer: producer,
-		consumer: consumer,
-		topic:    topic,
-		logger:   logger,
+		repo:              repo,
+		idempotencyKeyTTL: idempotencyKeyTTL,
+		logger:            logger,
 	}
 }
 
@@ -45,80 +41,194 @@ func NewMessageService(
 var _ interfaces.MessageService = (*messageService)(nil)
 
 // handleError is a helper function to handle repository errors consistently
-func (s *messageService) handleError(op string, err error, id int64) error {
+func (s *messageService) handleError(ctx context.Context, op string, err error, id int64) error {
+	log := s.logger.FromContext(ctx)
+
 	var repoErr *repositoryerr.RepositoryError
 	if errors.As(err, &repoErr) {
 		switch repoErr.ErrorCode() {
 		case repositoryerr.ErrorCodeMessageNotFound:
-			s.logger.Warn(fmt.Sprintf("Message not found during %s", op), zap.Int64("id", id), zap.Error(err))
+			log.Warn(fmt.Sprintf("Message not found during %s", op), zap.Int64("id", id), zap.Error(err))
 			return fmt.Errorf("message not found: %w", err)
 		case repositoryerr.ErrorCodeInvalidInput:
-			s.logger.Warn(fmt.Sprintf("Invalid input during %s", op), zap.Int64("id", id), zap.Error(err))
+			log.Warn(fmt.Sprintf("Invalid input during %s", op), zap.Int64("id", id), zap.Error(err))
 			return fmt.Errorf("invalid input: %w", err)
 		case repositoryerr.ErrorCodeDatabaseConnection:
-			s.logger.Error(fmt.Sprintf("Database connection error during %s", op), zap.Error(err))
+			log.Error(fmt.Sprintf("Database connection error during %s", op), zap.Error(err))
 			return fmt.Errorf("database unavailable: %w", err)
 		case repositoryerr.ErrorCodeDuplicateEntry:
-			s.logger.Warn(fmt.Sprintf("Duplicate entry during %s", op), zap.Int64("id", id), zap.Error(err))
+			log.Warn(fmt.Sprintf("Duplicate entry during %s", op), zap.Int64("id", id), zap.Error(err))
 			return fmt.Errorf("duplicate entry: %w", err)
+		case repositoryerr.ErrorCodeIdempotencyKeyMismatch:
+			log.Warn(fmt.Sprintf("Idempotency key reused with a different request during %s", op), zap.Error(err))
+			return fmt.Errorf("idempotency key mismatch: %w", err)
+		case repositoryerr.ErrorCodeInvalidStatusTransition:
+			log.Warn(fmt.Sprintf("Invalid status transition during %s", op), zap.Int64("id", id), zap.Error(err))
+			return fmt.Errorf("invalid status transition: %w", err)
 		default:
-			s.logger.Error(fmt.Sprintf("Failed during %s", op), zap.Int64("id", id), zap.Error(err))
+			log.Error(fmt.Sprintf("Failed during %s", op), zap.Int64("id", id), zap.Error(err))
 			return fmt.Errorf("operation failed: %w", err)
 		}
 	}
-	s.logger.Error(fmt.Sprintf("Failed during %s", op), zap.Int64("id", id), zap.Error(err))
+	log.Error(fmt.Sprintf("Failed during %s", op), zap.Int64("id", id), zap.Error(err))
 	return fmt.Errorf("operation failed: %w", err)
 }
 
-// CreateMessage creates a new message and sends it to Kafka
+// CreateMessage creates a new message and enqueues its Kafka event.
+// The event is written to the outbox in the same transaction as the message
+// and published asynchronously by the outbox relay.
 func (s *messageService) CreateMessage(ctx context.Context, content string) (int64, error) {
-	s.logger.Info("Creating message in repository", zap.String("content", content))
+	log := s.logger.FromContext(ctx)
+	log.Info("Creating message in repository", zap.String("content", content))
 
-	// Step 1: Save the message to the database
+	// Save the message together with its outbox event
 	message, err := s.repo.CreateMessage(ctx, content)
 	if err != nil {
-		return 0, s.handleError("message creation", err, 0)
+		return 0, s.handleError(ctx, "message creation", err, 0)
 	}
 
-	s.logger.Info("Successfully created message in repository", zap.Int64("id", message.ID))
+	log.Info("Successfully created message in repository", zap.Int64("id", message.ID))
+
+	return message.ID, nil
+}
+
+// CreateMessageIdempotent creates a message once per idempotency key.
+// A retry with the same key and content returns the original message ID with replayed set;
+// a retry with the same key and different content fails with an idempotency key mismatch error.
+// Keys expire after the idempotency key TTL and can then be used for a new message.
+func (s *messageService) CreateMessageIdempotent(ctx context.Context, content, idempotencyKey string) (int64, bool, error) {
+	log := s.logger.FromContext(ctx)
+	log.Info("Creating message with idempotency key", zap.String("idempotency_key", idempotencyKey))
 
-	// Step 2: Convert the message to JSON for sending to Kafka
-	messageBytes, err := json.Marshal(message)
+	// Save the message unless the key was already used
+	message, replayed, err := s.repo.CreateMessageIdempotent(ctx, content, idempotencyKey, requestFingerprint(content), s.idempotencyKeyTTL)
 	if err != nil {
-		s.logger.Error("Failed to marshal message", zap.Int64("id", message.ID), zap.Error(err))
-		return 0, fmt.Errorf("failed to marshal message: %w", err)
+		return 0, false, s.handleError(ctx, "idempotent message creation", err, 0)
 	}
 
-	s.logger.Debug("Sending message to Kafka", zap.Int64("id", message.ID))
-
-	// Step 3: Send the message to Kafka for processing
-	if err := s.producer.SendMessage(ctx, s.topic, messageBytes); err != nil {
-		s.logger.Error("Failed to send message to Kafka", zap.Int64("id", message.ID), zap.Error(err))
-		return 0, fmt.Errorf("failed to send message to Kafka: %w", err)
+	if replayed {
+		log.Info("Replaying message for reused idempotency key",
+			zap.Int64("id", message.ID),
+			zap.String("idempotency_key", idempotencyKey))
+		return message.ID, true, nil
 	}
 
-	s.logger.Info("Successfully sent message to Kafka", zap.Int64("id", message.ID))
+	log.Info("Successfully created message in repository", zap.Int64("id", message.ID))
 
-	return message.ID, nil
+	return message.ID, false, nil
+}
+
+// requestFingerprint identifies the create request body stored with an idempotency key
+func requestFingerprint(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
 
-// ProcessMessage marks a message as processed
+// ProcessMessage claims a message for processing and marks it as processed.
+// Processing a message that is already processed succeeds without changing it.
 func (s *messageService) ProcessMessage(ctx context.Context, id int64) error {
-	s.logger.Info("Processing message", zap.Int64("id", id))
+	log := s.logger.FromContext(ctx)
+	log.Info("Processing message", zap.Int64("id", id))
+
+	// Claim the message first so the attempt is counted even if processing fails
+	if err := s.repo.UpdateMessageStatus(ctx, id, model.StatusProcessing, ""); err != nil {
+		if s.alreadyProcessed(ctx, err, id) {
+			log.Info("Message already processed", zap.Int64("id", id))
+			return nil
+		}
+		return s.handleError(ctx, "message processing", err, id)
+	}
 
 	// Update the message status in the database to mark it as processed
-	if err := s.repo.UpdateMessageStatus(ctx, id, true); err != nil {
-		return s.handleError("message processing", err, id)
+	if err := s.repo.UpdateMessageStatus(ctx, id, model.StatusProcessed, ""); err != nil {
+		return s.handleError(ctx, "message processing", err, id)
+	}
+
+	log.Info("Successfully processed message", zap.Int64("id", id))
+
+	return nil
+}
+
+// alreadyProcessed reports whether a claim failed because the message is already processed
+func (s *messageService) alreadyProcessed(ctx context.Context, err error, id int64) bool {
+	if !errors.Is(err, repositoryerr.ErrInvalidStatusTransition) {
+		return false
+	}
+	message, getErr := s.repo.GetMessageByID(ctx, id)
+	return getErr == nil && message != nil && message.Status == model.StatusProcessed
+}
+
+// FailMessage records a failed processing attempt so that it can be retried
+func (s *messageService) FailMessage(ctx context.Context, id int64, reason string) error {
+	log := s.logger.FromContext(ctx)
+	log.Warn("Recording failed processing attempt", zap.Int64("id", id), zap.String("reason", reason))
+
+	if err := s.repo.UpdateMessageStatus(ctx, id, model.StatusFailed, reason); err != nil {
+		return s.handleError(ctx, "message failure recording", err, id)
 	}
 
-	s.logger.Info("Successfully processed message", zap.Int64("id", id))
+	return nil
+}
+
+// DeadLetterMessage marks a message whose processing retries were exhausted
+func (s *messageService) DeadLetterMessage(ctx context.Context, id int64, reason string) error {
+	log := s.logger.FromContext(ctx)
+	log.Warn("Dead-lettering message", zap.Int64("id", id), zap.String("reason", reason))
+
+	if err := s.repo.UpdateMessageStatus(ctx, id, model.StatusDeadLettered, reason); err != nil {
+		return s.handleError(ctx, "message dead-lettering", err, id)
+	}
 
 	return nil
 }
 
+// GetMessage returns a single message by ID
+func (s *messageService) GetMessage(ctx context.Context, id int64) (*model.Message, error) {
+	log := s.logger.FromContext(ctx)
+	log.Info("Fetching message from repository", zap.Int64("id", id))
+
+	// Load the message from the database
+	message, err := s.repo.GetMessageByID(ctx, id)
+	if err != nil {
+		return nil, s.handleError(ctx, "message retrieval", err, id)
+	}
+
+	log.Info("Successfully fetched message", zap.Int64("id", id))
+
+	return message, nil
+}
+
+// ListMessages returns a page of messages matching the filter
+func (s *messageService) ListMessages(ctx context.Context, filter model.MessageFilter) (*model.MessagePage, error) {
+	log := s.logger.FromContext(ctx)
+	log.Info("Listing messages from repository", zap.Int("limit", filter.Limit))
+
+	// Ask for one extra row so we know whether another page follows
+	pageSize := filter.Limit
+	filter.Limit = pageSize + 1
+
+	messages, err := s.repo.ListMessages(ctx, filter)
+	if err != nil {
+		return nil, s.handleError(ctx, "message listing", err, 0)
+	}
+
+	page := &model.MessagePage{Messages: messages}
+	if len(messages) > pageSize {
+		// Trim the look-ahead row and point the cursor at the last returned message
+		page.Messages = messages[:pageSize]
+		last := page.Messages[pageSize-1]
+		page.NextCursor = model.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	log.Info("Successfully listed messages", zap.Int("count", len(page.Messages)))
+
+	return page, nil
+}
+
 // GetStatistics returns message statistics
 func (s *messageService) GetStatistics(ctx context.Context) (*model.Statistics, error) {
-	s.logger.Info("Fetching statistics from repository")
+	log := s.logger.FromContext(ctx)
+	log.Info("Fetching statistics from repository")
 
 	// Get message statistics from the database
 	stats, err := s.repo.GetStatistics(ctx)
@@ -127,21 +237,24 @@ func (s *messageService) GetStatistics(ctx context.Context) (*model.Statistics,
 		if errors.As(err, &repoErr) {
 			switch repoErr.ErrorCode() {
 			case repositoryerr.ErrorCodeDatabaseConnection:
-				s.logger.Error("Database connection error during statistics retrieval", zap.Error(err))
+				log.Error("Database connection error during statistics retrieval", zap.Error(err))
 				return nil, fmt.Errorf("database unavailable: %w", err)
 			default:
-				s.logger.Error("Failed to get statistics from repository", zap.Error(err))
+				log.Error("Failed to get statistics from repository", zap.Error(err))
 				return nil, fmt.Errorf("failed to get statistics from repository: %w", err)
 			}
 		}
-		s.logger.Error("Failed to get statistics from repository", zap.Error(err))
+		log.Error("Failed to get statistics from repository", zap.Error(err))
 		return nil, fmt.Errorf("failed to get statistics from repository: %w", err)
 	}
 
-	s.logger.Info("Successfully fetched statistics", 
+	log.Info("Successfully fetched statistics",
 		zap.Int64("total", stats.TotalMessages),
+		zap.Int64("pending", stats.PendingMessages),
+		zap.Int64("processing", stats.ProcessingMessages),
 		zap.Int64("processed", stats.ProcessedMessages),
-		zap.Int64("unprocessed", stats.UnprocessedMessages))
+		zap.Int64("failed", stats.FailedMessages),
+		zap.Int64("dead_lettered", stats.DeadLetteredMessages))
 
 	return stats, nil
 }
@@ -4,19 +4,23 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"httpchat/internal/interfaces"
 	"httpchat/internal/logger"
 	"httpchat/internal/model"
+	"httpchat/internal/repositoryerr"
 )
 
 // mockMessageRepository implements interfaces.MessageRepository for testing
 type mockMessageRepository struct {
 	createMessageFunc  func(ctx context.Context, content string) (*model.Message, error)
+	createMessageIdempotentFunc func(ctx context.Context, content, key, fingerprint string) (*model.Message, bool, error)
 	getMessageByIDFunc func(ctx context.Context, id int64) (*model.Message, error)
-	updateMessageStatusFunc func(ctx context.Context, id int64, processed bool) error
-	getAllMessagesFunc func(ctx context.Context) ([]*model.Message, error)
+	updateMessageStatusFunc func(ctx context.Context, id int64, status model.MessageStatus, lastError string) error
+	listMessagesFunc   func(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error)
 	getStatisticsFunc  func(ctx context.Context) (*model.Statistics, error)
+	keyTTL             time.Duration
 }
 
 func (m *mockMessageRepository) CreateMessage(ctx context.Context, content string) (*model.Message, error) {
@@ -26,6 +30,14 @@ func (m *mockMessageRepository) CreateMessage(ctx context.Context, content strin
 	return nil, nil
 }
 
+func (m *mockMessageRepository) CreateMessageIdempotent(ctx context.Context, content, key, fingerprint string, keyTTL time.Duration) (*model.Message, bool, error) {
+	m.keyTTL = keyTTL
+	if m.createMessageIdempotentFunc != nil {
+		return m.createMessageIdempotentFunc(ctx, content, key, fingerprint)
+	}
+	return nil, false, nil
+}
+
 func (m *mockMessageRepository) GetMessageByID(ctx context.Context, id int64) (*model.Message, error) {
 	if m.getMessageByIDFunc != nil {
 		return m.getMessageByIDFunc(ctx, id)
@@ -33,16 +45,16 @@ func (m *mockMessageRepository) GetMessageByID(ctx context.Context, id int64) (*
 	return nil, nil
 }
 
-func (m *mockMessageRepository) UpdateMessageStatus(ctx context.Context, id int64, processed bool) error {
+func (m *mockMessageRepository) UpdateMessageStatus(ctx context.Context, id int64, status model.MessageStatus, lastError string) error {
 	if m.updateMessageStatusFunc != nil {
-		return m.updateMessageStatusFunc(ctx, id, processed)
+		return m.updateMessageStatusFunc(ctx, id, status, lastError)
 	}
 	return nil
 }
 
-func (m *mockMessageRepository) GetAllMessages(ctx context.Context) ([]*model.Message, error) {
-	if m.getAllMessagesFunc != nil {
-		return m.getAllMessagesFunc(ctx)
+func (m *mockMessageRepository) ListMessages(ctx context.Context, filter model.MessageFilter) ([]*model.Message, error) {
+	if m.listMessagesFunc != nil {
+		return m.listMessagesFunc(ctx, filter)
 	}
 	return nil, nil
 }
@@ -57,50 +69,6 @@ func (m *mockMessageRepository) GetStatistics(ctx context.Context) (*model.Stati
 // Ensure mockMessageRepository implements interfaces.MessageRepository
 var _ interfaces.MessageRepository = (*mockMessageRepository)(nil)
 
-type mockKafkaProducer struct {
-	sendMessageFunc func(ctx context.Context, topic string, message []byte) error
-	closeFunc       func() error
-}
-
-func (m *mockKafkaProducer) SendMessage(ctx context.Context, topic string, message []byte) error {
-	if m.sendMessageFunc != nil {
-		return m.sendMessageFunc(ctx, topic, message)
-	}
-	return nil
-}
-
-func (m *mockKafkaProducer) Close() error {
-	if m.closeFunc != nil {
-		return m.closeFunc()
-	}
-	return nil
-}
-
-// Ensure mockKafkaProducer implements interfaces.KafkaProducer
-var _ interfaces.KafkaProducer = (*mockKafkaProducer)(nil)
-
-type mockKafkaConsumer struct {
-	readMessageFunc func(ctx context.Context, topic string) ([]byte, error)
-	closeFunc       func() error
-}
-
-func (m *mockKafkaConsumer) ReadMessage(ctx context.Context, topic string) ([]byte, error) {
-	if m.readMessageFunc != nil {
-		return m.readMessageFunc(ctx, topic)
-	}
-	return []byte{}, nil
-}
-
-func (m *mockKafkaConsumer) Close() error {
-	if m.closeFunc != nil {
-		return m.closeFunc()
-	}
-	return nil
-}
-
-// Ensure mockKafkaConsumer implements interfaces.KafkaConsumer
-var _ interfaces.KafkaConsumer = (*mockKafkaConsumer)(nil)
-
 func TestCreateMessage(t *testing.T) {
 	ctx := context.Background()
 	
@@ -114,24 +82,14 @@ func TestCreateMessage(t *testing.T) {
 				return &model.Message{
 					ID:        1,
 					Content:   "Test message",
-					Processed: false,
+					Status:    model.StatusPending,
 				}, nil
 			},
 		}
 		
-		producer := &mockKafkaProducer{
-			sendMessageFunc: func(_ context.Context, _ string, _ []byte) error {
-				return nil
-			},
-		}
-		
-		consumer := &mockKafkaConsumer{}
-		
 		service := NewMessageService(
 			repo,
-			producer,
-			consumer,
-			"test-topic",
+			time.Hour,
 			testLogger,
 		)
 		
@@ -154,14 +112,9 @@ func TestCreateMessage(t *testing.T) {
 			},
 		}
 		
-		producer := &mockKafkaProducer{}
-		consumer := &mockKafkaConsumer{}
-		
 		service := NewMessageService(
 			repo,
-			producer,
-			consumer,
-			"test-topic",
+			time.Hour,
 			testLogger,
 		)
 		
@@ -172,38 +125,77 @@ func TestCreateMessage(t *testing.T) {
 		}
 	})
 	
-	// Test Kafka error
-	t.Run("Kafka error", func(t *testing.T) {
+}
+
+func TestCreateMessageIdempotent(t *testing.T) {
+	ctx := context.Background()
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Test that replays are reported and fingerprints depend only on the content
+	t.Run("Fingerprint and replay", func(t *testing.T) {
+		var fingerprints []string
 		repo := &mockMessageRepository{
-			createMessageFunc: func(_ context.Context, _ string) (*model.Message, error) {
-				return &model.Message{
-					ID:        1,
-					Content:   "Test message",
-					Processed: false,
-				}, nil
+			createMessageIdempotentFunc: func(_ context.Context, content, _, fingerprint string) (*model.Message, bool, error) {
+				fingerprints = append(fingerprints, fingerprint)
+				return &model.Message{ID: 1, Content: content}, len(fingerprints) > 1, nil
 			},
 		}
-		
-		producer := &mockKafkaProducer{
-			sendMessageFunc: func(_ context.Context, _ string, _ []byte) error {
-				return errors.New("kafka error")
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		id, replayed, err := service.CreateMessageIdempotent(ctx, "Test message", "key")
+		if err != nil || id != 1 || replayed {
+			t.Fatalf("Expected a fresh message with ID 1, got id=%d replayed=%v err=%v", id, replayed, err)
+		}
+
+		_, replayed, err = service.CreateMessageIdempotent(ctx, "Test message", "key")
+		if err != nil || !replayed {
+			t.Fatalf("Expected a replayed message, got replayed=%v err=%v", replayed, err)
+		}
+
+		_, _, _ = service.CreateMessageIdempotent(ctx, "Other message", "key")
+
+		if fingerprints[0] != fingerprints[1] {
+			t.Error("Expected identical content to produce identical fingerprints")
+		}
+		if fingerprints[0] == fingerprints[2] {
+			t.Error("Expected different content to produce different fingerprints")
+		}
+	})
+
+	// Test that keys expire after the configured TTL
+	t.Run("Key TTL", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			createMessageIdempotentFunc: func(_ context.Context, content, _, _ string) (*model.Message, bool, error) {
+				return &model.Message{ID: 1, Content: content}, false, nil
 			},
 		}
-		
-		consumer := &mockKafkaConsumer{}
-		
-		service := NewMessageService(
-			repo,
-			producer,
-			consumer,
-			"test-topic",
-			testLogger,
-		)
-		
-		_, err := service.CreateMessage(ctx, "Test message")
-		
-		if err == nil {
-			t.Error("Expected error, got none")
+
+		service := NewMessageService(repo, 24*time.Hour, testLogger)
+
+		_, _, _ = service.CreateMessageIdempotent(ctx, "Test message", "key")
+		if repo.keyTTL != 24*time.Hour {
+			t.Errorf("Expected the key TTL to be passed to the repository, got %v", repo.keyTTL)
+		}
+	})
+
+	// Test conflicting reuse keeps the idempotency key mismatch code
+	t.Run("Conflict", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			createMessageIdempotentFunc: func(_ context.Context, _, _, _ string) (*model.Message, bool, error) {
+				return nil, false, repositoryerr.New(repositoryerr.ErrorCodeIdempotencyKeyMismatch, "CreateMessageIdempotent", repositoryerr.ErrIdempotencyKeyMismatch)
+			},
+		}
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		_, _, err := service.CreateMessageIdempotent(ctx, "Test message", "key")
+
+		var repoErr *repositoryerr.RepositoryError
+		if !errors.As(err, &repoErr) || repoErr.ErrorCode() != repositoryerr.ErrorCodeIdempotencyKeyMismatch {
+			t.Errorf("Expected idempotency key mismatch error, got %v", err)
 		}
 	})
 }
@@ -216,20 +208,17 @@ func TestProcessMessage(t *testing.T) {
 
 	// Test successful message processing
 	t.Run("Successful processing", func(t *testing.T) {
+		var transitions []model.MessageStatus
 		repo := &mockMessageRepository{
-			updateMessageStatusFunc: func(_ context.Context, _ int64, _ bool) error {
+			updateMessageStatusFunc: func(_ context.Context, _ int64, status model.MessageStatus, _ string) error {
+				transitions = append(transitions, status)
 				return nil
 			},
 		}
 		
-		producer := &mockKafkaProducer{}
-		consumer := &mockKafkaConsumer{}
-		
 		service := NewMessageService(
 			repo,
-			producer,
-			consumer,
-			"test-topic",
+			time.Hour,
 			testLogger,
 		)
 		
@@ -238,24 +227,79 @@ func TestProcessMessage(t *testing.T) {
 		if err != nil {
 			t.Errorf("Expected no error, got %v", err)
 		}
+
+		// The message must pass through processing before it is processed
+		expected := []model.MessageStatus{model.StatusProcessing, model.StatusProcessed}
+		if len(transitions) != len(expected) || transitions[0] != expected[0] || transitions[1] != expected[1] {
+			t.Errorf("Expected transitions %v, got %v", expected, transitions)
+		}
+	})
+	
+	// Processing a processed message again changes nothing
+	t.Run("Already processed", func(t *testing.T) {
+		var transitions []model.MessageStatus
+		repo := &mockMessageRepository{
+			updateMessageStatusFunc: func(_ context.Context, _ int64, status model.MessageStatus, _ string) error {
+				transitions = append(transitions, status)
+				return repositoryerr.New(repositoryerr.ErrorCodeInvalidStatusTransition, "UpdateMessageStatus", repositoryerr.ErrInvalidStatusTransition)
+			},
+			getMessageByIDFunc: func(_ context.Context, id int64) (*model.Message, error) {
+				return &model.Message{ID: id, Status: model.StatusProcessed}, nil
+			},
+		}
+
+		service := NewMessageService(
+			repo,
+			time.Hour,
+			testLogger,
+		)
+
+		err := service.ProcessMessage(ctx, 1)
+
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if len(transitions) != 1 {
+			t.Errorf("Expected only the claim to be attempted, got %v", transitions)
+		}
+	})
+
+	// Test illegal transition
+	t.Run("Dead-lettered", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			updateMessageStatusFunc: func(_ context.Context, _ int64, _ model.MessageStatus, _ string) error {
+				return repositoryerr.New(repositoryerr.ErrorCodeInvalidStatusTransition, "UpdateMessageStatus", repositoryerr.ErrInvalidStatusTransition)
+			},
+			getMessageByIDFunc: func(_ context.Context, id int64) (*model.Message, error) {
+				return &model.Message{ID: id, Status: model.StatusDeadLettered}, nil
+			},
+		}
+
+		service := NewMessageService(
+			repo,
+			time.Hour,
+			testLogger,
+		)
+
+		err := service.ProcessMessage(ctx, 1)
+
+		var repoErr *repositoryerr.RepositoryError
+		if !errors.As(err, &repoErr) || repoErr.ErrorCode() != repositoryerr.ErrorCodeInvalidStatusTransition {
+			t.Errorf("Expected invalid status transition error, got %v", err)
+		}
 	})
 	
 	// Test repository error
 	t.Run("Repository error", func(t *testing.T) {
 		repo := &mockMessageRepository{
-			updateMessageStatusFunc: func(_ context.Context, _ int64, _ bool) error {
+			updateMessageStatusFunc: func(_ context.Context, _ int64, _ model.MessageStatus, _ string) error {
 				return errors.New("database error")
 			},
 		}
 		
-		producer := &mockKafkaProducer{}
-		consumer := &mockKafkaConsumer{}
-		
 		service := NewMessageService(
 			repo,
-			producer,
-			consumer,
-			"test-topic",
+			time.Hour,
 			testLogger,
 		)
 		
@@ -267,6 +311,49 @@ func TestProcessMessage(t *testing.T) {
 	})
 }
 
+func TestFailAndDeadLetterMessage(t *testing.T) {
+	ctx := context.Background()
+	
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	var gotStatus model.MessageStatus
+	var gotError string
+	repo := &mockMessageRepository{
+		updateMessageStatusFunc: func(_ context.Context, _ int64, status model.MessageStatus, lastError string) error {
+			gotStatus = status
+			gotError = lastError
+			return nil
+		},
+	}
+	
+	service := NewMessageService(
+		repo,
+		time.Hour,
+		testLogger,
+	)
+
+	// Test recording a failed attempt
+	t.Run("Fail", func(t *testing.T) {
+		if err := service.FailMessage(ctx, 1, "timeout"); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if gotStatus != model.StatusFailed || gotError != "timeout" {
+			t.Errorf("Expected failed with reason, got %s %q", gotStatus, gotError)
+		}
+	})
+
+	// Test dead-lettering after retries
+	t.Run("DeadLetter", func(t *testing.T) {
+		if err := service.DeadLetterMessage(ctx, 1, "retries exhausted"); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if gotStatus != model.StatusDeadLettered || gotError != "retries exhausted" {
+			t.Errorf("Expected dead_lettered with reason, got %s %q", gotStatus, gotError)
+		}
+	})
+}
+
 func TestGetStatistics(t *testing.T) {
 	ctx := context.Background()
 	
@@ -276,9 +363,12 @@ func TestGetStatistics(t *testing.T) {
 	// Test successful statistics retrieval
 	t.Run("Successful retrieval", func(t *testing.T) {
 		stats := &model.Statistics{
-			TotalMessages:       10,
-			ProcessedMessages:   7,
-			UnprocessedMessages: 3,
+			TotalMessages:        10,
+			PendingMessages:      1,
+			ProcessingMessages:   1,
+			ProcessedMessages:    6,
+			FailedMessages:       1,
+			DeadLetteredMessages: 1,
 		}
 		
 		repo := &mockMessageRepository{
@@ -287,14 +377,9 @@ func TestGetStatistics(t *testing.T) {
 			},
 		}
 		
-		producer := &mockKafkaProducer{}
-		consumer := &mockKafkaConsumer{}
-		
 		service := NewMessageService(
 			repo,
-			producer,
-			consumer,
-			"test-topic",
+			time.Hour,
 			testLogger,
 		)
 		
@@ -312,8 +397,8 @@ func TestGetStatistics(t *testing.T) {
 			t.Errorf("Expected ProcessedMessages %d, got %d", stats.ProcessedMessages, result.ProcessedMessages)
 		}
 		
-		if result.UnprocessedMessages != stats.UnprocessedMessages {
-			t.Errorf("Expected UnprocessedMessages %d, got %d", stats.UnprocessedMessages, result.UnprocessedMessages)
+		if result.DeadLetteredMessages != stats.DeadLetteredMessages {
+			t.Errorf("Expected DeadLetteredMessages %d, got %d", stats.DeadLetteredMessages, result.DeadLetteredMessages)
 		}
 	})
 	
@@ -325,14 +410,9 @@ func TestGetStatistics(t *testing.T) {
 			},
 		}
 		
-		producer := &mockKafkaProducer{}
-		consumer := &mockKafkaConsumer{}
-		
 		service := NewMessageService(
 			repo,
-			producer,
-			consumer,
-			"test-topic",
+			time.Hour,
 			testLogger,
 		)
 		
@@ -343,3 +423,137 @@ func TestGetStatistics(t *testing.T) {
 		}
 	})
 }
+
+func TestGetMessage(t *testing.T) {
+	ctx := context.Background()
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	// Test successful retrieval
+	t.Run("Successful retrieval", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			getMessageByIDFunc: func(_ context.Context, id int64) (*model.Message, error) {
+				return &model.Message{ID: id, Content: "Test message"}, nil
+			},
+		}
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		message, err := service.GetMessage(ctx, 1)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if message.ID != 1 {
+			t.Errorf("Expected ID 1, got %d", message.ID)
+		}
+	})
+
+	// Test message not found keeps the repository error code
+	t.Run("Not found", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			getMessageByIDFunc: func(_ context.Context, _ int64) (*model.Message, error) {
+				return nil, repositoryerr.New(repositoryerr.ErrorCodeMessageNotFound, "GetMessageByID", repositoryerr.ErrMessageNotFound)
+			},
+		}
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		_, err := service.GetMessage(ctx, 1)
+
+		var repoErr *repositoryerr.RepositoryError
+		if !errors.As(err, &repoErr) || repoErr.ErrorCode() != repositoryerr.ErrorCodeMessageNotFound {
+			t.Errorf("Expected message not found error, got %v", err)
+		}
+	})
+}
+
+func TestListMessages(t *testing.T) {
+	ctx := context.Background()
+
+	// Create logger for testing
+	testLogger, _ := logger.New()
+
+	now := time.Now()
+	stored := []*model.Message{
+		{ID: 3, Content: "Third", CreatedAt: now.Add(2 * time.Second)},
+		{ID: 2, Content: "Second", CreatedAt: now.Add(time.Second)},
+		{ID: 1, Content: "First", CreatedAt: now},
+	}
+
+	// Test a page followed by another page
+	t.Run("Page with next cursor", func(t *testing.T) {
+		var requestedLimit int
+		repo := &mockMessageRepository{
+			listMessagesFunc: func(_ context.Context, filter model.MessageFilter) ([]*model.Message, error) {
+				requestedLimit = filter.Limit
+				return stored[:filter.Limit], nil
+			},
+		}
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		page, err := service.ListMessages(ctx, model.MessageFilter{Order: model.SortOrderDesc, Limit: 2})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if requestedLimit != 3 {
+			t.Errorf("Expected repository to be asked for 3 rows, got %d", requestedLimit)
+		}
+
+		if len(page.Messages) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(page.Messages))
+		}
+
+		cursor, err := model.DecodeMessageCursor(page.NextCursor)
+		if err != nil {
+			t.Fatalf("Expected a valid next cursor, got %v", err)
+		}
+
+		if cursor.ID != 2 || !cursor.CreatedAt.Equal(stored[1].CreatedAt) {
+			t.Errorf("Expected cursor to point at message 2, got %+v", cursor)
+		}
+	})
+
+	// Test the last page
+	t.Run("Last page", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			listMessagesFunc: func(_ context.Context, _ model.MessageFilter) ([]*model.Message, error) {
+				return stored, nil
+			},
+		}
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		page, err := service.ListMessages(ctx, model.MessageFilter{Order: model.SortOrderDesc, Limit: 5})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if len(page.Messages) != 3 {
+			t.Errorf("Expected 3 messages, got %d", len(page.Messages))
+		}
+
+		if page.NextCursor != "" {
+			t.Errorf("Expected no next cursor, got %q", page.NextCursor)
+		}
+	})
+
+	// Test repository error
+	t.Run("Repository error", func(t *testing.T) {
+		repo := &mockMessageRepository{
+			listMessagesFunc: func(_ context.Context, _ model.MessageFilter) ([]*model.Message, error) {
+				return nil, errors.New("database error")
+			},
+		}
+
+		service := NewMessageService(repo, time.Hour, testLogger)
+
+		_, err := service.ListMessages(ctx, model.MessageFilter{Limit: 10})
+		if err == nil {
+			t.Error("Expected error, got none")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+// Package tracing provides the OpenTelemetry tracing of the service and the propagation
+// of the W3C trace context across HTTP requests and broker messages.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of every span the service starts
+const instrumentationName = "httpchat"
+
+// Exporters accepted by Config
+const (
+	// ExporterNone records no spans, which costs next to nothing
+	ExporterNone = "none"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP. The endpoint
+	// is read from the standard OTEL_EXPORTER_OTLP_* variables.
+	ExporterOTLP = "otlp"
+)
+
+// Config configures where spans are exported
+type Config struct {
+	// Exporter is none or otlp
+	Exporter string
+	// ServiceName is the service.name resource attribute of the spans
+	ServiceName string
+	// SampleRatio is the fraction of new traces that are recorded. Traces started by a
+	// caller follow the sampling decision of the caller.
+	SampleRatio float64
+}
+
+// propagator reads and writes the W3C traceparent and tracestate headers
+var propagator = propagation.TraceContext{}
+
+// Setup installs the global tracer provider and returns a function that flushes the
+// buffered spans and stops it. With ExporterNone the no-op provider stays in place.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("tracing sample ratio %v is not between 0 and 1", cfg.SampleRatio)
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the global provider. It is looked up on every call, so
+// that spans reach the provider installed last.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject writes the trace context of ctx into headers. Nothing is written when ctx
+// carries no span.
+func Inject(ctx context.Context, headers map[string]string) {
+	propagator.Inject(ctx, propagation.MapCarrier(headers))
+}
+
+// Extract returns ctx with the remote span of the trace context found in headers, or
+// ctx itself when headers carry none
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
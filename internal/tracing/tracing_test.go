@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"httpchat/internal/tracing/tracingtest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// remoteTraceParent is a sampled trace context as a caller would send it
+const remoteTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracingtest.Install(t)
+
+	var handlerSpan trace.SpanContext
+	router := gin.New()
+	router.Use(GinMiddleware())
+	router.GET("/messages/:id", func(c *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	router.GET("/statistics", func(c *gin.Context) {
+		c.Status(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/messages/1", nil)
+	req.Header.Set("traceparent", remoteTraceParent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/statistics", nil))
+
+	// The span continues the trace of the caller and is seen by the handler
+	span, ok := tracingtest.SpanNamed(exporter, "GET /messages/:id")
+	if assert.True(t, ok) {
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+		assert.Equal(t, span.SpanContext.SpanID(), handlerSpan.SpanID())
+		assert.Contains(t, span.Attributes, attribute.String("http.route", "/messages/:id"))
+		assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+		assert.Equal(t, codes.Unset, span.Status.Code)
+	}
+
+	// Server errors fail the span of a request that started a new trace
+	span, ok = tracingtest.SpanNamed(exporter, "GET /statistics")
+	if assert.True(t, ok) {
+		assert.False(t, span.Parent.IsValid())
+		assert.Equal(t, codes.Error, span.Status.Code)
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	exporter := tracingtest.Install(t)
+
+	ctx, span := Tracer().Start(context.Background(), "request")
+	headers := map[string]string{"content-type": "application/json"}
+	Inject(ctx, headers)
+	End(span, nil)
+
+	assert.Contains(t, headers, "traceparent")
+	remote := trace.SpanContextFromContext(Extract(context.Background(), headers))
+	assert.True(t, remote.IsRemote())
+	assert.Equal(t, exporter.GetSpans()[0].SpanContext.TraceID(), remote.TraceID())
+	assert.Equal(t, exporter.GetSpans()[0].SpanContext.SpanID(), remote.SpanID())
+
+	// Without a span there is nothing to inject, and without headers nothing to extract
+	empty := map[string]string{}
+	Inject(context.Background(), empty)
+	assert.Empty(t, empty)
+	assert.Equal(t, ctx, Extract(ctx, nil))
+}
+
+func TestEnd(t *testing.T) {
+	exporter := tracingtest.Install(t)
+
+	_, span := Tracer().Start(context.Background(), "failing")
+	End(span, assert.AnError)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, assert.AnError.Error(), spans[0].Status.Description)
+		assert.Len(t, spans[0].Events, 1)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone, ServiceName: "httpchat", SampleRatio: 1})
+	if assert.NoError(t, err) {
+		assert.NoError(t, shutdown(context.Background()))
+	}
+
+	_, err = Setup(context.Background(), Config{Exporter: "jaeger"})
+	assert.Error(t, err)
+	_, err = Setup(context.Background(), Config{Exporter: ExporterOTLP, SampleRatio: 2})
+	assert.Error(t, err)
+}
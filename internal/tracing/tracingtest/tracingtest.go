@@ -0,0 +1,40 @@
+// Package tracingtest records the spans of the service in memory, so that tests can
+// assert on them.
+package tracingtest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Install replaces the global tracer provider with one that records every span in the
+// returned exporter as soon as it ends. The previous provider is restored when the test
+// finishes, so tests using it must not run in parallel.
+func Install(t testing.TB) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// SpanNamed returns the first recorded span with the given name
+func SpanNamed(exporter *tracetest.InMemoryExporter, name string) (tracetest.SpanStub, bool) {
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
@@ -3,6 +3,7 @@ package validation
 
 import (
 	"regexp"
+	"strconv"
 	"unicode/utf8"
 )
 
@@ -60,6 +61,54 @@ func (v *MessageValidator) ValidateMessageID(id int64) error {
 	return nil
 }
 
+// ValidateListLimit validates the page size requested for message listing
+func (v *MessageValidator) ValidateListLimit(limit int) error {
+	// Page size must be positive and bounded to keep queries cheap
+	if limit <= 0 || limit > MaxListLimit {
+		return &Error{
+			Code:    ValidationErrorCodeInvalidLimit,
+			Message: "limit must be between 1 and " + strconv.Itoa(MaxListLimit),
+		}
+	}
+
+	return nil
+}
+
+// ValidateReplayLimit validates the number of dead-lettered events requested for replay
+func (v *MessageValidator) ValidateReplayLimit(limit int) error {
+	// A single replay is bounded so that it finishes within one admin request
+	if limit <= 0 || limit > MaxReplayLimit {
+		return &Error{
+			Code:    ValidationErrorCodeInvalidLimit,
+			Message: "limit must be between 1 and " + strconv.Itoa(MaxReplayLimit),
+		}
+	}
+
+	return nil
+}
+
+// ValidateIdempotencyKey validates the value of an Idempotency-Key header
+func (v *MessageValidator) ValidateIdempotencyKey(key string) error {
+	// Keys are opaque client tokens, but must be bounded and printable to be stored safely
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		return &Error{
+			Code:    ValidationErrorCodeInvalidIdempotencyKey,
+			Message: "idempotency key must be between 1 and " + strconv.Itoa(MaxIdempotencyKeyLength) + " characters",
+		}
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return &Error{
+				Code:    ValidationErrorCodeInvalidIdempotencyKey,
+				Message: "idempotency key must contain only printable ASCII characters",
+			}
+		}
+	}
+
+	return nil
+}
+
 // Error represents a validation error
 type Error struct {
 	Code    string
@@ -76,4 +125,16 @@ const (
 	ValidationErrorCodeContentTooLong    = "CONTENT_TOO_LONG"
 	ValidationErrorCodeInvalidCharacters = "INVALID_CHARACTERS"
 	ValidationErrorCodeInvalidID         = "INVALID_ID"
-)
\ No newline at end of file
+	ValidationErrorCodeInvalidLimit      = "INVALID_LIMIT"
+
+	ValidationErrorCodeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+)
+
+// MaxListLimit is the largest page size accepted when listing messages
+const MaxListLimit = 500
+
+// MaxReplayLimit is the largest number of dead-lettered events replayed in one request
+const MaxReplayLimit = 1000
+
+// MaxIdempotencyKeyLength is the longest accepted Idempotency-Key header value
+const MaxIdempotencyKeyLength = 255
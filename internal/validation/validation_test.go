@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,3 +75,74 @@ func TestMessageValidator_ValidateMessageID(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestMessageValidator_ValidateListLimit(t *testing.T) {
+	validator := NewMessageValidator(1000)
+
+	// Test invalid limit (zero)
+	t.Run("ZeroLimit", func(t *testing.T) {
+		err := validator.ValidateListLimit(0)
+		assert.Error(t, err)
+		validationErr, ok := err.(*Error)
+		assert.True(t, ok)
+		assert.Equal(t, ValidationErrorCodeInvalidLimit, validationErr.Code)
+	})
+
+	// Test invalid limit (too large)
+	t.Run("TooLargeLimit", func(t *testing.T) {
+		err := validator.ValidateListLimit(MaxListLimit + 1)
+		assert.Error(t, err)
+		validationErr, ok := err.(*Error)
+		assert.True(t, ok)
+		assert.Equal(t, ValidationErrorCodeInvalidLimit, validationErr.Code)
+	})
+
+	// Test valid limit
+	t.Run("ValidLimit", func(t *testing.T) {
+		err := validator.ValidateListLimit(MaxListLimit)
+		assert.NoError(t, err)
+	})
+}
+
+func TestMessageValidator_ValidateReplayLimit(t *testing.T) {
+	validator := NewMessageValidator(1000)
+
+	// Test invalid limits
+	for _, limit := range []int{0, MaxReplayLimit + 1} {
+		err := validator.ValidateReplayLimit(limit)
+		assert.Error(t, err)
+		validationErr, ok := err.(*Error)
+		assert.True(t, ok)
+		assert.Equal(t, ValidationErrorCodeInvalidLimit, validationErr.Code)
+	}
+
+	// Test valid limit
+	assert.NoError(t, validator.ValidateReplayLimit(MaxReplayLimit))
+}
+
+func TestMessageValidator_ValidateIdempotencyKey(t *testing.T) {
+	validator := NewMessageValidator(1000)
+
+	// Test invalid keys
+	invalidKeys := map[string]string{
+		"EmptyKey":         "",
+		"TooLongKey":       strings.Repeat("k", MaxIdempotencyKeyLength+1),
+		"ControlCharacter": "key\n",
+		"NonASCII":         "ключ",
+	}
+	for name, key := range invalidKeys {
+		t.Run(name, func(t *testing.T) {
+			err := validator.ValidateIdempotencyKey(key)
+			assert.Error(t, err)
+			validationErr, ok := err.(*Error)
+			assert.True(t, ok)
+			assert.Equal(t, ValidationErrorCodeInvalidIdempotencyKey, validationErr.Code)
+		})
+	}
+
+	// Test valid key
+	t.Run("ValidKey", func(t *testing.T) {
+		err := validator.ValidateIdempotencyKey("8e03978e-40d5-43e8-bc93-6894a57f9324")
+		assert.NoError(t, err)
+	})
+}